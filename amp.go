@@ -0,0 +1,43 @@
+package tidyhtml
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ampAttrs are the attributes that mark AMP documents and the parts of
+// them that the AMP validator looks for, which are written without a
+// value, as they are in the AMP documentation.
+var ampAttrs = map[string]bool{
+	"⚡": true, "amp": true, "⚡4ads": true, "amp4ads": true,
+	"⚡4email": true, "amp4email": true, "amp-boilerplate": true,
+	"amp4ads-boilerplate": true, "amp4email-boilerplate": true,
+	"amp-custom": true,
+}
+
+// isAMPBoilerplate reports whether an element is one of the mandatory
+// boilerplate styles of an AMP document, or the <noscript> that holds
+// one, which the AMP validator requires to be exactly as they are given.
+func isAMPBoilerplate(n *html.Node) bool {
+	switch n.Data {
+	case "style":
+		for _, a := range n.Attr {
+			if strings.HasSuffix(a.Key, "-boilerplate") && ampAttrs[a.Key] {
+				return true
+			}
+		}
+	case "noscript":
+		// In the <head>, the contents of a <noscript> are parsed as
+		// text.
+		return n.FirstChild != nil && n.FirstChild.Type == html.TextNode &&
+			strings.Contains(n.FirstChild.Data, "amp-boilerplate")
+	}
+	return false
+}
+
+// isAMPAttr reports whether an attribute is written without a value
+// because it is one of ampAttrs.
+func isAMPAttr(opts Options, a html.Attribute) bool {
+	return opts.AMP && a.Val == "" && a.Namespace == "" && ampAttrs[a.Key]
+}
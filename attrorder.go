@@ -0,0 +1,153 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// attrOrderMark is the name of an attribute that markAttrOrder adds to the
+// start tags of formatting elements, with the names of their attributes in
+// the order they were written, because the parser sorts them.
+const attrOrderMark = ""
+
+// The elements whose attributes the parser sorts, as it compares them
+// with the formatting elements that are already open.
+var formattingElements = map[string]bool{
+	"a": true, "b": true, "big": true, "code": true, "em": true,
+	"font": true, "i": true, "nobr": true, "s": true, "small": true,
+	"strike": true, "strong": true, "tt": true, "u": true,
+}
+
+// markAttrOrder adds the attrOrderMark attribute to the start tags of
+// formatting elements in b that have more than one attribute. It returns b
+// as it is if there are none.
+func markAttrOrder(b []byte) []byte {
+	var buf bytes.Buffer
+	last, offset := 0, 0
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if last == 0 {
+				return b
+			}
+			// The rest of the input is left as it is.
+			break
+		}
+		raw := z.Raw()
+		start := offset
+		offset += len(raw)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		// TagName lower-cases the buffer in place, so the end of the
+		// name is found first.
+		i := 1
+		for i < len(raw) && !isTagSpace(rune(raw[i])) && raw[i] != '/' && raw[i] != '>' {
+			i++
+		}
+		name, more := z.TagName()
+		if !more || !formattingElements[string(name)] {
+			continue
+		}
+		var keys []string
+		for more {
+			var key []byte
+			key, _, more = z.TagAttr()
+			keys = append(keys, string(key))
+		}
+		if len(keys) < 2 {
+			continue
+		}
+		buf.Write(b[last : start+i])
+		buf.WriteString(" " + attrOrderMark + "=\"" + html.EscapeString(strings.Join(keys, " ")) + "\"")
+		last = start + i
+	}
+	buf.Write(b[last:])
+	return buf.Bytes()
+}
+
+// restoreAttrOrder removes the attrOrderMark attributes from n and its
+// descendants, and puts the other attributes back in the order that they
+// were written.
+func restoreAttrOrder(n *html.Node) {
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			if a.Key != attrOrderMark {
+				continue
+			}
+			n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+			index := map[string]int{}
+			for j, key := range strings.Split(a.Val, " ") {
+				if _, ok := index[key]; !ok {
+					index[key] = j
+				}
+			}
+			order := func(a html.Attribute) int {
+				if j, ok := index[a.Key]; ok {
+					return j
+				}
+				return len(index)
+			}
+			sort.SliceStable(n.Attr, func(i, j int) bool { return order(n.Attr[i]) < order(n.Attr[j]) })
+			break
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		restoreAttrOrder(c)
+	}
+}
+
+// removeDuplicateAttrs removes the attributes of n and its descendants
+// that have the same name as one before them. The parser only leaves these
+// when NUL characters in the names are replaced with U+FFFD, which it does
+// after it has removed the duplicates, and browsers do before.
+func removeDuplicateAttrs(n *html.Node) {
+	if n.Type == html.ElementNode && len(n.Attr) > 1 {
+		seen := map[string]bool{}
+		attrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			if key := a.Namespace + " " + a.Key; !seen[key] {
+				seen[key] = true
+				attrs = append(attrs, a)
+			}
+		}
+		n.Attr = attrs
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		removeDuplicateAttrs(c)
+	}
+}
+
+// sortAttrs sorts the attributes of n and its descendants by their
+// namespaces and names, except for elements with template tags among them.
+func sortAttrs(n *html.Node) {
+	if n.Type == html.ElementNode && !hasTemplateAttr(n.Attr) {
+		sortAttrList(n.Attr)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sortAttrs(c)
+	}
+}
+
+// sortAttrList sorts attributes by their namespaces and names.
+func sortAttrList(attrs []html.Attribute) {
+	sort.SliceStable(attrs, func(i, j int) bool {
+		a, b := attrs[i], attrs[j]
+		return a.Namespace < b.Namespace || a.Namespace == b.Namespace && a.Key < b.Key
+	})
+}
+
+// hasTemplateAttr reports whether attrs have template tags written among
+// them, which are masked as attributes with placeholders for names.
+func hasTemplateAttr(attrs []html.Attribute) bool {
+	for _, a := range attrs {
+		if placeholderRegexp.MatchString(a.Key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package tidyhtml
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// The attributes whose values are lists that can be broken onto more than
+// one line, with the delimiter that the whitespace they are broken at must
+// follow, or 0 for any whitespace. The whitespace around the items of
+// these lists is ignored, so a line break can take its place.
+var wrapAttrDelims = map[string]byte{
+	"class":       0,
+	"srcset":      ',',
+	"imagesrcset": ',',
+	"sizes":       ',',
+	"imagesizes":  ',',
+}
+
+// wrapAttrDelim returns the delimiter for breaking the value of a, as for
+// wrapAttrDelims, and whether it can be broken at all. The content of a
+// Content-Security-Policy <meta> is broken after the semicolons between
+// its directives.
+func wrapAttrDelim(n *html.Node, a html.Attribute) (byte, bool) {
+	if a.Namespace != "" {
+		return 0, false
+	}
+	if a.Key == "content" && n.Data == "meta" {
+		equiv, _ := attrValue(n, "http-equiv")
+		return ';', strings.EqualFold(equiv, "content-security-policy")
+	}
+	delim, ok := wrapAttrDelims[a.Key]
+	return delim, ok
+}
+
+// wrapAttr returns the escaped value of a, broken onto continuation lines
+// aligned under its start at col where it would make the line wider than
+// WrapAttrWidth. It is only broken at whitespace, after the delimiter for
+// a, and the breaks that were in the input are joined up again first, so
+// that a value that fits on one line is written on one.
+func (t *tidy) wrapAttr(n *html.Node, a html.Attribute, col int) string {
+	delim, ok := wrapAttrDelim(n, a)
+	if !ok || placeholderRegexp.MatchString(a.Val) {
+		return escapeAttr(a.Val, t.opts)
+	}
+	val := a.Val
+
+	// Split the value into its items and the whitespace between them.
+	var items, spaces []string
+	start := 0
+	for i := 0; i < len(val); {
+		if !isHTMLSpace(rune(val[i])) || i == 0 || delim != 0 && val[i-1] != delim {
+			i++
+			continue
+		}
+		j := i
+		for j < len(val) && isHTMLSpace(rune(val[j])) {
+			j++
+		}
+		if j < len(val) {
+			items = append(items, escapeAttr(val[start:i], t.opts))
+			spaces = append(spaces, escapeAttr(val[i:j], t.opts))
+			start = j
+		}
+		i = j
+	}
+	items = append(items, escapeAttr(val[start:], t.opts))
+	if len(items) == 1 {
+		return items[0]
+	}
+
+	b := strings.Builder{}
+	b.WriteString(items[0])
+	for i, item := range items[1:] {
+		space := spaces[i]
+		if strings.IndexByte(space, '\n') != -1 {
+			space = " "
+		}
+		b.WriteString(space)
+		b.WriteString(item)
+	}
+	joined := b.String()
+	// The closing quote is on the same line.
+	if col+utf8.RuneCountInString(joined)+1 <= t.opts.WrapAttrWidth {
+		return joined
+	}
+
+	unit := t.opts.indentation()
+	indentWidth := t.indent * utf8.RuneCountInString(unit)
+	prefix := "\n" + strings.Repeat(unit, t.indent) + strings.Repeat(" ", col-indentWidth)
+	b.Reset()
+	b.WriteString(items[0])
+	width := col + utf8.RuneCountInString(items[0])
+	for i, item := range items[1:] {
+		w := utf8.RuneCountInString(item)
+		if i == len(items)-2 {
+			w++
+		}
+		if width+1+w > t.opts.WrapAttrWidth {
+			b.WriteString(prefix)
+			width = col
+		} else {
+			b.WriteByte(' ')
+			width++
+		}
+		b.WriteString(item)
+		width += utf8.RuneCountInString(item)
+	}
+	return b.String()
+}
@@ -0,0 +1,213 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// ParseBOMMode returns the BOMMode with the given name,
+// which is "remove", "keep" or "add".
+func ParseBOMMode(name string) (BOMMode, error) {
+	switch strings.ToLower(name) {
+	case "remove":
+		return RemoveBOM, nil
+	case "keep":
+		return KeepBOM, nil
+	case "add":
+		return AddBOM, nil
+	}
+	return RemoveBOM, fmt.Errorf("tidyhtml: unknown BOM mode: %q", name)
+}
+
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+var utf8BOM = []byte("\uFEFF")
+
+// hasBOM reports whether the input starts with a UTF-8 or UTF-16 byte
+// order mark.
+func hasBOM(b []byte) bool {
+	return bytes.HasPrefix(b, utf8BOM) || bytes.HasPrefix(b, []byte{0xFF, 0xFE}) || bytes.HasPrefix(b, []byte{0xFE, 0xFF})
+}
+
+// toUTF8 converts the input to UTF-8 from the encoding given by
+// Options.Charset, or else the encoding that is detected from a byte
+// order mark or a <meta> element, as browsers do. Any byte order mark
+// is removed, and bytes that are not valid UTF-8 in input that is in
+// UTF-8 are replaced with U+FFFD, the replacement character, as browsers
+// decode them.
+func toUTF8(b []byte, opts Options) ([]byte, error) {
+	name, err := inputCharset(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	if name == "utf-8" {
+		b = bytes.TrimPrefix(b, utf8BOM)
+		if !utf8.Valid(b) {
+			b = bytes.ToValidUTF8(b, []byte("\uFFFD"))
+		}
+		return b, nil
+	}
+	r, err := charset.NewReaderLabel(name, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	b, err = ioutil.ReadAll(r)
+	return bytes.TrimPrefix(b, utf8BOM), err
+}
+
+// inputCharset returns the name of the encoding of the input, which is
+// given by Options.Charset, or else detected as for detectCharset.
+func inputCharset(b []byte, opts Options) (string, error) {
+	if opts.Charset != "" {
+		_, name := charset.Lookup(opts.Charset)
+		if name == "" {
+			return "", fmt.Errorf("tidyhtml: unknown charset: %q", opts.Charset)
+		}
+		return name, nil
+	}
+	name := detectCharset(b, utf8.Valid(b))
+	opts.debug("detected charset", "charset", name)
+	return name, nil
+}
+
+// detectCharset returns the name of the encoding of input that starts
+// with b, from a byte order mark or a <meta> element in its first 1024
+// bytes. Without either, DetermineEncoding guesses windows-1252 unless
+// there are UTF-8 characters in those bytes, so input that is valid,
+// according to valid, is taken to be UTF-8 instead, as the text after
+// them is most likely to be UTF-8 too.
+func detectCharset(b []byte, valid bool) string {
+	_, name, certain := charset.DetermineEncoding(b, "")
+	if !certain && valid && !declaresCharset(b) {
+		return "utf-8"
+	}
+	return name
+}
+
+// declaresCharset reports whether the first 1024 bytes of b may have a
+// <meta> element that gives the character encoding, which would have to
+// say "charset".
+func declaresCharset(b []byte) bool {
+	if len(b) > 1024 {
+		b = b[:1024]
+	}
+	return bytes.Contains(bytes.ToLower(b), []byte("charset"))
+}
+
+// setMetaCharset makes the first element in the <head> a <meta> element
+// which declares the character encoding as utf-8, so that browsers find it
+// within the first 1024 bytes. The first <meta charset> is moved there, or
+// one is added if there are none, and the others are removed, along with
+// any http-equiv="Content-Type" pragmas.
+func setMetaCharset(doc *html.Node) {
+	head := findElement(doc, atom.Head)
+	if head == nil {
+		return
+	}
+	var meta *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && c.DataAtom == atom.Meta && c.Namespace == "" {
+				if _, ok := attrValue(c, "charset"); ok && meta == nil {
+					meta = c
+					n.RemoveChild(c)
+				} else if ok || isContentTypeMeta(c) {
+					n.RemoveChild(c)
+				}
+			} else {
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(doc)
+	if meta == nil {
+		meta = &html.Node{Type: html.ElementNode, Data: "meta", DataAtom: atom.Meta}
+	}
+	found := false
+	for i, a := range meta.Attr {
+		if a.Key == "charset" && a.Namespace == "" {
+			meta.Attr[i].Val, found = "utf-8", true
+		}
+	}
+	if !found {
+		meta.Attr = append(meta.Attr, html.Attribute{Key: "charset", Val: "utf-8"})
+	}
+	head.InsertBefore(meta, head.FirstChild)
+}
+
+// relabelCharset changes the <meta> elements that declare the character
+// encoding to declare utf-8, for input that was converted to UTF-8 from
+// another encoding, so that the output is not read in the encoding that it
+// was in. When there are none and insert is set, one is added to the
+// <head>, as for setMetaCharset.
+func relabelCharset(doc *html.Node, insert bool) {
+	found := false
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Meta && n.Namespace == "" && relabelMeta(n.Attr) {
+			found = true
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	if !found && insert {
+		setMetaCharset(doc)
+	}
+}
+
+// relabelMeta changes the attributes of a <meta> element that declares
+// the character encoding to declare utf-8, and reports whether it does.
+func relabelMeta(attrs []html.Attribute) bool {
+	contentType := false
+	for _, a := range attrs {
+		if a.Key == "http-equiv" && strings.EqualFold(a.Val, "content-type") {
+			contentType = true
+		}
+	}
+	found := false
+	for i, a := range attrs {
+		switch {
+		case a.Namespace != "":
+		case a.Key == "charset":
+			attrs[i].Val, found = "utf-8", true
+		case a.Key == "content" && contentType:
+			attrs[i].Val, found = "text/html; charset=utf-8", true
+		}
+	}
+	return found
+}
+
+// isContentTypeMeta reports whether a <meta> element
+// is an http-equiv="Content-Type" pragma.
+func isContentTypeMeta(n *html.Node) bool {
+	for _, a := range n.Attr {
+		if a.Key == "http-equiv" && strings.EqualFold(a.Val, "content-type") {
+			return true
+		}
+	}
+	return false
+}
+
+// findElement finds the first element in the tree with the given atom.
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
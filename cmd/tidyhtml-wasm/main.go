@@ -0,0 +1,88 @@
+//go:build js && wasm
+
+// Command tidyhtml-wasm makes tidyhtml available to JavaScript, so that
+// it can be used in browsers and in editors such as VS Code for the web
+// without a native binary. Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o tidyhtml.wasm ./cmd/tidyhtml-wasm
+//
+// and load it with the wasm_exec.js that comes with Go. It sets a global
+// tidyhtml object with a format function:
+//
+//	const result = tidyhtml.format(src, {indent: 2, fragment: true});
+//	if (result.error) throw new Error(result.error);
+//	console.log(result.output);
+//
+// The options have the same keys and values as a config file, as
+// described for tidyhtml.Config, and filepath can be given to choose the
+// template language from the file extension, as the command does.
+// Without options, the output ends with a newline, as it does with the
+// command.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"syscall/js"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+func main() {
+	js.Global().Set("tidyhtml", js.ValueOf(map[string]interface{}{
+		"format": js.FuncOf(format),
+	}))
+	// The functions are only callable while the program is running.
+	select {}
+}
+
+// format is tidyhtml.format(src, options) in JavaScript.
+func format(this js.Value, args []js.Value) interface{} {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return result("", "tidyhtml: format expects a string of HTML")
+	}
+	src := args[0].String()
+	opts := tidyhtml.Options{FinalNewline: true}
+	if len(args) > 1 && args[1].Truthy() {
+		var err error
+		if opts, err = options(args[1], opts); err != nil {
+			return result("", err.Error())
+		}
+	}
+	out := bytes.Buffer{}
+	out.Grow(len(src) + len(src)/8)
+	if err := tidyhtml.CopyWithOptions(&out, strings.NewReader(src), opts); err != nil {
+		return result("", err.Error())
+	}
+	return result(out.String(), "")
+}
+
+// options returns the options given to format from JavaScript, applied to
+// opts. They go through JSON, so that they are checked in the same way as
+// a config file.
+func options(v js.Value, opts tidyhtml.Options) (tidyhtml.Options, error) {
+	var values map[string]interface{}
+	s := js.Global().Get("JSON").Call("stringify", v).String()
+	if err := json.Unmarshal([]byte(s), &values); err != nil {
+		return opts, err
+	}
+	path, _ := values["filepath"].(string)
+	delete(values, "filepath")
+	c, err := tidyhtml.ConfigFromValues(values)
+	if err != nil {
+		return opts, err
+	}
+	opts = c.Apply(opts)
+	if path != "" && !c.Set["template"] {
+		opts.Template = tidyhtml.TemplateForFile(path)
+	}
+	return opts, nil
+}
+
+func result(output, err string) js.Value {
+	if err != "" {
+		return js.ValueOf(map[string]interface{}{"error": err})
+	}
+	return js.ValueOf(map[string]interface{}{"output": output})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/raymondbutcher/tidyhtml"
+	"golang.org/x/net/html"
+)
+
+var astFlag = flag.Bool("ast", false,
+	"print the parsed tree of each input as indented JSON instead of\n"+
+		"tidying it")
+
+// astNode is the JSON form of an html.Node. The text is the content of
+// text and comment nodes, and the name of a doctype.
+type astNode struct {
+	Type      string     `json:"type"`
+	Tag       string     `json:"tag,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	Attrs     []astAttr  `json:"attrs,omitempty"`
+	Text      string     `json:"text,omitempty"`
+	Children  []*astNode `json:"children,omitempty"`
+}
+
+type astAttr struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+}
+
+var astNodeTypes = map[html.NodeType]string{
+	html.ErrorNode:    "error",
+	html.TextNode:     "text",
+	html.DocumentNode: "document",
+	html.ElementNode:  "element",
+	html.CommentNode:  "comment",
+	html.DoctypeNode:  "doctype",
+	html.RawNode:      "raw",
+}
+
+// astInput writes the parsed tree of the input to w as JSON.
+func astInput(w io.Writer, name, path string, in []byte) (fileStats, error) {
+	fs := fileStats{Path: name, BytesIn: len(in)}
+	in, _, err := decompress(in)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	opts, err := options(path)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	doc, err := tidyhtml.Parse(bytes.NewReader(in), opts)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	out, err := json.MarshalIndent(toAST(doc), "", "  ")
+	if err != nil {
+		return fs, err
+	}
+	out = append(out, '\n')
+	fs.BytesOut = len(out)
+	_, err = w.Write(out)
+	return fs, err
+}
+
+// toAST converts a node and its descendants to their JSON form.
+func toAST(n *html.Node) *astNode {
+	a := &astNode{Type: astNodeTypes[n.Type]}
+	switch n.Type {
+	case html.ElementNode:
+		a.Tag, a.Namespace = n.Data, n.Namespace
+	case html.TextNode, html.CommentNode, html.DoctypeNode, html.RawNode:
+		a.Text = n.Data
+	}
+	for _, attr := range n.Attr {
+		a.Attrs = append(a.Attrs, astAttr{attr.Namespace, attr.Key, attr.Val})
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		a.Children = append(a.Children, toAST(c))
+	}
+	return a
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+func TestToAST(t *testing.T) {
+	doc, err := tidyhtml.Parse(strings.NewReader(`<p class="a">Hi <!--c--></p>`), tidyhtml.Options{Fragment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(toAST(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type":"document","children":[{"type":"element","tag":"p","attrs":[{"name":"class","value":"a"}],` +
+		`"children":[{"type":"text","text":"Hi "},{"type":"comment","text":"c"}]}]}`
+	if string(b) != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, b)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedFlag is the git revision to look for changes since, which can
+// be given as -changed=REF, or as just -changed to use HEAD.
+type changedFlag string
+
+func (c *changedFlag) String() string { return string(*c) }
+
+func (c *changedFlag) IsBoolFlag() bool { return true }
+
+func (c *changedFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*c = "HEAD"
+	case "false":
+		*c = ""
+	default:
+		*c = changedFlag(value)
+	}
+	return nil
+}
+
+var changedSince changedFlag
+
+func init() {
+	flag.Var(&changedSince, "changed",
+		"only tidy files that git reports as added or modified since HEAD,\n"+
+			"or since the revision given with -changed=REF, and new files that\n"+
+			"are not ignored")
+}
+
+// changedFiles and changedDirs hold the absolute paths of the files found
+// by -changed, and of the directories that contain them. They are nil
+// without -changed.
+var changedFiles, changedDirs map[string]bool
+
+// findChanged asks git for the files that -changed is about, in the
+// repository that contains the path.
+func findChanged(path string) error {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	git := func(args ...string) (string, error) { return runGit(dir, args...) }
+	top, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	modified, err := git("diff", "--name-only", "-z", "--diff-filter=ACMR", string(changedSince), "--")
+	if err != nil {
+		return err
+	}
+	untracked, err := git("ls-files", "--others", "--exclude-standard", "--full-name", "-z")
+	if err != nil {
+		return err
+	}
+	root := canonicalPath(strings.TrimSpace(top))
+	changedFiles, changedDirs = map[string]bool{}, map[string]bool{}
+	for _, name := range strings.Split(modified+untracked, "\x00") {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(name))
+		changedFiles[path] = true
+		for dir := filepath.Dir(path); !changedDirs[dir]; dir = filepath.Dir(dir) {
+			changedDirs[dir] = true
+		}
+	}
+	return nil
+}
+
+// isChanged reports whether a file or directory was found by -changed,
+// or contains files that were, or if -changed is not being used.
+func isChanged(path string, dir bool) bool {
+	if changedFiles == nil {
+		return true
+	}
+	path = canonicalPath(path)
+	if dir {
+		return changedDirs[path]
+	}
+	return changedFiles[path]
+}
+
+// canonicalPath returns the absolute path with any symbolic links
+// resolved, or as close to that as it can, so that paths from git and
+// from the arguments can be compared.
+func canonicalPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
+
+// runGit runs git in a directory with the arguments, and returns what it
+// writes to stdout.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && stderr.Len() != 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"unicode/utf8"
+
+	"github.com/raymondbutcher/tidyhtml/internal/diff"
+)
+
+var colorFlag = flag.String("color", "auto",
+	"when to color diffs: auto, always or never\n"+
+		"(auto uses color for terminals, unless NO_COLOR is set)")
+
+// ANSI escape codes for the colors used in diffs.
+const (
+	colorReset   = "\x1b[0m"
+	colorBold    = "\x1b[1m"
+	colorReverse = "\x1b[7m"
+	colorNormal  = "\x1b[27m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorCyan    = "\x1b[36m"
+)
+
+// useColor reports whether diffs should be colored, based on -color,
+// the NO_COLOR environment variable, and whether stdout is a terminal.
+func useColor() (bool, error) {
+	switch *colorFlag {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("-color must be auto, always or never: %q", *colorFlag)
+}
+
+// Whether to color diffs, which is set by main.
+var colorDiffs bool
+
+// colorDiff colors a unified diff from diff.Unified. Deleted lines are red
+// and inserted lines are green. When deleted lines are followed by the same
+// number of inserted lines, the part of each line that changed is
+// highlighted, and whitespace within it is made visible, because changes
+// from tidying are often only to whitespace.
+func colorDiff(d []byte) []byte {
+	lines := diff.SplitLines(d)
+	buf := bytes.Buffer{}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case i < 2:
+			writeColorLine(&buf, colorBold, line)
+		case line[0] == '@':
+			writeColorLine(&buf, colorCyan, line)
+		case line[0] == '-':
+			// Find the run of deleted lines and the inserted lines
+			// after it, skipping the "\ No newline" lines between them.
+			var del, ins []int
+			j := i
+			for ; j < len(lines) && (lines[j][0] == '-' || lines[j][0] == '\\'); j++ {
+				if lines[j][0] == '-' {
+					del = append(del, j)
+				}
+			}
+			for ; j < len(lines) && (lines[j][0] == '+' || lines[j][0] == '\\'); j++ {
+				if lines[j][0] == '+' {
+					ins = append(ins, j)
+				}
+			}
+			pairs := map[int]int{}
+			if len(del) == len(ins) {
+				for k := range del {
+					pairs[del[k]] = ins[k]
+					pairs[ins[k]] = del[k]
+				}
+			}
+			for ; i < j; i++ {
+				line := lines[i]
+				color := colorRed
+				if line[0] == '+' {
+					color = colorGreen
+				}
+				if other, ok := pairs[i]; ok {
+					writeChangedLine(&buf, color, line, lines[other])
+				} else if line[0] == '\\' {
+					buf.Write(line)
+				} else {
+					writeColorLine(&buf, color, line)
+				}
+			}
+			continue
+		case line[0] == '+':
+			writeColorLine(&buf, colorGreen, line)
+		default:
+			buf.Write(line)
+		}
+		i++
+	}
+	return buf.Bytes()
+}
+
+func writeColorLine(buf *bytes.Buffer, color string, line []byte) {
+	buf.WriteString(color)
+	buf.Write(bytes.TrimSuffix(line, []byte("\n")))
+	buf.WriteString(colorReset)
+	buf.WriteByte('\n')
+}
+
+// writeChangedLine writes a line of a diff, highlighting the part of
+// it that is different from the other line.
+func writeChangedLine(buf *bytes.Buffer, color string, line, other []byte) {
+	a := bytes.TrimSuffix(line[1:], []byte("\n"))
+	b := bytes.TrimSuffix(other[1:], []byte("\n"))
+
+	// Find the common prefix and suffix, without splitting any runes.
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	for p > 0 && p < len(a) && !utf8.RuneStart(a[p]) {
+		p--
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+	for s > 0 && !utf8.RuneStart(a[len(a)-s]) {
+		s--
+	}
+
+	buf.WriteString(color)
+	buf.WriteByte(line[0])
+	buf.Write(a[:p])
+	if changed := a[p : len(a)-s]; len(changed) != 0 {
+		buf.WriteString(colorReverse)
+		buf.Write(visibleSpace(changed))
+		buf.WriteString(colorNormal)
+	}
+	buf.Write(a[len(a)-s:])
+	buf.WriteString(colorReset)
+	buf.WriteByte('\n')
+}
+
+// visibleSpace replaces spaces and tabs with visible characters.
+func visibleSpace(b []byte) []byte {
+	b = bytes.Replace(b, []byte(" "), []byte("·"), -1)
+	return bytes.Replace(b, []byte("\t"), []byte("→"), -1)
+}
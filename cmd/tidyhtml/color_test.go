@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestColorDiff(t *testing.T) {
+	diff := []byte("--- a\n+++ b\n@@ -1,3 +1,2 @@\n <html>\n-<p>a</p>\n+    <p>a</p>\n-x\n")
+	want := "\x1b[1m--- a\x1b[0m\n" +
+		"\x1b[1m+++ b\x1b[0m\n" +
+		"\x1b[36m@@ -1,3 +1,2 @@\x1b[0m\n" +
+		" <html>\n" +
+		"\x1b[31m-<p>a</p>\x1b[0m\n" +
+		"\x1b[32m+\x1b[7m····\x1b[27m<p>a</p>\x1b[0m\n" +
+		"\x1b[31m-x\x1b[0m\n"
+	if got := string(colorDiff(diff)); got != want {
+		t.Errorf("Expected:\n%q\nGot:\n%q", want, got)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+// shells are the shells that the completion subcommand supports, with
+// the functions that write their scripts.
+var shells = map[string]func(w io.Writer, flags []completionFlag, commands []string){
+	"bash":       bashCompletion,
+	"zsh":        zshCompletion,
+	"fish":       fishCompletion,
+	"powershell": powershellCompletion,
+}
+
+// flagValues are the values to complete for the flags that only accept
+// some values. Other flags that take a value complete file names.
+var flagValues = map[string][]string{
+	"bom":          {"remove", "keep", "add"},
+	"color":        {"auto", "always", "never"},
+	"format":       {"text", "json", "github", "sarif"},
+	"self-closing": {"none", "always-void", "preserve-input"},
+	"template": {
+		"none", "jinja", "handlebars", "erb", "php", "go", "templ",
+		"markdown", "vue", "svelte",
+	},
+}
+
+// completionFlag is a flag as described to the shells.
+type completionFlag struct {
+	name        string
+	description string
+	takesValue  bool
+	values      []string
+}
+
+// completionFlags returns the flags, in order of their names.
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	flag.VisitAll(func(f *flag.Flag) {
+		description := strings.Join(strings.Fields(f.Usage), " ")
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		values := flagValues[f.Name]
+		if f.Name == "profile" {
+			values = tidyhtml.ProfileNames()
+		}
+		flags = append(flags, completionFlag{f.Name, description, !ok || !b.IsBoolFlag(), values})
+	})
+	return flags
+}
+
+// completionCommands returns the names of the subcommands, sorted.
+func completionCommands() []string {
+	commands := []string{"completion", "lsp"}
+	for name := range subcommands {
+		commands = append(commands, name)
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// runCompletion writes the completion script for a shell to w.
+func runCompletion(w io.Writer, args []string) int {
+	if len(args) != 1 || shells[args[0]] == nil {
+		fmt.Fprintf(os.Stderr, "usage: tidyhtml completion bash|zsh|fish|powershell\n")
+		return exitUsage
+	}
+	shells[args[0]](w, completionFlags(), completionCommands())
+	return exitOK
+}
+
+func bashCompletion(w io.Writer, flags []completionFlag, commands []string) {
+	fmt.Fprintf(w, "# bash completion for tidyhtml. Add this to ~/.bashrc:\n")
+	fmt.Fprintf(w, "#   source <(tidyhtml completion bash)\n")
+	fmt.Fprintf(w, "_tidyhtml() {\n")
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	fmt.Fprintf(w, "    if [[ $COMP_CWORD -eq 2 && $prev == completion ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"bash zsh fish powershell\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    case \"$prev\" in\n")
+	var files []string
+	for _, f := range flags {
+		switch {
+		case len(f.values) != 0:
+			fmt.Fprintf(w, "    -%s|--%s)\n", f.name, f.name)
+			fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(f.values, " "))
+			fmt.Fprintf(w, "        return\n")
+			fmt.Fprintf(w, "        ;;\n")
+		case f.takesValue:
+			files = append(files, "-"+f.name, "--"+f.name)
+		}
+	}
+	if len(files) != 0 {
+		fmt.Fprintf(w, "    %s)\n", strings.Join(files, "|"))
+		fmt.Fprintf(w, "        COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+		fmt.Fprintf(w, "        return\n")
+		fmt.Fprintf(w, "        ;;\n")
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    if [[ $cur == -* ]]; then\n")
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.name
+	}
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+	fmt.Fprintf(w, "    if [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY+=($(compgen -W %q -- \"$cur\"))\n", strings.Join(commands, " "))
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F _tidyhtml tidyhtml\n")
+}
+
+func zshCompletion(w io.Writer, flags []completionFlag, commands []string) {
+	escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace
+	fmt.Fprintf(w, "#compdef tidyhtml\n")
+	fmt.Fprintf(w, "# zsh completion for tidyhtml. Save this as _tidyhtml in a directory\n")
+	fmt.Fprintf(w, "# in $fpath, or add this to ~/.zshrc after compinit:\n")
+	fmt.Fprintf(w, "#   source <(tidyhtml completion zsh)\n")
+	fmt.Fprintf(w, "_tidyhtml() {\n")
+	fmt.Fprintf(w, "    local state\n")
+	fmt.Fprintf(w, "    _arguments -S \\\n")
+	for _, f := range flags {
+		spec := "-" + f.name + "[" + escape(f.description) + "]"
+		switch {
+		case len(f.values) != 0:
+			spec += ":" + f.name + ":(" + strings.Join(f.values, " ") + ")"
+		case f.takesValue:
+			spec += ":" + f.name + ":_files"
+		}
+		fmt.Fprintf(w, "        '%s' \\\n", spec)
+	}
+	fmt.Fprintf(w, "        '*:: :->args'\n")
+	fmt.Fprintf(w, "    if [[ $state == args ]]; then\n")
+	fmt.Fprintf(w, "        if [[ $words[1] == completion ]]; then\n")
+	fmt.Fprintf(w, "            _values shell bash zsh fish powershell\n")
+	fmt.Fprintf(w, "        elif (( CURRENT == 1 )); then\n")
+	fmt.Fprintf(w, "            _alternative 'commands:command:(%s)' 'files:file:_files'\n", strings.Join(commands, " "))
+	fmt.Fprintf(w, "        else\n")
+	fmt.Fprintf(w, "            _files\n")
+	fmt.Fprintf(w, "        fi\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "compdef _tidyhtml tidyhtml\n")
+}
+
+func fishCompletion(w io.Writer, flags []completionFlag, commands []string) {
+	quote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	}
+	fmt.Fprintf(w, "# fish completion for tidyhtml. Save this as\n")
+	fmt.Fprintf(w, "# ~/.config/fish/completions/tidyhtml.fish\n")
+	fmt.Fprintf(w, "complete -c tidyhtml -n __fish_use_subcommand -a %s\n", quote(strings.Join(commands, " ")))
+	fmt.Fprintf(w, "complete -c tidyhtml -n '__fish_seen_subcommand_from completion' -f -a 'bash zsh fish powershell'\n")
+	for _, f := range flags {
+		line := "complete -c tidyhtml -o " + f.name + " -d " + quote(f.description)
+		switch {
+		case len(f.values) != 0:
+			line += " -x -a " + quote(strings.Join(f.values, " "))
+		case f.takesValue:
+			line += " -r"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func powershellCompletion(w io.Writer, flags []completionFlag, commands []string) {
+	list := func(items []string) string {
+		quoted := make([]string, len(items))
+		for i, s := range items {
+			quoted[i] = "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		}
+		return "@(" + strings.Join(quoted, ", ") + ")"
+	}
+	var names []string
+	for _, f := range flags {
+		names = append(names, "-"+f.name)
+	}
+	fmt.Fprintf(w, "# PowerShell completion for tidyhtml. Add this to $PROFILE:\n")
+	fmt.Fprintf(w, "#   tidyhtml completion powershell | Out-String | Invoke-Expression\n")
+	fmt.Fprintf(w, "Register-ArgumentCompleter -Native -CommandName tidyhtml -ScriptBlock {\n")
+	fmt.Fprintf(w, "    param($wordToComplete, $commandAst, $cursorPosition)\n")
+	fmt.Fprintf(w, "    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })\n")
+	fmt.Fprintf(w, "    $n = $words.Count\n")
+	fmt.Fprintf(w, "    if ($wordToComplete -ne '') { $n-- }\n")
+	fmt.Fprintf(w, "    $prev = if ($n -gt 0) { $words[$n - 1] } else { '' }\n")
+	fmt.Fprintf(w, "    $values = @{\n")
+	for _, f := range flags {
+		if len(f.values) != 0 {
+			fmt.Fprintf(w, "        '-%s' = %s\n", f.name, list(f.values))
+		}
+	}
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "    $candidates = if ($prev -eq 'completion' -and $n -eq 2) {\n")
+	fmt.Fprintf(w, "        @('bash', 'zsh', 'fish', 'powershell')\n")
+	fmt.Fprintf(w, "    } elseif ($values.ContainsKey($prev)) {\n")
+	fmt.Fprintf(w, "        $values[$prev]\n")
+	fmt.Fprintf(w, "    } elseif ($wordToComplete -like '-*') {\n")
+	fmt.Fprintf(w, "        %s\n", list(names))
+	fmt.Fprintf(w, "    } elseif ($n -eq 1) {\n")
+	fmt.Fprintf(w, "        %s\n", list(commands))
+	fmt.Fprintf(w, "    } else {\n")
+	fmt.Fprintf(w, "        @()\n")
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "    $candidates | Where-Object { $_ -like \"$wordToComplete*\" } | ForEach-Object {\n")
+	fmt.Fprintf(w, "        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)\n")
+	fmt.Fprintf(w, "    }\n")
+	fmt.Fprintf(w, "}\n")
+}
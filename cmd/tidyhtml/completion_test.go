@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompletion(t *testing.T) {
+	for shell := range shells {
+		out := bytes.Buffer{}
+		if status := runCompletion(&out, []string{shell}); status != exitOK {
+			t.Fatalf("%s: expected exit status %d, got %d", shell, exitOK, status)
+		}
+		for _, want := range []string{"tidyhtml", "stats", "check", "prettier", "svelte"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s: expected the script to contain %q", shell, want)
+			}
+		}
+	}
+	if status := runCompletion(&bytes.Buffer{}, []string{"csh"}); status != exitUsage {
+		t.Errorf("Expected exit status %d for an unknown shell, got %d", exitUsage, status)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"flag"
+	"io"
+	"io/ioutil"
+)
+
+var noDecompressFlag = flag.Bool("no-decompress", false,
+	"do not decompress gzip and deflate input")
+
+type compression int
+
+const (
+	notCompressed compression = iota
+	gzipCompressed
+	zlibCompressed
+)
+
+// detectCompression looks for the magic bytes at the start of gzip data,
+// or the header of zlib data, which is what HTTP calls deflate.
+func detectCompression(b []byte) compression {
+	if *noDecompressFlag || len(b) < 2 {
+		return notCompressed
+	}
+	if b[0] == 0x1f && b[1] == 0x8b {
+		return gzipCompressed
+	}
+	// The compression method is 8, and the two bytes of the header
+	// are a multiple of 31 as a checksum.
+	if b[0]&0x0f == 8 && b[0]>>4 <= 7 && (int(b[0])<<8|int(b[1]))%31 == 0 {
+		return zlibCompressed
+	}
+	return notCompressed
+}
+
+// decompress returns the decompressed input, if it is compressed,
+// and the kind of compression that was used.
+func decompress(b []byte) ([]byte, compression, error) {
+	c := detectCompression(b)
+	var r io.ReadCloser
+	var err error
+	switch c {
+	case gzipCompressed:
+		r, err = gzip.NewReader(bytes.NewReader(b))
+	case zlibCompressed:
+		r, err = zlib.NewReader(bytes.NewReader(b))
+	default:
+		return b, c, nil
+	}
+	var out []byte
+	if err == nil {
+		defer r.Close()
+		out, err = ioutil.ReadAll(r)
+	}
+	if err != nil {
+		if c == zlibCompressed {
+			// The zlib header is short enough to be found at the
+			// start of some text, so fall back to using it as is.
+			return b, notCompressed, nil
+		}
+		return nil, c, err
+	}
+	return out, c, nil
+}
+
+// compress compresses the output in the same way as the input was.
+func compress(b []byte, c compression) ([]byte, error) {
+	buf := bytes.Buffer{}
+	var w io.WriteCloser
+	switch c {
+	case gzipCompressed:
+		w = gzip.NewWriter(&buf)
+	case zlibCompressed:
+		w = zlib.NewWriter(&buf)
+	default:
+		return b, nil
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
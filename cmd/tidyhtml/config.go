@@ -0,0 +1,325 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+var (
+	profileFlag = flag.String("profile", "",
+		"a preset bundle of options: "+strings.Join(tidyhtml.ProfileNames(), ", "))
+	indentFlag = flag.String("indent", "",
+		"number of spaces to indent by, or \"tab\" (default 4)")
+	fragmentFlag = flag.Bool("fragment", false,
+		"treat the input as a fragment, without adding html, head and body")
+	contextFlag = flag.String("context", "",
+		"the element that fragments are parsed within, such as div,\n"+
+			"tbody or head (default body; implies -fragment)")
+	preserveStructureFlag = flag.Bool("preserve-structure", false,
+		"leave out the html, head, body and tbody elements that are\n"+
+			"implied by the input rather than written in it")
+	charsetFlag = flag.String("charset", "",
+		"the character encoding of the input (default: detected from\n"+
+			"a byte order mark or a meta element, or else utf-8)")
+	metaCharsetFlag = flag.Bool("meta-charset", false,
+		"make sure there is one meta charset element, saying utf-8, at the\n"+
+			"start of the head, and remove http-equiv Content-Type ones")
+	organizeHeadFlag = flag.Bool("organize-head", false,
+		"put the elements in the head in a conventional order, and remove\n"+
+			"duplicate meta and link elements")
+	ampFlag = flag.Bool("amp", false,
+		"keep the boilerplate styles of AMP pages exactly as they are, and\n"+
+			"write attributes such as ⚡ without a value")
+	namespacePrefixesFlag = flag.Bool("namespace-prefixes", false,
+		"treat elements with a namespace prefix, such as <v:rect>, as XML\n"+
+			"elements that can be self-closing")
+	minifyFlag = flag.Bool("minify", false,
+		"make the output as small as possible instead of tidying it")
+	collapseFlag = flag.Bool("collapse", false,
+		"remove the whitespace that does not affect rendering, but keep\n"+
+			"block elements on their own lines")
+	blankLineBeforeFlag = flag.String("blank-line-before", "",
+		"a CSS selector for elements to put a blank line before, such as\n"+
+			"'h2, section'")
+	blankLineAfterFlag = flag.String("blank-line-after", "",
+		"a CSS selector for elements to put a blank line after, such as head")
+	escapeNBSPFlag = flag.Bool("escape-nbsp", false,
+		"write non-breaking spaces in text as &nbsp;")
+	nfcFlag = flag.Bool("nfc", false,
+		"put text and attribute values into Unicode Normalization Form C,\n"+
+			"so that characters such as é are always written the same way")
+	sortAttributesFlag = flag.Bool("sort-attributes", false,
+		"write the attributes of each element in the order of their names")
+	breakAfterBRFlag = flag.Bool("break-after-br", false,
+		"put the text after each <br> on a new line")
+	compactTableWidthFlag = flag.Int("compact-table-width", 0,
+		"write each table row on a single line with its cells when the line\n"+
+			"is no longer than this (default 0, which never does)")
+	wrapAttrWidthFlag = flag.Int("wrap-attr-width", 0,
+		"break the values of list attributes such as class and srcset onto\n"+
+			"continuation lines where a start tag would be wider than this\n"+
+			"(default 0, which never does)")
+	maxDepthFlag = flag.Int("max-depth", 0,
+		"stop with an error when elements are nested more deeply than this\n"+
+			"(default 0, which has no limit)")
+	safeWhitespaceFlag = flag.Bool("safe-whitespace", false,
+		"only change whitespace where it cannot be seen, keeping inline\n"+
+			"elements that are next to each other on the same line")
+	omitEndTagsFlag = flag.Bool("omit-end-tags", false,
+		"leave out optional end tags such as </li>, </p> and </td>")
+	selfClosingFlag = flag.String("self-closing", "",
+		"whether void elements are written with a slash, as in <br />:\n"+
+			"none, always-void or preserve-input (default none)")
+	renameFlag = flag.String("rename", "",
+		"replace elements with others, as from=to pairs such as b=strong,\n"+
+			"or \"obsolete\" for the modern equivalents of obsolete elements")
+	elementFormatsFlag = flag.String("element-formats", "",
+		"override how elements are written, as name=format pairs such as\n"+
+			"x-icon=inline, where the format is inline, block, verbatim, pre\n"+
+			"or compact")
+	sanitizeFlag = flag.Bool("sanitize", false,
+		"remove scripts, iframes, event handler attributes and\n"+
+			"javascript: URLs, so that the output is safe to embed")
+	removeEmptyFlag = flag.Bool("remove-empty", false,
+		"remove elements without attributes or content, such as <span></span>")
+	removeEmptySelectorFlag = flag.String("remove-empty-selector", "",
+		"a CSS selector for empty elements to remove even though they have\n"+
+			"attributes, such as div.clear (implies -remove-empty)")
+	onlySelectorFlag = flag.String("only-selector", "",
+		"a CSS selector for the elements to tidy, such as '#content',\n"+
+			"leaving the rest of each file exactly as it was")
+	excludeSelectorFlag = flag.String("exclude-selector", "",
+		"a CSS selector for elements to leave exactly as they were, such as\n"+
+			"'.ProseMirror', while the rest of each file is tidied")
+	tidyAttrFlag = flag.String("tidy-attr", "",
+		"the attribute which, set to off, leaves an element exactly as it\n"+
+			"was, or - for none (default data-tidy)")
+	srcdocFlag = flag.Bool("srcdoc", false,
+		"tidy the HTML documents in the srcdoc attributes of iframes")
+	controlCharsFlag = flag.String("control-chars", "",
+		"what to do with control characters such as NUL in text and\n"+
+			"attribute values: keep, remove or escape (default keep)")
+	bomFlag = flag.String("bom", "",
+		"whether to write a byte order mark: remove, keep or add\n"+
+			"(default remove)")
+)
+
+var (
+	sanitizeElementsFlag listFlag
+	verbatimElementsFlag listFlag
+)
+
+func init() {
+	flag.Var(&sanitizeElementsFlag, "sanitize-elements",
+		"the elements that -sanitize removes, comma separated\n"+
+			"(default "+strings.Join(tidyhtml.DefaultSanitizeElements, ",")+")")
+	flag.Var(&verbatimElementsFlag, "verbatim-elements",
+		"elements to leave exactly as they were, comma separated, such as svg,math")
+}
+
+// The config files found for each directory, including nil
+// for directories without any config file.
+var (
+	configs   = map[string]*tidyhtml.Config{}
+	configsMu sync.Mutex
+)
+
+// findConfig returns the config for a file, or nil if there is none.
+// An empty path means stdin, which uses the config for the current
+// directory.
+func findConfig(path string) (*tidyhtml.Config, error) {
+	dir := "."
+	if path != "" {
+		dir = filepath.Dir(path)
+	}
+	configsMu.Lock()
+	defer configsMu.Unlock()
+	if c, ok := configs[dir]; ok {
+		return c, nil
+	}
+	c, err := tidyhtml.FindConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	configs[dir] = c
+	return c, nil
+}
+
+// configRel returns a path relative to the directory of a config file.
+func configRel(c *tidyhtml.Config, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(filepath.Dir(c.Path), abs)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// options returns the tidyhtml options to use for a path. They come from
+// the .editorconfig files for the path, then its config file, and then the
+// flags. The -profile flag is applied before the other flags. If neither
+// the config file nor the flags set the template language, it is chosen by
+// the file extension.
+func options(path string) (tidyhtml.Options, error) {
+	return optionsFrom(path, tidyhtml.Options{FinalNewline: true})
+}
+
+// optionsFrom is like options, but it starts from opts instead of the
+// defaults, such as the ones that an editor asks for, which the config
+// files and the flags can then override.
+func optionsFrom(path string, opts tidyhtml.Options) (tidyhtml.Options, error) {
+	c, err := findConfig(path)
+	if err != nil {
+		return opts, err
+	}
+	if path != "" {
+		if opts, err = tidyhtml.EditorConfigOptions(path, opts); err != nil {
+			return opts, err
+		}
+	}
+	if c != nil {
+		opts = c.Apply(opts)
+	}
+	if (c == nil || !c.Set["template"]) && path != "" {
+		opts.Template = tidyhtml.TemplateForFile(path)
+	}
+
+	if *profileFlag != "" {
+		if opts, err = tidyhtml.ApplyProfile(*profileFlag, opts); err != nil {
+			return opts, err
+		}
+	}
+	if *templateFlag != "" {
+		if opts.Template, err = tidyhtml.ParseTemplateMode(*templateFlag); err != nil {
+			return opts, err
+		}
+	}
+	if *indentFlag != "" {
+		if opts.Indent, err = tidyhtml.ParseIndent(*indentFlag); err != nil {
+			return opts, err
+		}
+	}
+	if *fragmentFlag {
+		opts.Fragment = true
+	}
+	if *contextFlag != "" {
+		opts.Fragment, opts.Context = true, *contextFlag
+	}
+	if *preserveStructureFlag {
+		opts.PreserveStructure = true
+	}
+	if *charsetFlag != "" {
+		opts.Charset = *charsetFlag
+	}
+	if *metaCharsetFlag {
+		opts.MetaCharset = true
+	}
+	if *organizeHeadFlag {
+		opts.OrganizeHead = true
+	}
+	if *ampFlag {
+		opts.AMP = true
+	}
+	if *namespacePrefixesFlag {
+		opts.NamespacePrefixes = true
+	}
+	if *minifyFlag {
+		opts.Minify = true
+	}
+	if *collapseFlag {
+		opts.CollapseWhitespace = true
+	}
+	if *blankLineBeforeFlag != "" {
+		opts.BlankLineBefore = *blankLineBeforeFlag
+	}
+	if *blankLineAfterFlag != "" {
+		opts.BlankLineAfter = *blankLineAfterFlag
+	}
+	if *escapeNBSPFlag {
+		opts.EscapeNBSP = true
+	}
+	if *nfcFlag {
+		opts.NFC = true
+	}
+	if *sortAttributesFlag {
+		opts.SortAttributes = true
+	}
+	if *breakAfterBRFlag {
+		opts.BreakAfterBR = true
+	}
+	if *compactTableWidthFlag > 0 {
+		opts.CompactTableWidth = *compactTableWidthFlag
+	}
+	if *wrapAttrWidthFlag > 0 {
+		opts.WrapAttrWidth = *wrapAttrWidthFlag
+	}
+	if *maxDepthFlag > 0 {
+		opts.MaxDepth = *maxDepthFlag
+	}
+	if *safeWhitespaceFlag {
+		opts.SafeWhitespace = true
+	}
+	if *omitEndTagsFlag {
+		opts.OmitEndTags = true
+	}
+	if *selfClosingFlag != "" {
+		if opts.SelfClosing, err = tidyhtml.ParseSelfClosingStyle(*selfClosingFlag); err != nil {
+			return opts, err
+		}
+	}
+	if *renameFlag != "" {
+		if opts.RenameElements, err = tidyhtml.ParseRenames(*renameFlag); err != nil {
+			return opts, err
+		}
+	}
+	if *elementFormatsFlag != "" {
+		if opts.ElementFormats, err = tidyhtml.ParseElementFormats(*elementFormatsFlag); err != nil {
+			return opts, err
+		}
+	}
+	if *sanitizeFlag {
+		opts.Sanitize = true
+	}
+	if len(sanitizeElementsFlag) != 0 {
+		opts.SanitizeElements = sanitizeElementsFlag
+	}
+	if *removeEmptyFlag {
+		opts.RemoveEmpty = true
+	}
+	if *removeEmptySelectorFlag != "" {
+		opts.RemoveEmpty, opts.RemoveEmptySelector = true, *removeEmptySelectorFlag
+	}
+	if *onlySelectorFlag != "" {
+		opts.OnlySelector = *onlySelectorFlag
+	}
+	if *excludeSelectorFlag != "" {
+		opts.ExcludeSelector = *excludeSelectorFlag
+	}
+	if len(verbatimElementsFlag) != 0 {
+		opts.VerbatimElements = verbatimElementsFlag
+	}
+	if *tidyAttrFlag != "" {
+		opts.TidyAttr = *tidyAttrFlag
+	}
+	if *srcdocFlag {
+		opts.TidySrcdoc = true
+	}
+	if *controlCharsFlag != "" {
+		if opts.ControlChars, err = tidyhtml.ParseControlChars(*controlCharsFlag); err != nil {
+			return opts, err
+		}
+	}
+	if *bomFlag != "" {
+		if opts.BOM, err = tidyhtml.ParseBOMMode(*bomFlag); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
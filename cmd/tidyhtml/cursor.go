@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+var cursorOffsetFlag = flag.Int("cursor-offset", -1,
+	"with standard input, print the byte offset in the output that the\n"+
+		"given offset in the input moves to, to stderr, as for the cursor\n"+
+		"in an editor")
+
+// tidyWithCursor tidies HTML from src and writes it to dst, and prints
+// where -cursor-offset moves to in the output.
+func tidyWithCursor(dst io.Writer, src io.Reader, opts tidyhtml.Options) error {
+	in, err := ioutil.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	out, offsets, err := tidyhtml.FormatWithOffsets(in, opts, []int{*cursorOffsetFlag})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, offsets[0])
+	_, err = dst.Write(out)
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	userAgentFlag = flag.String("user-agent", "tidyhtml",
+		"the User-Agent header to send when fetching URLs")
+	timeoutFlag = flag.Duration("timeout", 30*time.Second,
+		"the time limit for fetching each URL")
+)
+
+// isURL reports whether a path argument is a URL to fetch.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// processURL fetches a page and tidies it.
+func processURL(w io.Writer, url string) (fileStats, error) {
+	in, err := fetch(url)
+	if err != nil {
+		return fileStats{Path: url}, err
+	}
+	return processInput(w, url, "", in)
+}
+
+// fetch returns the body of a page.
+func fetch(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", *userAgentFlag)
+
+	client := http.Client{Timeout: *timeoutFlag}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var (
+	filesFromFlag = flag.String("files-from", "",
+		"also tidy the paths listed in this file, one on each line,\n"+
+			"or read the list from stdin if it is -")
+	nulFlag = flag.Bool("0", false,
+		"with -files-from, the paths are separated by NUL characters\n"+
+			"instead, as from find -print0 or git ls-files -z")
+)
+
+// readFileList reads the list of paths for -files-from. Blank lines are
+// skipped, as are the carriage returns at the end of lines.
+func readFileList(name string, nul bool) ([]string, error) {
+	var b []byte
+	var err error
+	if name == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sep := []byte("\n")
+	if nul {
+		sep = []byte{0}
+	}
+	var paths []string
+	for _, p := range bytes.Split(b, sep) {
+		path := string(p)
+		if !nul {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
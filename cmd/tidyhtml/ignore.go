@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var noIgnoreFlag = flag.Bool("no-ignore", false,
+	"do not skip the files listed in "+ignoreFileName+" files")
+
+// ignoreFileName is the name of the files that list paths to skip when
+// walking directories. Each line is a glob pattern, in the same format as
+// .gitignore files:
+//
+//   - blank lines and lines starting with # are ignored
+//   - a pattern ending with a slash only matches directories
+//   - a pattern containing any other slash is matched against the path
+//     relative to the directory containing the ignore file, and other
+//     patterns are matched against the last element of the path
+//   - a ** between slashes matches any number of directories, including
+//     none, and a ** at the end matches everything within a directory
+//   - a pattern starting with ! includes a path that was skipped by an
+//     earlier pattern, unless a directory that it is in was skipped
+//
+// The ignore files in a directory and all of its parents are used, and
+// later patterns and deeper files take precedence.
+const ignoreFileName = ".tidyhtmlignore"
+
+// ignorePattern is one line of an ignore file.
+type ignorePattern struct {
+	glob    string
+	negate  bool
+	dirOnly bool
+	rooted  bool
+}
+
+func (p ignorePattern) match(rel string, dir bool) bool {
+	if p.dirOnly && !dir {
+		return false
+	}
+	if !p.rooted {
+		ok, _ := filepath.Match(p.glob, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(p.glob, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches the elements of a path against the elements of a
+// pattern, where a ** element matches any number of path elements. A **
+// at the end of the pattern matches at least one.
+func matchSegments(glob, names []string) bool {
+	for i, g := range glob {
+		if g == "**" {
+			if i == len(glob)-1 {
+				return len(names) > i
+			}
+			for j := i; j <= len(names); j++ {
+				if matchSegments(glob[i+1:], names[j:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if i >= len(names) {
+			return false
+		}
+		if ok, _ := filepath.Match(g, names[i]); !ok {
+			return false
+		}
+	}
+	return len(names) == len(glob)
+}
+
+// The patterns from the ignore file in each directory,
+// including nil for directories without one.
+var (
+	ignores   = map[string][]ignorePattern{}
+	ignoresMu sync.Mutex
+)
+
+// readIgnoreFile returns the patterns in the ignore file in dir.
+func readIgnoreFile(dir string) ([]ignorePattern, error) {
+	ignoresMu.Lock()
+	defer ignoresMu.Unlock()
+	if p, ok := ignores[dir]; ok {
+		return p, nil
+	}
+
+	f, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if os.IsNotExist(err) {
+		ignores[dir] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []ignorePattern
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			p.negate, line = true, line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly, line = true, strings.TrimSuffix(line, "/")
+		}
+		p.rooted = strings.Contains(line, "/")
+		p.glob = strings.TrimPrefix(line, "/")
+		if p.glob != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	ignores[dir] = patterns
+	return patterns, nil
+}
+
+// isIgnored reports whether a path is listed in the ignore files in the
+// directories above it, or is within a directory that is, unless
+// -no-ignore is used.
+func isIgnored(path string, dir bool) (bool, error) {
+	if *noIgnoreFlag {
+		return false, nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+
+	// Find the directories above the path, outermost first.
+	var dirs []string
+	for d := filepath.Dir(abs); ; d = filepath.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	// A path cannot be included again when a directory it is in was
+	// skipped, so the directories are checked first.
+	for i := 1; i < len(dirs); i++ {
+		ignored, err := matchIgnoreFiles(dirs[:i], dirs[i], true)
+		if err != nil || ignored {
+			return ignored, err
+		}
+	}
+	return matchIgnoreFiles(dirs, abs, dir)
+}
+
+// matchIgnoreFiles reports whether the ignore files in dirs skip abs.
+func matchIgnoreFiles(dirs []string, abs string, dir bool) (bool, error) {
+	ignored := false
+	for _, d := range dirs {
+		patterns, err := readIgnoreFile(d)
+		if err != nil {
+			return false, err
+		}
+		if len(patterns) == 0 {
+			continue
+		}
+		rel, err := filepath.Rel(d, abs)
+		if err != nil {
+			return false, err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, p := range patterns {
+			if p.match(rel, dir) {
+				ignored = !p.negate
+			}
+		}
+	}
+	return ignored, nil
+}
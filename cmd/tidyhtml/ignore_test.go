@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnore(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(ignoreFileName, "# comment\n\nbuild/\n/dist\n*.min.html\n!keep.min.html\ndocs/**/gen\nout/**\n")
+	write("sub/"+ignoreFileName, "!build/\nlocal.html\n")
+
+	for _, test := range []struct {
+		path    string
+		dir     bool
+		ignored bool
+	}{
+		{"a.html", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"x/build", true, true},
+		{"build/a.html", false, true},
+		{"dist", true, true},
+		{"dist/a.html", false, true},
+		{"x/dist", true, false},
+		{"a.min.html", false, true},
+		{"x/a.min.html", false, true},
+		{"keep.min.html", false, false},
+		{"build/keep.min.html", false, true},
+		{"docs/gen", true, true},
+		{"docs/a/b/gen", true, true},
+		{"docs/a/gen.html", false, false},
+		{"x/docs/gen", true, false},
+		{"out", true, false},
+		{"out/a.html", false, true},
+		{"sub/build", true, false},
+		{"sub/build/a.html", false, false},
+		{"sub/local.html", false, true},
+		{"local.html", false, false},
+	} {
+		got, err := isIgnored(filepath.Join(dir, filepath.FromSlash(test.path)), test.dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.ignored {
+			t.Errorf("%s (dir %v): expected ignored %v, got %v", test.path, test.dir, test.ignored, got)
+		}
+	}
+
+	defer func(b bool) { *noIgnoreFlag = b }(*noIgnoreFlag)
+	*noIgnoreFlag = true
+	if got, err := isIgnored(filepath.Join(dir, "a.min.html"), false); err != nil || got {
+		t.Errorf("Expected -no-ignore to include a.min.html, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+var jobsFlag = flag.Int("j", runtime.GOMAXPROCS(0),
+	"number of files to tidy at the same time")
+
+func init() {
+	flag.IntVar(jobsFlag, "jobs", *jobsFlag, "same as -j")
+}
+
+// job is a file to tidy, or an error from looking for files.
+type job struct {
+	path string
+	err  error
+}
+
+// result is the outcome of a job. Its output is buffered so that
+// the results can be written in order.
+type result struct {
+	out   bytes.Buffer
+	stats fileStats
+	err   error
+}
+
+// findFiles returns jobs for the files in the roots, in the order that
+// they were found. Errors from walking directories are included as jobs
+// so that they are reported in the same order.
+func findFiles(roots []string) []job {
+	var jobs []job
+	for _, root := range roots {
+		if isURL(root) {
+			jobs = append(jobs, job{path: root})
+			continue
+		}
+		skipped, err := walk(root, func(path string) error {
+			if *outDirFlag != "" {
+				if err := addOutPath(root, path); err != nil {
+					jobs = append(jobs, job{err: err})
+					return nil
+				}
+			}
+			jobs = append(jobs, job{path: path})
+			return nil
+		})
+		stats.Skipped += skipped
+		if err != nil {
+			jobs = append(jobs, job{err: err})
+		}
+	}
+	return jobs
+}
+
+// runJobs tidies the files using the number of workers given by -j.
+// The output and errors for each file are written in the same order as
+// the jobs, no matter which order they finish in, and with -progress, how
+// many of them are done is shown on stderr. It reports whether any of the
+// jobs failed. With -stream, the files are tidied one at a time, straight
+// to stdout, instead of being buffered.
+func runJobs(jobs []job) (failed bool) {
+	workers := *jobsFlag
+	if workers < 1 || canStream() {
+		workers = 1
+	}
+
+	results := make([]chan *result, len(jobs))
+	for i := range results {
+		results[i] = make(chan *result, 1)
+	}
+	queue := make(chan int)
+	go func() {
+		for i := range jobs {
+			queue <- i
+		}
+		close(queue)
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range queue {
+				results[i] <- runJob(jobs[i])
+			}
+		}()
+	}
+
+	var p *progress
+	if *progressFlag && len(jobs) != 0 {
+		p = newProgress(len(jobs))
+	}
+	for _, ch := range results {
+		r := <-ch
+		if p != nil && (r.out.Len() != 0 || r.err != nil) {
+			p.clear()
+		}
+		os.Stdout.Write(r.out.Bytes())
+		if r.stats.Changed {
+			changed = true
+		}
+		if r.stats.Path != "" {
+			stats.add(r.stats, r.err)
+		} else {
+			stats.Errors++
+		}
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", r.err)
+			failed = true
+		}
+		if p != nil {
+			p.fileDone()
+		}
+	}
+	if p != nil {
+		p.finish()
+	}
+	return failed
+}
+
+func runJob(j job) *result {
+	r := &result{err: j.err}
+	switch {
+	case r.err != nil:
+	case isURL(j.path):
+		r.stats, r.err = processURL(&r.out, j.path)
+	case canStream():
+		r.stats, r.err = streamFile(os.Stdout, j.path)
+	default:
+		r.stats, r.err = processFile(&r.out, j.path)
+	}
+	return r
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/raymondbutcher/tidyhtml/lint"
+)
+
+var disableFlag listFlag
+
+var fixFlag = flag.Bool("fix", false,
+	"with lint, remove the characters that the invisible-chars rule finds\n"+
+		"from the files before checking them")
+
+func init() {
+	flag.Var(&disableFlag, "disable",
+		"with lint, rule IDs to disable, comma separated (may be repeated)")
+}
+
+// lintInput checks the input for problems, and writes a line to w for
+// each one that it finds, or in the format given by -format. The findings are counted as changes, so that
+// the exit status shows whether there were any. With -fix, invisible
+// characters are removed from the file first.
+func lintInput(w io.Writer, name, path string, in []byte) (fileStats, error) {
+	fs := fileStats{Path: name, BytesIn: len(in)}
+	in, compressed, err := decompress(in)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	if *fixFlag {
+		if fixed := lint.StripInvisible(in); !bytes.Equal(fixed, in) {
+			out, err := compress(fixed, compressed)
+			if err == nil {
+				err = writeFile(path, out)
+			}
+			if err != nil {
+				return fs, err
+			}
+			in = fixed
+		}
+	}
+	opts, err := options(path)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	findings, err := lint.Check(in, lint.Options{
+		Disable:  disableFlag,
+		Fragment: opts.Fragment,
+		Context:  opts.Context,
+	})
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	for _, f := range findings {
+		if *formatFlag != "text" {
+			fs.diagnostics = append(fs.diagnostics, diagnostic{
+				File:     name,
+				Line:     f.Pos.Line,
+				Column:   f.Pos.Column,
+				Rule:     f.Rule,
+				Severity: f.Severity.String(),
+				Message:  f.Message,
+			})
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s:%s\n", name, f); err != nil {
+			return fs, err
+		}
+	}
+	fs.Changed = len(findings) != 0
+	return fs, writeDiagnostics(w, fs.diagnostics)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+// JSON-RPC error codes.
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+	lspInternalError  = -32603
+)
+
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *lspError        `json:"error"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lspError) Error() string {
+	return e.Message
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspDocumentParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	ContentChanges []struct {
+		Range *lspRange `json:"range"`
+		Text  string    `json:"text"`
+	} `json:"contentChanges"`
+	Range   *lspRange             `json:"range"`
+	Options *lspFormattingOptions `json:"options"`
+}
+
+// lspFormattingOptions are the options that the editor asks documents to
+// be formatted with.
+type lspFormattingOptions struct {
+	TabSize      int  `json:"tabSize"`
+	InsertSpaces bool `json:"insertSpaces"`
+}
+
+// indent returns the indentation that the options ask for.
+func (o *lspFormattingOptions) indent() string {
+	if !o.InsertSpaces {
+		return "\t"
+	}
+	return strings.Repeat(" ", o.TabSize)
+}
+
+// lspServer holds the state of a language server session.
+type lspServer struct {
+	w    *bufio.Writer
+	docs map[string]string
+	// Whether a shutdown request has been received.
+	shutdown bool
+}
+
+// serveLSP runs a language server, reading messages from r and writing
+// them to w, until it is told to exit. It returns the exit status.
+func serveLSP(r io.Reader, w io.Writer) int {
+	s := &lspServer{w: bufio.NewWriter(w), docs: map[string]string{}}
+	br := bufio.NewReader(r)
+	for {
+		body, err := readLSPMessage(br)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			}
+			return exitError
+		}
+		msg := lspMessage{}
+		if err := json.Unmarshal(body, &msg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			continue
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return exitOK
+			}
+			return exitError
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			// Notifications do not get a response.
+			continue
+		}
+		if err != nil {
+			lerr, ok := err.(*lspError)
+			if !ok {
+				lerr = &lspError{Code: lspInternalError, Message: err.Error()}
+			}
+			err = s.write(lspErrorResponse{JSONRPC: "2.0", ID: msg.ID, Error: lerr})
+		} else {
+			err = s.write(lspResponse{JSONRPC: "2.0", ID: msg.ID, Result: result})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitError
+		}
+	}
+}
+
+// handle handles a request or notification, and returns the result.
+func (s *lspServer) handle(msg lspMessage) (interface{}, error) {
+	params := lspDocumentParams{}
+	if len(msg.Params) != 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+	}
+	uri := params.TextDocument.URI
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// The whole document is sent with each change.
+				"textDocumentSync":                1,
+				"documentFormattingProvider":      true,
+				"documentRangeFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "tidyhtml", "version": version()},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.docs[uri] = params.TextDocument.Text
+	case "textDocument/didChange":
+		for _, c := range params.ContentChanges {
+			if c.Range == nil {
+				s.docs[uri] = c.Text
+			}
+		}
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+	case "textDocument/formatting":
+		return s.format(uri, nil, params.Options)
+	case "textDocument/rangeFormatting":
+		if params.Range == nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: "missing range"}
+		}
+		return s.format(uri, params.Range, params.Options)
+	default:
+		if msg.ID != nil && !strings.HasPrefix(msg.Method, "$/") {
+			return nil, &lspError{Code: lspMethodNotFound, Message: "method not found: " + msg.Method}
+		}
+	}
+	return nil, nil
+}
+
+// format returns the edits that tidy a document, or the lines of it
+// within a range. The indentation that the editor asks for in fo is used,
+// unless the config files or the flags set it.
+func (s *lspServer) format(uri string, r *lspRange, fo *lspFormattingOptions) ([]lspTextEdit, error) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return nil, &lspError{Code: lspInvalidParams, Message: "unknown document: " + uri}
+	}
+	opts := tidyhtml.Options{FinalNewline: true}
+	if fo != nil {
+		opts.Indent = fo.indent()
+	}
+	opts, err := optionsFrom(uriPath(uri), opts)
+	if err != nil {
+		return nil, err
+	}
+	var out string
+	if r == nil {
+		buf := bytes.Buffer{}
+		if err := tidyhtml.CopyWithOptions(&buf, strings.NewReader(text), opts); err != nil {
+			return nil, err
+		}
+		out = buf.String()
+	} else {
+		// A range that ends at the start of a line does not include it.
+		start, end := r.Start.Line+1, r.End.Line+1
+		if r.End.Character == 0 && end > start {
+			end--
+		}
+		b, err := tidyhtml.FormatRange([]byte(text), start, end, opts)
+		if err != nil {
+			return nil, err
+		}
+		out = string(b)
+	}
+	return lineEdits(text, out), nil
+}
+
+// lineEdits returns an edit that changes old into new, replacing only the
+// lines that differ.
+func lineEdits(old, new string) []lspTextEdit {
+	if old == new {
+		return []lspTextEdit{}
+	}
+	a, b := strings.SplitAfter(old, "\n"), strings.SplitAfter(new, "\n")
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+	end := 0
+	for end < len(a)-start && end < len(b)-start && a[len(a)-1-end] == b[len(b)-1-end] {
+		end++
+	}
+	return []lspTextEdit{{
+		Range: lspRange{
+			Start: lspPosition{Line: start},
+			End:   endPosition(a, len(a)-end),
+		},
+		NewText: strings.Join(b[start:len(b)-end], ""),
+	}}
+}
+
+// endPosition returns the position at the end of the first n lines, as
+// split by strings.SplitAfter.
+// Characters are counted in UTF-16 code units, as LSP requires.
+func endPosition(lines []string, n int) lspPosition {
+	if n < len(lines) {
+		return lspPosition{Line: n}
+	}
+	chars := 0
+	for _, r := range lines[len(lines)-1] {
+		chars++
+		if r >= 0x10000 {
+			chars++
+		}
+	}
+	return lspPosition{Line: len(lines) - 1, Character: chars}
+}
+
+// uriPath returns the path of a file: URI, or "" for other URIs, such as
+// those of unsaved documents.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
+
+// readLSPMessage reads the body of a message, which comes after headers
+// that give its length.
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if i := strings.IndexByte(line, ':'); i != -1 && strings.EqualFold(line[:i], "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %s", line[i+1:])
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length")
+	}
+	body := make([]byte, length)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+// write writes a message with its header.
+func (s *lspServer) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n", len(body))
+	s.w.Write(body)
+	return s.w.Flush()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"testing"
+)
+
+type lspTestResponse struct {
+	ID     int
+	Result json.RawMessage
+	Error  *lspError
+}
+
+// serveLSPMessages runs a language server session with the messages,
+// and returns the responses.
+func serveLSPMessages(t *testing.T, messages ...string) []lspTestResponse {
+	t.Helper()
+	in := bytes.Buffer{}
+	for _, msg := range messages {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	out := bytes.Buffer{}
+	if status := serveLSP(&in, &out); status != exitOK {
+		t.Errorf("Expected exit status %d, got %d", exitOK, status)
+	}
+	var responses []lspTestResponse
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readLSPMessage(r)
+		if err != nil {
+			return responses
+		}
+		resp := lspTestResponse{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+}
+
+func lspEdits(t *testing.T, resp lspTestResponse) []lspTextEdit {
+	t.Helper()
+	var e []lspTextEdit
+	if err := json.Unmarshal(resp.Result, &e); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestLSP(t *testing.T) {
+	responses := serveLSPMessages(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":`+
+			`{"uri":"untitled:1","text":"<html><head></head><body>\n<ul>\n  <li>b</li></ul>\n</body></html>\n"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/formatting","params":{"textDocument":{"uri":"untitled:1"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/rangeFormatting","params":{"textDocument":{"uri":"untitled:1"},`+
+			`"range":{"start":{"line":1,"character":0},"end":{"line":2,"character":3}}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"unknown/method"}`,
+		`{"jsonrpc":"2.0","id":5,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	if len(responses) != 5 {
+		t.Fatalf("Expected 5 responses, got %d", len(responses))
+	}
+
+	whole := lspEdits(t, responses[1])
+	if len(whole) != 1 || whole[0].Range.End.Line != 4 || whole[0].NewText != "<html>\n    <head></head>\n"+
+		"    <body>\n        <ul>\n            <li>b</li>\n        </ul>\n    </body>\n</html>\n" {
+		t.Errorf("Unexpected formatting edits: %+v", whole)
+	}
+	ranged := lspEdits(t, responses[2])
+	if len(ranged) != 1 || ranged[0].Range.Start.Line != 2 || ranged[0].Range.End.Line != 3 ||
+		ranged[0].NewText != "    <li>b</li>\n</ul>\n" {
+		t.Errorf("Unexpected range formatting edits: %+v", ranged)
+	}
+	if e := responses[3].Error; e == nil || e.Code != lspMethodNotFound {
+		t.Errorf("Expected a method not found error, got %+v", e)
+	}
+}
+
+func TestLSPFormattingOptions(t *testing.T) {
+	// The indentation is the one that the editor asks for.
+	responses := serveLSPMessages(t,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":`+
+			`{"uri":"untitled:1","text":"<div><ul><li>b</li></ul></div>\n"}}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/formatting","params":{"textDocument":{"uri":"untitled:1"},`+
+			`"options":{"tabSize":2,"insertSpaces":true}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/rangeFormatting","params":{"textDocument":{"uri":"untitled:1"},`+
+			`"range":{"start":{"line":0,"character":0},"end":{"line":1,"character":0}},`+
+			`"options":{"tabSize":8,"insertSpaces":false}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	if len(responses) != 3 {
+		t.Fatalf("Expected 3 responses, got %d", len(responses))
+	}
+	if e := lspEdits(t, responses[0]); len(e) != 1 || e[0].NewText != "<html>\n  <head></head>\n"+
+		"  <body>\n    <div>\n      <ul>\n        <li>b</li>\n      </ul>\n    </div>\n  </body>\n</html>\n" {
+		t.Errorf("Unexpected formatting edits: %+v", e)
+	}
+	if e := lspEdits(t, responses[1]); len(e) != 1 || e[0].NewText != "<div>\n\t<ul>\n\t\t<li>b</li>\n\t</ul>\n</div>\n" {
+		t.Errorf("Unexpected range formatting edits: %+v", e)
+	}
+
+	// The config file for a document takes precedence.
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".tidyhtml.yaml": "indent: 3\nfragment: true\n"})
+	uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(dir, "a.html"))}).String()
+	responses = serveLSPMessages(t,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":`+
+			`{"uri":"`+uri+`","text":"<ul><li>b</li></ul>\n"}}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/formatting","params":{"textDocument":{"uri":"`+uri+`"},`+
+			`"options":{"tabSize":2,"insertSpaces":true}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses, got %d", len(responses))
+	}
+	if e := lspEdits(t, responses[0]); len(e) != 1 || e[0].NewText != "<ul>\n   <li>b</li>\n</ul>\n" {
+		t.Errorf("Unexpected formatting edits with a config file: %+v", e)
+	}
+}
@@ -1,16 +1,489 @@
+// Command tidyhtml tidies HTML files, or HTML from stdin.
+//
+// Usage:
+//
+//	tidyhtml [flags] [path ...]
+//
+// Without any paths, it reads HTML from stdin and writes the tidy version
+// to stdout. Use -stdin-filepath to say which file is being read, such as
+// when it is used by an editor. Given files, it tidies them and writes them
+// to stdout, or back to the files with -w. Given directories, it does the
+// same for all *.html and *.htm files within them. Given URLs, it fetches
+// the pages and writes the tidy versions to stdout. With -out-dir, the tidy
+// files are written into another directory instead, with the same paths
+// as within the directories given. Use -files-from to read the list of
+// paths from a file or stdin, with -0 if they are separated by NUL
+// characters, such as from find -print0.
+//
+// With -changed, only the files that git reports as added or modified
+// since HEAD, or since the revision given with -changed=REF, are tidied,
+// within the current directory if there are no paths.
+//
+// Options are read from a config file such as .tidyhtml.yaml, which is
+// looked for in the directory of each file and then its parents. See
+// tidyhtml.Config for the format. Settings in .editorconfig files are used
+// too, but the config file takes precedence. Flags override them both.
+//
+// With -watch, it keeps running after tidying the files, and tidies
+// them in place again whenever they change.
+//
+// With -l, it lists the files that are not already tidy, like gofmt -l.
+// With -diff, it prints a diff of the changes instead of the tidy version.
+// With -check, nothing is written and it exits with a non-zero status if
+// any of the files are not already tidy, which is useful in CI. With
+// -format json, it also prints each change that tidying would make as a
+// JSON object, with the tidy lines as a suggested fix, and with -format
+// github, as an annotation for GitHub Actions.
+//
+// With -ast, it prints the parsed tree of each input as indented JSON
+// instead, which shows what tidyhtml started from. With -text, it prints
+// only the visible text, like lynx -dump.
+//
+// With -stats, it prints a summary of the run to stderr when it is done,
+// and with -stats-json it prints the summary and the statistics for each
+// file as JSON instead.
+//
+// The lint subcommand checks the files for problems instead of tidying
+// them, and prints each one with its location. With -format json, it
+// prints each one as a JSON object on a line of its own, with -format
+// github, as an annotation for GitHub Actions to show on pull requests, and
+// with -format sarif, it prints them all as a SARIF log, for code scanning
+// tools such as GitHub's. See the lint package for the rules.
+//
+//	tidyhtml lint [flags] [path ...]
+//
+// The stats subcommand reports on the structure of the files instead,
+// with the number of each element and attribute, the deepest nesting,
+// how much of each file is text, and the number of inline scripts and
+// styles.
+//
+//	tidyhtml stats [flags] [path ...]
+//
+// The outline subcommand prints the headings of the files instead, with
+// the sectioning elements such as <section> and <article>, as a tree
+// indented by how they are nested.
+//
+//	tidyhtml outline [flags] [path ...]
+//
+// The lsp subcommand runs a language server on stdin and stdout, so that
+// editors can use tidyhtml to format the documents that they have open
+// without starting it each time. It supports formatting whole documents
+// and ranges of lines, with the options for each document chosen as if it
+// were tidied with -stdin-filepath set to its path, and flags apply too.
+// The indentation that the editor asks for is used, unless a config file,
+// an .editorconfig or -indent sets it.
+//
+//	tidyhtml lsp [flags]
+//
+// The completion subcommand prints a script for a shell that completes
+// the flags, their values such as the names of profiles, and the
+// subcommands.
+//
+//	tidyhtml completion bash|zsh|fish|powershell
+//
+// The exit status is 0 on success, 1 if -check found files that are not
+// tidy or lint found problems, 2 for usage errors, and 3 if a file could
+// not be read, parsed or written.
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/raymondbutcher/tidyhtml"
+	"github.com/raymondbutcher/tidyhtml/internal/diff"
 )
 
+var templateFlag = flag.String("template", "",
+	"template language: none, jinja, handlebars, erb, php, go, templ,\n"+
+		"markdown, vue or svelte (default: based on the file extension)")
+
+var (
+	writeFlag = flag.Bool("w", false,
+		"write the result to the file instead of stdout")
+	listFilesFlag = flag.Bool("l", false,
+		"list files that are not tidy instead of writing the result")
+	diffFlag = flag.Bool("diff", false,
+		"print a diff of the changes instead of the result")
+	checkFlag = flag.Bool("check", false,
+		"exit with a non-zero status if any file is not tidy, without\n"+
+			"writing anything (use with -diff to see the changes)")
+	stdinFilepathFlag = flag.String("stdin-filepath", "",
+		"the path of the file being read from stdin, which is used in\n"+
+			"messages and for choosing options as if the file were on disk")
+)
+
+// Exit statuses.
+const (
+	exitOK      = 0
+	exitChanged = 1
+	exitUsage   = 2
+	exitError   = 3
+)
+
+// The name used for stdin in diffs and error messages.
+const stdinName = "<standard input>"
+
+// Whether any of the input was changed by tidying it.
+var changed bool
+
+// processInput handles the input from each file, URL or stdin.
+// It is process, unless a subcommand replaces it.
+var processInput = process
+
+// The subcommand being run, if any. Subcommands count their findings as
+// changes, and exit with a non-zero status if there are any.
+var subcommand string
+
+// subcommands are the functions that handle the input for each
+// subcommand, and the flags that cannot be used with them.
+var subcommands = map[string]struct {
+	process           func(w io.Writer, name, path string, in []byte) (fileStats, error)
+	incompatibleFlags []string
+}{
+	"lint":    {lintInput, []string{"w", "watch", "diff", "check", "l", "backup", "minify", "collapse", "out-dir"}},
+	"stats":   {structureInput, []string{"w", "watch", "diff", "check", "l", "backup", "minify", "collapse", "out-dir"}},
+	"outline": {outlineInput, []string{"w", "watch", "diff", "check", "l", "backup", "minify", "collapse", "out-dir"}},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: tidyhtml [flags] [path ...]\n")
+	fmt.Fprintf(os.Stderr, "       tidyhtml lint [flags] [path ...]\n")
+	fmt.Fprintf(os.Stderr, "       tidyhtml stats [flags] [path ...]\n")
+	fmt.Fprintf(os.Stderr, "       tidyhtml outline [flags] [path ...]\n")
+	fmt.Fprintf(os.Stderr, "       tidyhtml lsp [flags]\n")
+	fmt.Fprintf(os.Stderr, "       tidyhtml completion bash|zsh|fish|powershell\n")
+	flag.PrintDefaults()
+}
+
 func main() {
-	if err := tidyhtml.Copy(os.Stdout, os.Stdin); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s", err)
-		os.Exit(1)
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the command with the arguments after the program name,
+// and returns the exit status.
+func run(args []string) int {
+	flag.Usage = usage
+	if len(args) > 0 && args[0] == "completion" {
+		return runCompletion(os.Stdout, args[1:])
+	}
+	if len(args) > 0 && args[0] == "lsp" {
+		flag.CommandLine.Parse(args[1:])
+		return serveLSP(os.Stdin, os.Stdout)
+	}
+	if len(args) > 0 {
+		if sub, ok := subcommands[args[0]]; ok {
+			subcommand, args = args[0], args[1:]
+			processInput = sub.process
+		}
+	}
+	flag.CommandLine.Parse(args)
+	if subcommand != "" && rejectFlags(subcommands[subcommand].incompatibleFlags, subcommand) {
+		return exitUsage
+	}
+	if *astFlag || *textFlag {
+		mode := "-ast"
+		processInput = astInput
+		if *textFlag {
+			mode, processInput = "-text", textInput
+		}
+		if *astFlag && *textFlag {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -ast with -text\n")
+			return exitUsage
+		}
+		if subcommand != "" {
+			fmt.Fprintf(os.Stderr, "Error: cannot use %s with %s\n", mode, subcommand)
+			return exitUsage
+		}
+		if rejectFlags([]string{"w", "watch", "diff", "check", "l", "backup", "minify", "collapse", "stream", "cursor-offset", "out-dir"}, mode) {
+			return exitUsage
+		}
+	}
+
+	if *versionFlag {
+		fmt.Println(version())
+		return exitOK
+	}
+	if *templateFlag != "" {
+		if _, err := tidyhtml.ParseTemplateMode(*templateFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitUsage
+		}
+	}
+	if *profileFlag != "" {
+		if _, err := tidyhtml.ApplyProfile(*profileFlag, tidyhtml.Options{}); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitUsage
+		}
+	}
+	if *indentFlag != "" {
+		if _, err := tidyhtml.ParseIndent(*indentFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitUsage
+		}
+	}
+	if *selfClosingFlag != "" {
+		if _, err := tidyhtml.ParseSelfClosingStyle(*selfClosingFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitUsage
+		}
+	}
+	if *renameFlag != "" {
+		if _, err := tidyhtml.ParseRenames(*renameFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitUsage
+		}
+	}
+	if *elementFormatsFlag != "" {
+		if _, err := tidyhtml.ParseElementFormats(*elementFormatsFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitUsage
+		}
+	}
+	if *bomFlag != "" {
+		if _, err := tidyhtml.ParseBOMMode(*bomFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitUsage
+		}
+	}
+	if !validFormat() {
+		fmt.Fprintf(os.Stderr, "Error: unknown format: %q\n", *formatFlag)
+		return exitUsage
+	}
+	if *formatFlag != "text" && (subcommand != "lint" && !*checkFlag || *diffFlag || *listFilesFlag) {
+		fmt.Fprintf(os.Stderr, "Error: can only use -format %s with lint or -check, without -diff or -l\n", *formatFlag)
+		return exitUsage
+	}
+	var err error
+	if colorDiffs, err = useColor(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return exitUsage
+	}
+	if *watchIntervalFlag <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: -watch-interval must be more than 0\n")
+		return exitUsage
+	}
+	if *watchFlag {
+		*writeFlag = true
+	}
+	if *writeFlag && (*diffFlag || *checkFlag) {
+		fmt.Fprintf(os.Stderr, "Error: cannot use -w or -watch with -diff or -check\n")
+		return exitUsage
+	}
+
+	// Without any paths, the input is read from stdin.
+	paths := flag.Args()
+	fromStdin := len(paths) == 0
+	if *nulFlag && *filesFromFlag == "" {
+		fmt.Fprintf(os.Stderr, "Error: can only use -0 with -files-from\n")
+		return exitUsage
+	}
+	if *filesFromFlag != "" {
+		listed, err := readFileList(*filesFromFlag, *nulFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitError
+		}
+		paths, fromStdin = append(paths, listed...), false
+	}
+	if changedSince != "" {
+		if *watchFlag {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -changed with -watch\n")
+			return exitUsage
+		}
+		if fromStdin {
+			paths, fromStdin = []string{"."}, false
+		}
+		repo := "."
+		if len(paths) != 0 {
+			repo = paths[0]
+		}
+		if err := findChanged(repo); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitError
+		}
+	}
+
+	if *outDirFlag != "" && (*writeFlag || *diffFlag || *checkFlag || *listFilesFlag) {
+		fmt.Fprintf(os.Stderr, "Error: cannot use -out-dir with -w, -watch, -diff, -check or -l\n")
+		return exitUsage
+	}
+	if *outDirFlag != "" && fromStdin {
+		fmt.Fprintf(os.Stderr, "Error: cannot use -out-dir with standard input\n")
+		return exitUsage
+	}
+	for _, path := range paths {
+		if *writeFlag && isURL(path) {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -w or -watch with URLs\n")
+			return exitUsage
+		}
+		if *outDirFlag != "" && isURL(path) {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -out-dir with URLs\n")
+			return exitUsage
+		}
+		if *fixFlag && isURL(path) {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -fix with URLs\n")
+			return exitUsage
+		}
+	}
+
+	if *cursorOffsetFlag >= 0 && (!fromStdin || *streamFlag) {
+		fmt.Fprintf(os.Stderr, "Error: can only use -cursor-offset with standard input, without -stream\n")
+		return exitUsage
+	}
+
+	if fromStdin {
+		if *writeFlag {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -w or -watch with standard input\n")
+			return exitUsage
+		}
+		if *fixFlag {
+			fmt.Fprintf(os.Stderr, "Error: cannot use -fix with standard input\n")
+			return exitUsage
+		}
+		name, path := stdinName, *stdinFilepathFlag
+		if path != "" {
+			name = path
+		}
+		var fs fileStats
+		if canStream() {
+			fs, err = streamStdin(name, path)
+		} else {
+			var in []byte
+			in, err = ioutil.ReadAll(os.Stdin)
+			fs = fileStats{Path: name, BytesIn: len(in)}
+			if err == nil {
+				fs, err = processInput(os.Stdout, name, path, in)
+			}
+		}
+		changed = fs.Changed
+		stats.add(fs, err)
+		if err == nil {
+			err = printReport(os.Stdout)
+		}
+		printStats()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			return exitError
+		}
+	} else {
+		failed := runJobs(findFiles(paths))
+		if err := printReport(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			failed = true
+		}
+		printStats()
+		if *watchFlag {
+			watch(paths)
+		}
+		if failed {
+			return exitError
+		}
+	}
+
+	if (*checkFlag || subcommand != "") && changed {
+		return exitChanged
+	}
+	return exitOK
+}
+
+// rejectFlags reports a usage error if any of the named flags were given
+// along with a subcommand or another flag, and returns whether there were.
+func rejectFlags(names []string, with string) bool {
+	rejected := false
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name && !rejected {
+				fmt.Fprintf(os.Stderr, "Error: cannot use -%s with %s\n", name, with)
+				rejected = true
+			}
+		}
+	})
+	return rejected
+}
+
+// processFile tidies a file.
+func processFile(w io.Writer, path string) (fileStats, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fileStats{Path: path}, err
+	}
+	return processInput(w, path, path, in)
+}
+
+// process tidies the input and then writes the result to w, or back to
+// the file when using -w, or into the directory given by -out-dir, or
+// writes a diff to w when using -diff. With -l,
+// the name is written to w if the input was not already tidy. The name
+// is used in messages, and the path, if known, is where the input came from.
+// Compressed input is decompressed first, and compressed again when it is
+// written back to the file. It returns statistics including whether tidying
+// made any changes.
+func process(w io.Writer, name, path string, in []byte) (fileStats, error) {
+	fs := fileStats{Path: name, BytesIn: len(in)}
+	in, compressed, err := decompress(in)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	buf := bytes.Buffer{}
+	if err := tidy(&buf, bytes.NewReader(in), path); err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	out := buf.Bytes()
+	differs := !bytes.Equal(in, out)
+	fs.BytesOut, fs.Changed = len(out), differs
+
+	if *listFilesFlag && differs {
+		if _, err := fmt.Fprintln(w, name); err != nil {
+			return fs, err
+		}
+	}
+
+	switch {
+	case *diffFlag:
+		d := diff.Unified(name+".orig", name, in, out)
+		if colorDiffs {
+			d = colorDiff(d)
+		}
+		_, err = w.Write(d)
+	case *checkFlag && *formatFlag != "text":
+		if differs {
+			fs.diagnostics = untidyDiagnostics(name, in, out)
+		}
+		err = writeDiagnostics(w, fs.diagnostics)
+	case *checkFlag, *listFilesFlag && !*writeFlag:
+	case *writeFlag:
+		if differs {
+			if out, err = compress(out, compressed); err == nil {
+				err = writeFile(path, out)
+			}
+		}
+	case *outDirFlag != "":
+		if out, err = compress(out, compressed); err == nil {
+			err = writeOutFile(path, out)
+		}
+	default:
+		_, err = w.Write(out)
+	}
+	return fs, err
+}
+
+// tidy tidies HTML from src and writes it to dst.
+// The path, if known, is used to choose the options.
+func tidy(dst io.Writer, src io.Reader, path string) error {
+	opts, err := options(path)
+	if err != nil {
+		return err
+	}
+	if *streamFlag {
+		return tidyhtml.CopyStream(dst, src, opts)
+	}
+	if *cursorOffsetFlag >= 0 {
+		return tidyWithCursor(dst, src, opts)
 	}
-	fmt.Fprintln(os.Stdout)
+	return tidyhtml.CopyWithOptions(dst, src, opts)
 }
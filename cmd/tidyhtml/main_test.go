@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runArgsEnv holds the arguments for run, as JSON, when the test binary
+// is started by runCommand.
+const runArgsEnv = "TIDYHTML_TEST_RUN_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(runArgsEnv); ok {
+		var a []string
+		if err := json.Unmarshal([]byte(args), &a); err != nil {
+			panic(err)
+		}
+		os.Exit(run(a))
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs the command in dir, with stdin as its input, and returns
+// its exit status and output. It is run in a new process of the test
+// binary, as the flags and the rest of its state are global.
+func runCommand(t *testing.T, dir, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runArgsEnv+"="+string(b))
+	cmd.Stdin = strings.NewReader(stdin)
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatal(err)
+		}
+		code = exitErr.ExitCode()
+	}
+	return code, stdout.String(), stderr.String()
+}
+
+// writeFiles writes the files, which are named by their slash separated
+// paths within dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func gzipString(t *testing.T, s string) string {
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestRun(t *testing.T) {
+	const (
+		untidy = "<ul><li>a</li></ul>\n"
+		tidy   = "<ul>\n    <li>a</li>\n</ul>\n"
+	)
+	files := map[string]string{
+		"a.html":          untidy,
+		"b.html":          tidy,
+		"sub/c.htm":       untidy,
+		"sub/d.txt":       untidy,
+		"list.txt":        "a.html\nb.html\n",
+		"e.html.gz":       gzipString(t, untidy),
+		"ignored/f.html":  untidy,
+		".tidyhtmlignore": "ignored/\n",
+		"g.html":          "<img src=\"x\">\n",
+	}
+
+	for _, test := range []struct {
+		name   string
+		stdin  string
+		args   []string
+		code   int
+		stdout string
+		// stderr is the start of what is written to stderr.
+		stderr string
+		// want is the content of the files that are changed.
+		want map[string]string
+	}{
+		{
+			name:   "stdin",
+			stdin:  untidy,
+			args:   []string{"-fragment"},
+			stdout: tidy,
+		},
+		{
+			name:   "file",
+			args:   []string{"-fragment", "a.html"},
+			stdout: tidy,
+		},
+		{
+			name:   "stdin-filepath in errors",
+			stdin:  untidy,
+			args:   []string{"-stdin-filepath", "x.html", "-charset", "bogus"},
+			code:   exitError,
+			stderr: "Error: x.html: tidyhtml: unknown charset: \"bogus\"\n",
+		},
+		{
+			name: "write",
+			args: []string{"-fragment", "-w", "a.html", "b.html"},
+			want: map[string]string{"a.html": tidy, "b.html": tidy},
+		},
+		{
+			name: "write with backup",
+			args: []string{"-fragment", "-w", "-backup", "a.html", "b.html"},
+			want: map[string]string{"a.html": tidy, "a.html.orig": untidy},
+		},
+		{
+			name:   "list",
+			args:   []string{"-fragment", "-l", "."},
+			stdout: "a.html\nsub/c.htm\n",
+		},
+		{
+			name:   "list in parallel",
+			args:   []string{"-fragment", "-l", "-j", "4", "sub", "b.html", "a.html"},
+			stdout: "sub/c.htm\na.html\n",
+		},
+		{
+			name:   "list with extensions",
+			args:   []string{"-fragment", "-l", "-ext", "txt,htm", "sub"},
+			stdout: "sub/c.htm\nsub/d.txt\n",
+		},
+		{
+			name:   "list with excludes",
+			args:   []string{"-fragment", "-l", "-exclude", "sub", "."},
+			stdout: "a.html\n",
+		},
+		{
+			name:   "list without ignore files",
+			args:   []string{"-fragment", "-l", "-no-ignore", "."},
+			stdout: "a.html\nignored/f.html\nsub/c.htm\n",
+		},
+		{
+			name:   "list from a file",
+			args:   []string{"-fragment", "-l", "-files-from", "list.txt"},
+			stdout: "a.html\n",
+		},
+		{
+			name:   "list from stdin separated by NUL",
+			stdin:  "b.html\x00sub/c.htm",
+			args:   []string{"-fragment", "-l", "-files-from", "-", "-0"},
+			stdout: "sub/c.htm\n",
+		},
+		{
+			name: "check",
+			args: []string{"-fragment", "-check", "a.html", "b.html"},
+			code: exitChanged,
+		},
+		{
+			name: "check tidy",
+			args: []string{"-fragment", "-check", "b.html"},
+		},
+		{
+			name:   "diff",
+			args:   []string{"-fragment", "-diff", "a.html", "b.html"},
+			stdout: "--- a.html.orig\n+++ a.html\n@@ -1 +1,3 @@\n-<ul><li>a</li></ul>\n+<ul>\n+    <li>a</li>\n+</ul>\n",
+		},
+		{
+			name:   "gzip",
+			args:   []string{"-fragment", "e.html.gz"},
+			stdout: tidy,
+		},
+		{
+			name: "gzip written back",
+			args: []string{"-fragment", "-w", "e.html.gz"},
+			want: map[string]string{"e.html.gz": tidy},
+		},
+		{
+			name: "out-dir",
+			args: []string{"-fragment", "-out-dir", "out", "a.html", "sub"},
+			want: map[string]string{"a.html": untidy, "out/a.html": tidy, "out/c.htm": tidy},
+		},
+		{
+			name:   "stream",
+			args:   []string{"-fragment", "-stream", "a.html", "e.html.gz"},
+			stdout: tidy + tidy,
+		},
+		{
+			name:   "stream stdin",
+			stdin:  gzipString(t, untidy),
+			args:   []string{"-fragment", "-stream"},
+			stdout: tidy,
+		},
+		{
+			name:   "stats",
+			args:   []string{"-fragment", "-stats", "-check", "a.html", "b.html"},
+			code:   exitChanged,
+			stderr: "2 checked, 1 changed, 0 skipped, 0 errors, 46 bytes in, 52 bytes out, in ",
+		},
+		{
+			name:   "version",
+			args:   []string{"-version"},
+			stdout: version() + "\n",
+		},
+		{
+			name:   "lint",
+			args:   []string{"lint", "-fragment", "g.html", "b.html"},
+			code:   exitChanged,
+			stdout: "g.html:1:1: warning: <img> without an alt attribute (img-alt)\n",
+		},
+		{
+			name:   "lint usage error",
+			args:   []string{"lint", "-w", "g.html"},
+			code:   exitUsage,
+			stderr: "Error: cannot use -w with lint\n",
+		},
+		{
+			name:   "usage error",
+			args:   []string{"-w", "-diff", "a.html"},
+			code:   exitUsage,
+			stderr: "Error: cannot use -w or -watch with -diff or -check\n",
+		},
+		{
+			name:   "watch interval",
+			args:   []string{"-watch", "-watch-interval", "0", "a.html"},
+			code:   exitUsage,
+			stderr: "Error: -watch-interval must be more than 0\n",
+		},
+		{
+			name:   "missing file",
+			args:   []string{"missing.html"},
+			code:   exitError,
+			stderr: "Error: stat missing.html: no such file or directory\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, files)
+			code, stdout, stderr := runCommand(t, dir, test.stdin, test.args...)
+			if code != test.code {
+				t.Errorf("Expected exit status %d, got %d, with stderr:\n%s", test.code, code, stderr)
+			}
+			if stdout != test.stdout {
+				t.Errorf("Expected stdout:\n%q\nGot:\n%q", test.stdout, stdout)
+			}
+			if !strings.HasPrefix(stderr, test.stderr) || test.stderr == "" && stderr != "" {
+				t.Errorf("Expected stderr to start with:\n%q\nGot:\n%q", test.stderr, stderr)
+			}
+			for name, want := range test.want {
+				b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, _, err := decompress(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("Expected %s to be:\n%q\nGot:\n%q", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRunURL(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<ul><li>a</li></ul>"))
+	}))
+	defer s.Close()
+	code, stdout, stderr := runCommand(t, t.TempDir(), "", "-fragment", s.URL)
+	if code != exitOK {
+		t.Errorf("Expected exit status %d, got %d, with stderr:\n%s", exitOK, code, stderr)
+	}
+	if want := "<ul>\n    <li>a</li>\n</ul>\n"; stdout != want {
+		t.Errorf("Expected stdout:\n%q\nGot:\n%q", want, stdout)
+	}
+}
+
+func TestRunChanged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	writeFiles(t, dir, map[string]string{"a.html": "<p>a", "b.html": "<p>b"})
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	writeFiles(t, dir, map[string]string{"b.html": "<p>b</p>", "c.html": "<p>c"})
+
+	code, stdout, stderr := runCommand(t, dir, "", "-fragment", "-l", "-changed")
+	if code != exitOK {
+		t.Errorf("Expected exit status %d, got %d, with stderr:\n%s", exitOK, code, stderr)
+	}
+	if want := "b.html\nc.html\n"; stdout != want {
+		t.Errorf("Expected stdout:\n%q\nGot:\n%q", want, stdout)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+var outDirFlag = flag.String("out-dir", "",
+	"write the tidy files into this directory instead of to stdout, with\n"+
+		"the same paths as within the directories given, leaving the\n"+
+		"original files as they are")
+
+// outPaths maps the paths of the files being tidied to where -out-dir
+// writes them. It is filled in before any of the files are processed.
+var outPaths = map[string]string{}
+
+// addOutPath records where -out-dir writes a file found within root, which
+// is at the same path within the directory as the file is within root, or
+// just the name of the file if it is the root.
+func addOutPath(root, path string) error {
+	rel := filepath.Base(path)
+	if path != root {
+		var err error
+		if rel, err = filepath.Rel(root, path); err != nil {
+			return err
+		}
+	}
+	dst := filepath.Join(*outDirFlag, rel)
+	if canonicalPath(dst) == canonicalPath(path) {
+		return fmt.Errorf("%s: cannot write to the same file with -out-dir", path)
+	}
+	for other, d := range outPaths {
+		if d == dst && other != path {
+			return fmt.Errorf("%s: both %s and %s would be written there with -out-dir", dst, other, path)
+		}
+	}
+	outPaths[path] = dst
+	return nil
+}
+
+// writeOutFile writes the tidy version of a file to where -out-dir says,
+// with the same permissions, creating any directories that are needed.
+func writeOutFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	dst := outPaths[path]
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, data, info.Mode().Perm())
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+// outlineInput writes the outline of the input to w, with a line for each
+// heading and sectioning element, indented by how deeply it is nested.
+func outlineInput(w io.Writer, name, path string, in []byte) (fileStats, error) {
+	fs := fileStats{Path: name, BytesIn: len(in)}
+	in, _, err := decompress(in)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	opts, err := options(path)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	items, err := tidyhtml.Outline(bytes.NewReader(in), opts)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "%s:\n", name)
+	for _, item := range items {
+		buf.WriteString(strings.Repeat("  ", item.Depth+1))
+		buf.WriteString(item.Tag)
+		if item.Text != "" {
+			buf.WriteString(" " + item.Text)
+		}
+		buf.WriteByte('\n')
+	}
+	_, err = w.Write(buf.Bytes())
+	return fs, err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var progressFlag = flag.Bool("progress", false,
+	"show how many of the files have been done on stderr, and about how\n"+
+		"long is left")
+
+// How often the progress is redrawn on a terminal.
+const progressInterval = 100 * time.Millisecond
+
+// progress shows how far through the files a run is. On a terminal, one
+// line is redrawn as the files are done. Otherwise a line is written for
+// each tenth of the files, so that logs are not flooded.
+type progress struct {
+	w        io.Writer
+	terminal bool
+	total    int
+	done     int
+	start    time.Time
+	drawn    time.Time
+
+	// Whether a line is being shown on the terminal, and the number of
+	// tenths of the files that lines have been written for otherwise.
+	shown  bool
+	tenths int
+}
+
+func newProgress(total int) *progress {
+	info, err := os.Stderr.Stat()
+	return &progress{
+		w:        os.Stderr,
+		terminal: err == nil && info.Mode()&os.ModeCharDevice != 0,
+		total:    total,
+		start:    time.Now(),
+	}
+}
+
+// fileDone counts a file as done, and shows the progress if it is time to.
+func (p *progress) fileDone() {
+	p.done++
+	now := time.Now()
+	if p.terminal {
+		if p.done == p.total || now.Sub(p.drawn) >= progressInterval {
+			fmt.Fprintf(p.w, "\r\x1b[K%s", p.line(now))
+			p.drawn, p.shown = now, true
+		}
+		return
+	}
+	if tenths := p.done * 10 / p.total; tenths > p.tenths {
+		fmt.Fprintf(p.w, "%s\n", p.line(now))
+		p.tenths = tenths
+	}
+}
+
+// line returns the progress as text, such as
+// "1234/5000 files (24%), about 31s left".
+func (p *progress) line(now time.Time) string {
+	s := fmt.Sprintf("%d/%d files (%d%%)", p.done, p.total, p.done*100/p.total)
+	if elapsed := now.Sub(p.start); p.done < p.total && elapsed >= time.Second {
+		left := elapsed / time.Duration(p.done) * time.Duration(p.total-p.done)
+		s += fmt.Sprintf(", about %s left", left.Round(time.Second))
+	}
+	return s
+}
+
+// clear removes the line from the terminal, so that other output can be
+// written. It is drawn again with the next file.
+func (p *progress) clear() {
+	if p.shown {
+		fmt.Fprintf(p.w, "\r\x1b[K")
+		p.shown, p.drawn = false, time.Time{}
+	}
+}
+
+// finish leaves the last line on the terminal.
+func (p *progress) finish() {
+	if p.shown {
+		fmt.Fprintf(p.w, "\n")
+		p.shown = false
+	}
+}
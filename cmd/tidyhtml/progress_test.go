@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	out := bytes.Buffer{}
+	p := &progress{w: &out, total: 20, start: time.Now()}
+	for i := 0; i < 20; i++ {
+		p.fileDone()
+	}
+	p.finish()
+	want := ""
+	for _, line := range []string{"2/20 files (10%)", "4/20 files (20%)", "6/20 files (30%)", "8/20 files (40%)",
+		"10/20 files (50%)", "12/20 files (60%)", "14/20 files (70%)", "16/20 files (80%)", "18/20 files (90%)",
+		"20/20 files (100%)"} {
+		want += line + "\n"
+	}
+	if out.String() != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, out.String())
+	}
+
+	p = &progress{total: 10, done: 4, start: time.Now().Add(-4 * time.Second)}
+	if got, want := p.line(time.Now()), "4/10 files (40%), about 6s left"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/raymondbutcher/tidyhtml/internal/diff"
+)
+
+var formatFlag = flag.String("format", "text",
+	"with lint or -check, how to print the problems found: text, json for\n"+
+		"a JSON object on each line, github for GitHub Actions annotations,\n"+
+		"or sarif for a SARIF 2.1 log of all of the files")
+
+// diagnostic is a problem found in a file, as printed by the formats other
+// than text.
+type diagnostic struct {
+	File     string         `json:"file"`
+	Line     int            `json:"line"`
+	Column   int            `json:"column"`
+	Rule     string         `json:"rule"`
+	Severity string         `json:"severity"`
+	Message  string         `json:"message"`
+	Fix      *diagnosticFix `json:"fix,omitempty"`
+}
+
+// diagnosticFix is a change which fixes a problem, by replacing a number
+// of lines starting at a line with some text.
+type diagnosticFix struct {
+	Line  int    `json:"line"`
+	Lines int    `json:"lines"`
+	Text  string `json:"text"`
+}
+
+// diagnostics are the problems found in the files, in the order that the
+// files were processed.
+var diagnostics []diagnostic
+
+// untidyDiagnostics returns a diagnostic for each change that tidying
+// makes, with the tidy lines as the fix.
+func untidyDiagnostics(name string, in, out []byte) []diagnostic {
+	var ds []diagnostic
+	for _, c := range diff.Changes(in, out) {
+		ds = append(ds, diagnostic{
+			File:     name,
+			Line:     c.Line,
+			Column:   1,
+			Rule:     "tidy",
+			Severity: "error",
+			Message:  "not tidy",
+			Fix:      &diagnosticFix{c.Line, c.Lines, string(c.Text)},
+		})
+	}
+	return ds
+}
+
+// writeDiagnostics writes the diagnostics for a file to w, in the format
+// given by -format if it is one that reports each file on its own.
+func writeDiagnostics(w io.Writer, ds []diagnostic) error {
+	if *formatFlag == "github" {
+		for _, d := range ds {
+			if _, err := io.WriteString(w, githubAnnotation(d)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if *formatFlag != "json" {
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, d := range ds {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printReport writes the diagnostics to w in the format given by -format,
+// if it is one that reports all of the files together.
+func printReport(w io.Writer) error {
+	if *formatFlag != "sarif" {
+		return nil
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog(diagnostics))
+}
+
+// validFormat reports whether -format is a known format.
+func validFormat() bool {
+	switch *formatFlag {
+	case "text", "json", "github", "sarif":
+		return true
+	}
+	return false
+}
+
+// githubLevels maps the severities of findings to the GitHub Actions
+// workflow commands for annotations.
+var githubLevels = map[string]string{
+	"error":   "error",
+	"warning": "warning",
+	"info":    "notice",
+}
+
+var (
+	githubMessageEscaper  = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// githubAnnotation returns the workflow command which makes GitHub Actions
+// show a diagnostic as an annotation on the line where it was found.
+func githubAnnotation(d diagnostic) string {
+	props := "file=" + githubPropertyEscaper.Replace(filepath.ToSlash(d.File))
+	if d.Line > 0 {
+		props += fmt.Sprintf(",line=%d", d.Line)
+		if d.Column > 0 {
+			props += fmt.Sprintf(",col=%d", d.Column)
+		}
+	}
+	if d.Fix != nil && d.Fix.Lines > 1 {
+		props += fmt.Sprintf(",endLine=%d", d.Fix.Line+d.Fix.Lines-1)
+	}
+	props += ",title=" + githubPropertyEscaper.Replace("tidyhtml ("+d.Rule+")")
+	return fmt.Sprintf("::%s %s::%s\n", githubLevels[d.Severity], props, githubMessageEscaper.Replace(d.Message))
+}
+
+// The parts of the SARIF 2.1.0 format that are used.
+type (
+	sarif struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool sarifTool `json:"tool"`
+		// The columns are counted in characters, rather than in the
+		// UTF-16 code units that SARIF counts by default.
+		ColumnKind string        `json:"columnKind"`
+		Results    []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID string `json:"id"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+)
+
+// sarifLevels maps the severities of findings to SARIF levels.
+var sarifLevels = map[string]string{
+	"error":   "error",
+	"warning": "warning",
+	"info":    "note",
+}
+
+// sarifLog returns a SARIF log with a result for each diagnostic.
+func sarifLog(ds []diagnostic) sarif {
+	seen := map[string]bool{}
+	driver := sarifDriver{
+		Name:           "tidyhtml",
+		InformationURI: "https://github.com/raymondbutcher/tidyhtml",
+		Rules:          []sarifRule{},
+	}
+	results := []sarifResult{}
+	for _, d := range ds {
+		if !seen[d.Rule] {
+			seen[d.Rule] = true
+			driver.Rules = append(driver.Rules, sarifRule{d.Rule})
+		}
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{filepath.ToSlash(d.File)}}
+		if d.Line > 0 {
+			loc.Region = &sarifRegion{d.Line, d.Column}
+		}
+		results = append(results, sarifResult{
+			RuleID:    d.Rule,
+			Level:     sarifLevels[d.Severity],
+			Message:   sarifMessage{d.Message},
+			Locations: []sarifLocation{{loc}},
+		})
+	}
+	sort.Slice(driver.Rules, func(i, j int) bool { return driver.Rules[i].ID < driver.Rules[j].ID })
+	return sarif{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{driver}, ColumnKind: "unicodeCodePoints", Results: results}},
+	}
+}
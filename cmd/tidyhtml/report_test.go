@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSARIFLog(t *testing.T) {
+	b, err := json.Marshal(sarifLog([]diagnostic{
+		{"a/b.html", 2, 5, "img-alt", "error", "missing alt", nil},
+		{"c.html", 0, 0, "doctype", "info", "no doctype", nil},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"$schema":"https://json.schemastore.org/sarif-2.1.0.json","version":"2.1.0","runs":[{"tool":{"driver":` +
+		`{"name":"tidyhtml","informationUri":"https://github.com/raymondbutcher/tidyhtml","rules":[{"id":"doctype"},{"id":"img-alt"}]}},` +
+		`"columnKind":"unicodeCodePoints","results":[{"ruleId":"img-alt","level":"error","message":{"text":"missing alt"},"locations":[{"physicalLocation":` +
+		`{"artifactLocation":{"uri":"a/b.html"},"region":{"startLine":2,"startColumn":5}}}]},` +
+		`{"ruleId":"doctype","level":"note","message":{"text":"no doctype"},"locations":[{"physicalLocation":` +
+		`{"artifactLocation":{"uri":"c.html"}}}]}]}]}`
+	if string(b) != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, b)
+	}
+}
+
+func TestSARIFColumns(t *testing.T) {
+	// The columns of the findings are counted in characters, as the log
+	// says, and not in bytes or UTF-16 code units.
+	defer func(f string) { *formatFlag = f }(*formatFlag)
+	*formatFlag = "sarif"
+	fs, err := lintInput(ioutil.Discard, "a.html", "", []byte("<p>é 😀 <img src=x></p>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := sarifLog(fs.diagnostics)
+	for _, r := range log.Runs[0].Results {
+		if r.RuleID == "img-alt" {
+			if got := r.Locations[0].PhysicalLocation.Region.StartColumn; got != 8 {
+				t.Errorf("Expected the <img> to be at column 8, got %d", got)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected an img-alt result, got %+v", log.Runs[0].Results)
+}
+
+func TestUntidyDiagnostics(t *testing.T) {
+	defer func(f string) { *formatFlag = f }(*formatFlag)
+	*formatFlag = "json"
+	ds := untidyDiagnostics("a.html", []byte("<ul>\n<li>a</li>\n</ul>\n"), []byte("<ul>\n    <li>a</li>\n</ul>\n"))
+	buf := bytes.Buffer{}
+	if err := writeDiagnostics(&buf, ds); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"file":"a.html","line":2,"column":1,"rule":"tidy","severity":"error","message":"not tidy",` +
+		`"fix":{"line":2,"lines":1,"text":"    <li>a</li>\n"}}` + "\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, buf.String())
+	}
+}
+
+func TestGitHubAnnotation(t *testing.T) {
+	got := githubAnnotation(diagnostic{"a,b.html", 3, 1, "tidy", "error", "not tidy\n100%", &diagnosticFix{3, 2, ""}})
+	want := "::error file=a%2Cb.html,line=3,col=1,endLine=4,title=tidyhtml (tidy)::not tidy%0A100%25\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	got = githubAnnotation(diagnostic{"a.html", 0, 0, "doctype", "info", "missing", nil})
+	want = "::notice file=a.html,title=tidyhtml (doctype)::missing\n"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
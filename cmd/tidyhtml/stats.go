@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	statsFlag = flag.Bool("stats", false,
+		"print a summary of the run to stderr")
+	statsJSONFlag = flag.Bool("stats-json", false,
+		"print a summary of the run and statistics for each file\n"+
+			"to stderr as JSON")
+)
+
+// fileStats are the statistics for one file.
+type fileStats struct {
+	Path     string `json:"path"`
+	Changed  bool   `json:"changed"`
+	BytesIn  int    `json:"bytes_in"`
+	BytesOut int    `json:"bytes_out"`
+	Error    string `json:"error,omitempty"`
+
+	// The problems found in the file, for -format.
+	diagnostics []diagnostic
+}
+
+// runStats are the statistics for a run. Checked counts every file that
+// was tidied or failed, and Skipped counts the files and directories that
+// did not match when walking directories.
+type runStats struct {
+	Checked  int         `json:"checked"`
+	Changed  int         `json:"changed"`
+	Skipped  int         `json:"skipped"`
+	Errors   int         `json:"errors"`
+	BytesIn  int         `json:"bytes_in"`
+	BytesOut int         `json:"bytes_out"`
+	Elapsed  float64     `json:"elapsed_seconds"`
+	Files    []fileStats `json:"files"`
+}
+
+var (
+	stats     = runStats{Files: []fileStats{}}
+	startTime = time.Now()
+)
+
+// add adds the statistics for a file to the run.
+func (s *runStats) add(fs fileStats, err error) {
+	s.Checked++
+	if fs.Changed {
+		s.Changed++
+	}
+	if err != nil {
+		s.Errors++
+		fs.Error = err.Error()
+	}
+	s.BytesIn += fs.BytesIn
+	s.BytesOut += fs.BytesOut
+	s.Files = append(s.Files, fs)
+	diagnostics = append(diagnostics, fs.diagnostics...)
+}
+
+// printStats prints the statistics for the run when asked to by the flags.
+func printStats() {
+	stats.Elapsed = time.Since(startTime).Seconds()
+	switch {
+	case *statsJSONFlag:
+		b, _ := json.MarshalIndent(stats, "", "  ")
+		fmt.Fprintf(os.Stderr, "%s\n", b)
+	case *statsFlag:
+		fmt.Fprintf(os.Stderr, "%d checked, %d changed, %d skipped, %d errors, %d bytes in, %d bytes out, in %s\n",
+			stats.Checked, stats.Changed, stats.Skipped, stats.Errors,
+			stats.BytesIn, stats.BytesOut, time.Since(startTime).Round(time.Millisecond))
+	}
+}
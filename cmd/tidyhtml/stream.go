@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+var streamFlag = flag.Bool("stream", false,
+	"format the HTML as it is read instead of parsing it all first, which\n"+
+		"uses less memory for very large files but is less exact")
+
+// canStream reports whether the input can be tidied straight to the
+// output with -stream, without reading all of it into memory first.
+func canStream() bool {
+	return *streamFlag && subcommand == "" && !*diffFlag && !*checkFlag && !*listFilesFlag &&
+		!*writeFlag && *outDirFlag == ""
+}
+
+// streamStdin tidies stdin to stdout with -stream.
+func streamStdin(name, path string) (fileStats, error) {
+	return streamInput(os.Stdout, name, path, os.Stdin)
+}
+
+// streamFile tidies a file to w with -stream.
+func streamFile(w io.Writer, path string) (fileStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileStats{Path: path}, err
+	}
+	defer f.Close()
+	return streamInput(w, path, path, f)
+}
+
+// streamInput tidies the input from r to w with -stream, as process does,
+// but as it is read. Gzip input is decompressed as it is read too. Input
+// that looks like zlib data is read all at once and processed as usual,
+// as some text looks the same, and can only be told apart by failing to
+// decompress it.
+func streamInput(w io.Writer, name, path string, r io.Reader) (fileStats, error) {
+	fs := fileStats{Path: name}
+	in := &countingReader{r: r}
+	br := bufio.NewReader(in)
+	var src io.Reader = br
+	head, _ := br.Peek(2)
+	switch detectCompression(head) {
+	case zlibCompressed:
+		b, err := ioutil.ReadAll(br)
+		if err != nil {
+			return fs, err
+		}
+		return process(w, name, path, b)
+	case gzipCompressed:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fs, fmt.Errorf("%s: %s", name, err)
+		}
+		defer zr.Close()
+		src = zr
+	}
+	opts, err := options(path)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	out := &countingWriter{w: w}
+	err = tidyhtml.CopyStream(out, src, opts)
+	fs.BytesIn, fs.BytesOut = in.n, out.n
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	return fs, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+// structureInput writes a report of the structure of the input to w.
+func structureInput(w io.Writer, name, path string, in []byte) (fileStats, error) {
+	fs := fileStats{Path: name, BytesIn: len(in)}
+	in, _, err := decompress(in)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	opts, err := options(path)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	s, err := tidyhtml.Analyze(bytes.NewReader(in), opts)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+
+	buf := bytes.Buffer{}
+	total := 0
+	for _, n := range s.Elements {
+		total += n
+	}
+	fmt.Fprintf(&buf, "%s:\n", name)
+	fmt.Fprintf(&buf, "  elements: %d, max depth: %d\n", total, s.MaxDepth)
+	fmt.Fprintf(&buf, "  text: %d bytes, markup: %d bytes, %.1f%% text\n",
+		s.TextBytes, s.MarkupBytes, s.TextRatio()*100)
+	fmt.Fprintf(&buf, "  inline scripts: %d, inline styles: %d, style attributes: %d\n",
+		s.InlineScripts, s.InlineStyles, s.StyleAttrs)
+	writeCounts(&buf, "element", s.Elements)
+	writeCounts(&buf, "attribute", s.Attributes)
+	_, err = w.Write(buf.Bytes())
+	return fs, err
+}
+
+// writeCounts writes counts by name, with the most frequent first.
+func writeCounts(w io.Writer, kind string, counts map[string]int) {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s %s: %d\n", kind, name, counts[name])
+	}
+}
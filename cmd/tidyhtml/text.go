@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+var textFlag = flag.Bool("text", false,
+	"print only the visible text of each input instead of tidying it,\n"+
+		"with link targets in brackets")
+
+// textInput writes the visible text of the input to w.
+func textInput(w io.Writer, name, path string, in []byte) (fileStats, error) {
+	fs := fileStats{Path: name, BytesIn: len(in)}
+	in, _, err := decompress(in)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	opts, err := options(path)
+	if err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	out := bytes.Buffer{}
+	if err := tidyhtml.PlainText(&out, bytes.NewReader(in), opts); err != nil {
+		return fs, fmt.Errorf("%s: %s", name, err)
+	}
+	fs.BytesOut = out.Len()
+	_, err = w.Write(out.Bytes())
+	return fs, err
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// listFlag is a flag that can be given more than once,
+// and that accepts comma separated values.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+var (
+	extFlag     listFlag
+	includeFlag listFlag
+	excludeFlag listFlag
+)
+
+// Files with these extensions are tidied when walking
+// directories, unless the -ext flag is used.
+var defaultExts = []string{".html", ".htm"}
+
+func init() {
+	flag.Var(&extFlag, "ext",
+		"file extensions to tidy when walking directories,\n"+
+			"comma separated (default .html,.htm)")
+	flag.Var(&includeFlag, "include",
+		"only tidy files matching this glob pattern when walking directories\n"+
+			"(may be repeated)")
+	flag.Var(&excludeFlag, "exclude",
+		"skip files and directories matching this glob pattern\n"+
+			"when walking directories (may be repeated)")
+}
+
+// walk calls visit for the file at root, or for the matching files
+// within it when it is a directory. It returns the number of files and
+// directories that were skipped because they did not match.
+func walk(root string, visit func(path string) error) (skipped int, err error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		if !isChanged(root, false) {
+			return 1, nil
+		}
+		return 0, visit(root)
+	}
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		ok, err := shouldWalk(root, path, info.IsDir())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			skipped++
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return visit(path)
+	})
+	return skipped, err
+}
+
+// shouldWalk reports whether a file or directory found within root should
+// be tidied or descended into, based on the flags, the config file, the
+// ignore files and -changed.
+func shouldWalk(root, path string, dir bool) (bool, error) {
+	if !isChanged(path, dir) {
+		return false, nil
+	}
+	c, err := findConfig(path)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false, err
+	}
+
+	if matchAny(excludeFlag, rel) {
+		return false, nil
+	}
+	if c != nil && matchAny(c.Exclude, configRel(c, path)) {
+		return false, nil
+	}
+	if ignored, err := isIgnored(path, dir); err != nil || ignored {
+		return false, err
+	}
+	if dir {
+		return true, nil
+	}
+
+	exts := defaultExts
+	if len(extFlag) != 0 {
+		exts = extFlag
+	} else if c != nil && c.Set["ext"] {
+		exts = c.Ext
+	}
+	if !hasExt(path, exts) {
+		return false, nil
+	}
+
+	if len(includeFlag) != 0 {
+		return matchAny(includeFlag, rel), nil
+	}
+	if c != nil && len(c.Include) != 0 {
+		return matchAny(c.Include, configRel(c, path)), nil
+	}
+	return true, nil
+}
+
+// matchAny reports whether a path, relative to the directory being
+// walked, matches any of the glob patterns. Patterns containing a slash
+// are matched against the whole path, and other patterns are matched
+// against the last element of the path.
+func matchAny(patterns []string, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	for _, p := range patterns {
+		name := rel
+		if !strings.Contains(p, "/") {
+			name = filepath.Base(rel)
+		}
+		if ok, _ := filepath.Match(strings.TrimSuffix(p, "/"), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExt(path string, exts []string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range exts {
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
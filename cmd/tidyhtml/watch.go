@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	watchFlag = flag.Bool("watch", false,
+		"keep running, and tidy files in place whenever they change")
+	watchIntervalFlag = flag.Duration("watch-interval", 250*time.Millisecond,
+		"how often -watch checks the files for changes")
+)
+
+// How long a file must stay the same before it is tidied,
+// so that it is not read while an editor is still saving it.
+const watchDebounce = 100 * time.Millisecond
+
+// fileState is used to tell when a file has changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watch checks the files found in the roots for changes, and tidies them
+// whenever they change. It prints a line for each file that it tidies. It
+// works by checking the files regularly, so it has no dependencies on the
+// operating system, and never returns.
+//
+// Each check walks the roots again and stats every file within them, so
+// the cost grows with the number of files, however few of them change.
+// For large trees, -watch-interval can be made longer to check less often.
+func watch(roots []string) {
+	fmt.Fprintf(os.Stderr, "Watching for changes...\n")
+	known := scan(roots)
+	pending := map[string]time.Time{}
+	for {
+		time.Sleep(*watchIntervalFlag)
+
+		now := time.Now()
+		current := scan(roots)
+		for path, state := range current {
+			if prev, ok := known[path]; !ok || prev != state {
+				pending[path] = now
+			}
+		}
+		known = current
+
+		for path, since := range pending {
+			if now.Sub(since) < watchDebounce {
+				continue
+			}
+			delete(pending, path)
+			if _, ok := known[path]; !ok {
+				// The file was deleted.
+				continue
+			}
+			watchEvent(path)
+			known[path] = statFile(path)
+		}
+	}
+}
+
+// watchEvent tidies a file that has changed, and prints a summary line.
+func watchEvent(path string) {
+	start := time.Now()
+	fs, err := processFile(os.Stdout, path)
+	stamp := start.Format("15:04:05")
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "%s Error: %s\n", stamp, err)
+	case fs.Changed:
+		fmt.Fprintf(os.Stderr, "%s %s: tidied (%s)\n", stamp, path, time.Since(start).Round(time.Millisecond))
+	default:
+		fmt.Fprintf(os.Stderr, "%s %s: already tidy\n", stamp, path)
+	}
+}
+
+// scan finds the state of the files in the roots.
+func scan(roots []string) map[string]fileState {
+	files := map[string]fileState{}
+	for _, root := range roots {
+		walk(root, func(path string) error {
+			files[path] = statFile(path)
+			return nil
+		})
+	}
+	return files
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// backupFlag is the suffix for backup files, which can be given as
+// -backup=suffix, or as just -backup to use the default suffix.
+type backupFlag string
+
+const defaultBackupSuffix = ".orig"
+
+func (b *backupFlag) String() string { return string(*b) }
+
+func (b *backupFlag) IsBoolFlag() bool { return true }
+
+func (b *backupFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*b = defaultBackupSuffix
+	case "false":
+		*b = ""
+	default:
+		*b = backupFlag(value)
+	}
+	return nil
+}
+
+var backupSuffix backupFlag
+
+func init() {
+	flag.Var(&backupSuffix, "backup",
+		"when writing files in place, first copy the original to a backup\n"+
+			"file with this suffix (-backup on its own uses "+defaultBackupSuffix+")")
+}
+
+// writeFile replaces the contents of a file, keeping its permissions.
+// The data is written to a temporary file in the same directory, which is
+// then renamed over the original, so the file is never partially written.
+// With -backup, the original is copied to a backup file first.
+func writeFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if backupSuffix != "" {
+		orig, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path+string(backupSuffix), orig, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(info.Mode().Perm()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
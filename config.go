@@ -0,0 +1,526 @@
+package tidyhtml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigFileNames are the names of project config files,
+// in the order that they are looked for.
+var ConfigFileNames = []string{".tidyhtml.yaml", ".tidyhtml.yml", "tidyhtml.toml", ".tidyhtml.toml"}
+
+// Config is a project configuration, read from a config file.
+//
+// Config files contain simple keys and values, written in either YAML or
+// TOML depending on the file extension. For example, in .tidyhtml.yaml:
+//
+//	indent: 2
+//	template: jinja
+//	exclude: [vendor, "*.min.html"]
+//
+// Or in tidyhtml.toml:
+//
+//	indent = "tab"
+//	template = "jinja"
+//	exclude = ["vendor", "*.min.html"]
+//
+// The keys are:
+//
+//	profile                a preset bundle of options, as for ApplyProfile,
+//	                       which the other keys take precedence over
+//	indent                 number of spaces, or "tab"
+//	fragment               true or false
+//	context                the element that fragments are parsed within
+//	preserve_structure     true or false
+//	template               a template language, as for ParseTemplateMode
+//	framework_attrs        attribute name prefixes, or true for the defaults
+//	charset                the character encoding of the input
+//	meta_charset           true or false
+//	organize_head          true or false
+//	bom                    remove, keep or add, as for ParseBOMMode
+//	control_chars          keep, remove or escape, as for ParseControlChars
+//	rename                 element renames, as for ParseRenames
+//	element_formats        element formats, as for ParseElementFormats
+//	sanitize               true or false
+//	sanitize_elements      elements that sanitize removes
+//	remove_empty           true or false
+//	remove_empty_selector  a CSS selector for RemoveEmptySelector
+//	only_selector          a CSS selector for OnlySelector
+//	exclude_selector       a CSS selector for ExcludeSelector
+//	verbatim_elements      elements to write as they were in the input
+//	tidy_attr              the attribute for TidyAttr, or "-" for none
+//	srcdoc                 true or false, for TidySrcdoc
+//	minify                 true or false
+//	collapse               true or false, for CollapseWhitespace
+//	blank_line_before      CSS selectors for elements to put a blank line
+//	                       before, such as [h2, section]
+//	blank_line_after       the same, for a blank line after
+//	escape_nbsp            true or false
+//	nfc                    true or false, for NFC
+//	sort_attributes        true or false
+//	break_after_br         true or false
+//	compact_table_width    the longest table row to write on one line
+//	wrap_attr_width        the width to break list attribute values at
+//	max_depth              how deeply elements can be nested, for MaxDepth
+//	safe_whitespace        true or false
+//	omit_end_tags          true or false
+//	namespace_prefixes     true or false
+//	amp                    true or false
+//	self_closing           none, always-void or preserve-input, as for
+//	                       ParseSelfClosingStyle
+//	ext                    file extensions to tidy when walking directories
+//	include                glob patterns of files to tidy
+//	exclude                glob patterns of files and directories to skip
+type Config struct {
+
+	// Path is the config file that was loaded.
+	Path string
+
+	// Options are the tidyhtml options from the config file.
+	Options Options
+
+	// Ext, Include and Exclude control which files are tidied by tools
+	// that walk directories. Patterns are relative to the directory
+	// containing the config file.
+	Ext, Include, Exclude []string
+
+	// Set contains the keys that were set in the config file.
+	Set map[string]bool
+
+	// Functions that set the options from the config file.
+	setters []func(*Options)
+}
+
+// Apply sets the options that were set in the config file, leaving
+// the others as they are, and returns the result.
+func (c *Config) Apply(opts Options) Options {
+	for _, f := range c.setters {
+		f(&opts)
+	}
+	return opts
+}
+
+// FindConfig looks for a config file in dir and then each of its parent
+// directories, and loads the first one that it finds. It returns nil if
+// there is no config file.
+func FindConfig(dir string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		for _, name := range ConfigFileNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return LoadConfig(path)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig loads a config file.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseConfig(b, filepath.Ext(path) == ".toml")
+	if err != nil {
+		return nil, fmt.Errorf("%s:%s", path, err)
+	}
+	c.Path = path
+	return c, nil
+}
+
+// ParseConfig parses the contents of a config file, which is YAML unless
+// toml is true. Errors are prefixed with the line number they are on.
+func ParseConfig(b []byte, toml bool) (*Config, error) {
+	c := &Config{Set: map[string]bool{}}
+	sep := ":"
+	if toml {
+		sep = "="
+	}
+
+	// The key of a YAML list that is written one item per line.
+	listKey, listLine := "", 0
+	var list []string
+
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(stripComment(s.Text()))
+		if text == "" {
+			continue
+		}
+
+		if listKey != "" {
+			if strings.HasPrefix(text, "- ") || text == "-" {
+				list = append(list, unquote(strings.TrimSpace(text[1:])))
+				continue
+			}
+			if err := c.set(listKey, configValue{list: list, isList: true}); err != nil {
+				return nil, fmt.Errorf("%d: %s", listLine, err)
+			}
+			listKey, list = "", nil
+		}
+
+		i := strings.Index(text, sep)
+		if i == -1 {
+			return nil, fmt.Errorf("%d: expected key%svalue", line, sep)
+		}
+		key := strings.TrimSpace(text[:i])
+		raw := strings.TrimSpace(text[i+1:])
+		if raw == "" && !toml {
+			listKey, listLine = key, line
+			continue
+		}
+		if err := c.set(key, parseValue(raw)); err != nil {
+			return nil, fmt.Errorf("%d: %s", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if listKey != "" {
+		if err := c.set(listKey, configValue{list: list, isList: true}); err != nil {
+			return nil, fmt.Errorf("%d: %s", listLine, err)
+		}
+	}
+	return c, nil
+}
+
+// ConfigFromValues returns a config with the keys set to values, as if
+// they were read from a config file, for callers such as JavaScript that
+// have options as decoded JSON rather than as a file. The values can be
+// strings, booleans, numbers, or lists of them, and the keys are set in
+// order of their names.
+func ConfigFromValues(values map[string]interface{}) (*Config, error) {
+	c := &Config{Set: map[string]bool{}}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var v configValue
+		switch value := values[key].(type) {
+		case []interface{}:
+			v.isList = true
+			for _, item := range value {
+				s, ok := scalarValue(item)
+				if !ok {
+					return nil, fmt.Errorf("%s: expected a list of strings, booleans or numbers", key)
+				}
+				v.list = append(v.list, s)
+			}
+		case []string:
+			v = configValue{list: value, isList: true}
+		default:
+			s, ok := scalarValue(value)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a string, boolean, number or list", key)
+			}
+			v.str = s
+		}
+		if err := c.set(key, v); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// scalarValue returns a value from decoded JSON as it would be written
+// in a config file.
+func scalarValue(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case bool:
+		return strconv.FormatBool(value), true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(value), true
+	}
+	return "", false
+}
+
+type configValue struct {
+	str    string
+	list   []string
+	isList bool
+}
+
+func (v configValue) strings() []string {
+	if v.isList {
+		return v.list
+	}
+	return []string{v.str}
+}
+
+func parseValue(raw string) configValue {
+	if strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]") {
+		v := configValue{isList: true}
+		for _, item := range splitList(raw[1 : len(raw)-1]) {
+			if item = strings.TrimSpace(item); item != "" {
+				v.list = append(v.list, unquote(item))
+			}
+		}
+		return v
+	}
+	return configValue{str: unquote(raw)}
+}
+
+// boolKeys are the keys for options that are true or false,
+// with the fields that they set.
+var boolKeys = map[string]func(*Options) *bool{
+	"fragment":           func(o *Options) *bool { return &o.Fragment },
+	"preserve_structure": func(o *Options) *bool { return &o.PreserveStructure },
+	"meta_charset":       func(o *Options) *bool { return &o.MetaCharset },
+	"organize_head":      func(o *Options) *bool { return &o.OrganizeHead },
+	"minify":             func(o *Options) *bool { return &o.Minify },
+	"collapse":           func(o *Options) *bool { return &o.CollapseWhitespace },
+	"escape_nbsp":        func(o *Options) *bool { return &o.EscapeNBSP },
+	"nfc":                func(o *Options) *bool { return &o.NFC },
+	"sort_attributes":    func(o *Options) *bool { return &o.SortAttributes },
+	"break_after_br":     func(o *Options) *bool { return &o.BreakAfterBR },
+	"safe_whitespace":    func(o *Options) *bool { return &o.SafeWhitespace },
+	"omit_end_tags":      func(o *Options) *bool { return &o.OmitEndTags },
+	"amp":                func(o *Options) *bool { return &o.AMP },
+	"namespace_prefixes": func(o *Options) *bool { return &o.NamespacePrefixes },
+	"sanitize":           func(o *Options) *bool { return &o.Sanitize },
+	"remove_empty":       func(o *Options) *bool { return &o.RemoveEmpty },
+	"srcdoc":             func(o *Options) *bool { return &o.TidySrcdoc },
+}
+
+func (c *Config) set(key string, v configValue) error {
+	c.Set[key] = true
+	var f func(*Options)
+	switch key {
+	case "profile":
+		name := v.str
+		if _, err := ApplyProfile(name, Options{}); err != nil {
+			return err
+		}
+		// The profile is applied first, so that the
+		// other keys take precedence over it.
+		f = func(o *Options) { *o, _ = ApplyProfile(name, *o) }
+		c.setters = append([]func(*Options){f}, c.setters...)
+		c.Options = c.Apply(Options{})
+		return nil
+	case "indent":
+		indent, err := ParseIndent(v.str)
+		if err != nil {
+			return err
+		}
+		f = func(o *Options) { o.Indent = indent }
+	case "context":
+		context := v.str
+		f = func(o *Options) { o.Context = context }
+	case "template":
+		m, err := ParseTemplateMode(v.str)
+		if err != nil {
+			return err
+		}
+		f = func(o *Options) { o.Template = m }
+	case "framework_attrs":
+		attrs := v.strings()
+		if b, err := strconv.ParseBool(v.str); err == nil && !v.isList {
+			attrs = nil
+			if b {
+				attrs = DefaultFrameworkAttrs
+			}
+		}
+		f = func(o *Options) { o.FrameworkAttrs = attrs }
+	case "charset":
+		name := v.str
+		f = func(o *Options) { o.Charset = name }
+	case "blank_line_before", "blank_line_after":
+		sel := strings.Join(v.strings(), ", ")
+		if _, err := parseSelector(sel); err != nil {
+			return err
+		}
+		if key == "blank_line_before" {
+			f = func(o *Options) { o.BlankLineBefore = sel }
+		} else {
+			f = func(o *Options) { o.BlankLineAfter = sel }
+		}
+	case "compact_table_width":
+		n, err := strconv.Atoi(v.str)
+		if err != nil || n < 0 {
+			return fmt.Errorf("compact_table_width must be a number of characters")
+		}
+		f = func(o *Options) { o.CompactTableWidth = n }
+	case "wrap_attr_width":
+		n, err := strconv.Atoi(v.str)
+		if err != nil || n < 0 {
+			return fmt.Errorf("wrap_attr_width must be a number of characters")
+		}
+		f = func(o *Options) { o.WrapAttrWidth = n }
+	case "max_depth":
+		n, err := strconv.Atoi(v.str)
+		if err != nil || n < 0 {
+			return fmt.Errorf("max_depth must be a number of elements")
+		}
+		f = func(o *Options) { o.MaxDepth = n }
+	case "self_closing":
+		style, err := ParseSelfClosingStyle(v.str)
+		if err != nil {
+			return err
+		}
+		f = func(o *Options) { o.SelfClosing = style }
+	case "control_chars":
+		m, err := ParseControlChars(v.str)
+		if err != nil {
+			return err
+		}
+		f = func(o *Options) { o.ControlChars = m }
+	case "bom":
+		m, err := ParseBOMMode(v.str)
+		if err != nil {
+			return err
+		}
+		f = func(o *Options) { o.BOM = m }
+	case "rename":
+		renames, err := ParseRenames(strings.Join(v.strings(), ","))
+		if err != nil {
+			return err
+		}
+		f = func(o *Options) { o.RenameElements = renames }
+	case "element_formats":
+		formats, err := ParseElementFormats(strings.Join(v.strings(), ","))
+		if err != nil {
+			return err
+		}
+		f = func(o *Options) { o.ElementFormats = formats }
+	case "sanitize_elements":
+		names := v.strings()
+		f = func(o *Options) { o.SanitizeElements = names }
+	case "remove_empty_selector":
+		sel := v.str
+		if _, err := parseSelector(sel); err != nil {
+			return err
+		}
+		f = func(o *Options) { o.RemoveEmptySelector = sel }
+	case "only_selector":
+		sel := v.str
+		if _, err := parseSelector(sel); err != nil {
+			return err
+		}
+		f = func(o *Options) { o.OnlySelector = sel }
+	case "exclude_selector":
+		sel := v.str
+		if _, err := parseSelector(sel); err != nil {
+			return err
+		}
+		f = func(o *Options) { o.ExcludeSelector = sel }
+	case "verbatim_elements":
+		names := v.strings()
+		f = func(o *Options) { o.VerbatimElements = names }
+	case "tidy_attr":
+		name := v.str
+		f = func(o *Options) { o.TidyAttr = name }
+	case "ext":
+		c.Ext = v.strings()
+	case "include":
+		c.Include = v.strings()
+	case "exclude":
+		c.Exclude = v.strings()
+	default:
+		field, ok := boolKeys[key]
+		if !ok {
+			return fmt.Errorf("unknown key: %q", key)
+		}
+		b, err := strconv.ParseBool(v.str)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+		f = func(o *Options) { *field(o) = b }
+	}
+	if f != nil {
+		f(&c.Options)
+		c.setters = append(c.setters, f)
+	}
+	return nil
+}
+
+// ParseIndent returns the indentation for a number of spaces, or "tab".
+func ParseIndent(s string) (string, error) {
+	if s == "tab" {
+		return "\t", nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("tidyhtml: indent must be a number of spaces, or \"tab\": %q", s)
+	}
+	return strings.Repeat(" ", n), nil
+}
+
+// stripComment removes a # comment from the end of a line, unless it is
+// within quotes. As in YAML, a # only starts a comment at the start of the
+// line or after whitespace, so values such as color#1 or a URL with a
+// fragment are kept.
+func stripComment(s string) string {
+	var quote rune
+	prev := ' '
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (prev == ' ' || prev == '\t'):
+			return s[:i]
+		}
+		prev = r
+	}
+	return s
+}
+
+// splitList splits the items of a list on commas,
+// unless they are within quotes.
+func splitList(s string) (items []string) {
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 {
+		switch {
+		case s[0] == '"' && s[len(s)-1] == '"':
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+		case s[0] == '\'' && s[len(s)-1] == '\'':
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
@@ -0,0 +1,197 @@
+package tidyhtml
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	yaml := `
+# comment
+indent: 2
+template: jinja
+framework_attrs: true
+exclude: [vendor, "*.min.html"]
+ext:
+  - html
+  - 'tmpl' # templates
+`
+	toml := `
+indent = 2
+template = "jinja"
+framework_attrs = true
+exclude = ["vendor", "*.min.html"]
+ext = ["html", "tmpl"]
+`
+	for _, c := range []struct {
+		src  string
+		toml bool
+	}{{yaml, false}, {toml, true}} {
+		got, err := ParseConfig([]byte(c.src), c.toml)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Options{Indent: "  ", Template: Jinja, FrameworkAttrs: DefaultFrameworkAttrs}
+		if !reflect.DeepEqual(got.Options, want) {
+			t.Errorf("Expected options %+v, got %+v", want, got.Options)
+		}
+		if !reflect.DeepEqual(got.Exclude, []string{"vendor", "*.min.html"}) {
+			t.Errorf("Unexpected exclude: %q", got.Exclude)
+		}
+		if !reflect.DeepEqual(got.Ext, []string{"html", "tmpl"}) {
+			t.Errorf("Unexpected ext: %q", got.Ext)
+		}
+	}
+}
+
+func TestParseConfigComments(t *testing.T) {
+	// A # only starts a comment at the start of a line or after whitespace.
+	got, err := ParseConfig([]byte("exclude: [color#1, page.html#top]\t# comment\nblank_line_before: h2#intro # x\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Exclude, []string{"color#1", "page.html#top"}) {
+		t.Errorf("Unexpected exclude: %q", got.Exclude)
+	}
+	if got.Options.BlankLineBefore != "h2#intro" {
+		t.Errorf("Unexpected blank_line_before: %q", got.Options.BlankLineBefore)
+	}
+}
+
+func TestParseConfigProfile(t *testing.T) {
+	got, err := ParseConfig([]byte("indent: 3\nprofile: prettier\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Options{Indent: "   ", FinalNewline: true, TrimTrailingSpace: true}
+	if !reflect.DeepEqual(got.Options, want) {
+		t.Errorf("Expected options %+v, got %+v", want, got.Options)
+	}
+	if opts := got.Apply(Options{LineEnding: "\r\n"}); opts.Indent != "   " || opts.LineEnding != "\r\n" {
+		t.Errorf("Unexpected options after Apply: %+v", opts)
+	}
+}
+
+func TestParseConfigBools(t *testing.T) {
+	for key, field := range boolKeys {
+		got, err := ParseConfig([]byte(key+": true\n"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Options{}
+		*field(&want) = true
+		if opts := got.Apply(Options{}); !reflect.DeepEqual(opts, want) {
+			t.Errorf("%s: expected options %+v, got %+v", key, want, opts)
+		}
+		if got, err = ParseConfig([]byte(key+": false\n"), false); err != nil {
+			t.Fatal(err)
+		}
+		if opts := got.Apply(want); *field(&opts) {
+			t.Errorf("%s: expected false to override true", key)
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for src, want := range map[string]string{
+		"indent: 2\nbogus: 1":    `2: unknown key: "bogus"`,
+		"indent: lots":           `1: tidyhtml: indent must be a number of spaces, or "tab": "lots"`,
+		"template: cobol":        `1: tidyhtml: unknown template mode: "cobol"`,
+		"profile: fancy":         `1: tidyhtml: unknown profile: "fancy"`,
+		"self_closing: xhtml":    `1: tidyhtml: unknown self-closing style: "xhtml"`,
+		"control_chars: strip":   `1: tidyhtml: unknown control characters mode: "strip"`,
+		"blank_line_before: h2[": `1: tidyhtml: invalid selector: "h2["`,
+		"\n\nfragment: sometime": `3: fragment must be true or false`,
+		"max_depth: -1":          `1: max_depth must be a number of elements`,
+		"sort_attributes: yes":   `1: sort_attributes must be true or false`,
+		"element_formats: a=b":   `1: tidyhtml: unknown element format: "b"`,
+	} {
+		_, err := ParseConfig([]byte(src), false)
+		if err == nil || err.Error() != want {
+			t.Errorf("Expected error %q, got %v", want, err)
+		}
+	}
+}
+
+func TestEditorConfigOptions(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, s string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".editorconfig", `root = true
+
+[*]
+indent_style = space
+indent_size = 2
+end_of_line = crlf
+
+[*.{html,htm}]
+insert_final_newline = true
+
+[lib/**.html]
+indent_style = tab
+`)
+	write("sub/.editorconfig", `
+[*.html]
+trim_trailing_whitespace = true
+`)
+
+	for path, want := range map[string]Options{
+		"a.txt":          {Indent: "  ", LineEnding: "\r\n"},
+		"a.html":         {Indent: "  ", LineEnding: "\r\n", FinalNewline: true},
+		"lib/x/y.html":   {Indent: "\t", LineEnding: "\r\n", FinalNewline: true},
+		"sub/page.html":  {Indent: "  ", LineEnding: "\r\n", FinalNewline: true, TrimTrailingSpace: true},
+		"sub/page.xhtml": {Indent: "  ", LineEnding: "\r\n"},
+	} {
+		got, err := EditorConfigOptions(filepath.Join(dir, path), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %+v, got %+v", path, want, got)
+		}
+	}
+}
+
+func TestConfigFromValues(t *testing.T) {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"indent": 2, "fragment": true, "rename": ["b=strong", "i=em"], "profile": "compact"}`), &values); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ConfigFromValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ApplyProfile("compact", Options{})
+	want.Indent = "  "
+	want.Fragment = true
+	want.RenameElements = map[string]string{"b": "strong", "i": "em"}
+	if !reflect.DeepEqual(c.Options, want) {
+		t.Errorf("Unexpected options:\n%+v\nExpected:\n%+v", c.Options, want)
+	}
+
+	for values, want := range map[string]string{
+		`{"bogus": 1}`:         `unknown key: "bogus"`,
+		`{"fragment": "yes"}`:  `fragment must be true or false`,
+		`{"indent": {"n": 2}}`: `indent: expected a string, boolean, number or list`,
+		`{"exclude": [null]}`:  `exclude: expected a list of strings, booleans or numbers`,
+	} {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(values), &m); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ConfigFromValues(m); err == nil || err.Error() != want {
+			t.Errorf("Expected error %q for %s, got %v", want, values, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package tidyhtml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ControlChars controls what is done with the control characters in text
+// and attribute values, such as NUL bytes and the other C0 controls,
+// which are allowed by parsers but break many of the tools that read
+// HTML. Tabs, line feeds, form feeds and carriage returns are whitespace
+// rather than control characters, and are never changed.
+type ControlChars int
+
+const (
+	// KeepControlChars writes control characters as they are.
+	KeepControlChars ControlChars = iota
+
+	// RemoveControlChars leaves out control characters.
+	RemoveControlChars
+
+	// EscapeControlChars writes control characters as character
+	// references, such as &#x1;, which are parsed back into the same
+	// characters. Raw text, such as the content of <script> elements,
+	// cannot have character references, so they are removed from it. NUL
+	// is written as U+FFFD, the replacement character, which is what it
+	// is parsed as.
+	EscapeControlChars
+)
+
+// ParseControlChars returns the control character mode with the given
+// name, which is one of "keep", "remove" or "escape".
+func ParseControlChars(name string) (ControlChars, error) {
+	switch strings.ToLower(name) {
+	case "keep":
+		return KeepControlChars, nil
+	case "remove":
+		return RemoveControlChars, nil
+	case "escape":
+		return EscapeControlChars, nil
+	}
+	return KeepControlChars, fmt.Errorf("tidyhtml: unknown control characters mode: %q", name)
+}
+
+// isControl reports whether r is a C0 control character, other than
+// whitespace, or DEL. The C1 controls are left alone, as character
+// references to them are parsed as the characters of windows-1252.
+func isControl(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' && r != '\f' && r != '\r' || r == 0x7f
+}
+
+// escapeControls removes or escapes the control characters in s, as set
+// by mode. With raw, s is raw text, from which they are always removed
+// instead of being escaped.
+func escapeControls(s string, mode ControlChars, raw bool) string {
+	if mode == KeepControlChars || strings.IndexFunc(s, isControl) == -1 {
+		return s
+	}
+	b := strings.Builder{}
+	for _, r := range s {
+		switch {
+		case !isControl(r):
+			b.WriteRune(r)
+		case mode == RemoveControlChars || raw:
+		case r == 0:
+			b.WriteRune('\uFFFD')
+		default:
+			b.WriteString("&#x" + strings.ToUpper(strconv.FormatInt(int64(r), 16)) + ";")
+		}
+	}
+	return b.String()
+}
+
+// escapeAttr escapes an attribute value, and its control characters as
+// set by the ControlChars option.
+func escapeAttr(s string, opts Options) string {
+	return escapeControls(html.EscapeString(s), opts.ControlChars, false)
+}
@@ -0,0 +1,21 @@
+package tidyhtml
+
+import (
+	"bytes"
+
+	"github.com/raymondbutcher/tidyhtml/internal/diff"
+)
+
+// ComputeDiff tidies src like CopyWithOptions, and returns a unified diff
+// of the changes that tidying makes, as printed by the -diff flag of the
+// command, and whether there were any. The name is used in the headers of
+// the diff, as name+".orig" for src and name for the tidy version. The
+// diff is empty if src is already tidy.
+func ComputeDiff(name string, src []byte, opts Options) ([]byte, bool, error) {
+	buf := bytes.Buffer{}
+	if err := CopyWithOptions(&buf, bytes.NewReader(src), opts); err != nil {
+		return nil, false, err
+	}
+	d := diff.Unified(name+".orig", name, src, buf.Bytes())
+	return d, d != nil, nil
+}
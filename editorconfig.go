@@ -0,0 +1,241 @@
+package tidyhtml
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EditorConfigOptions applies the .editorconfig settings for a file to
+// opts, and returns the result. The settings used are indent_style,
+// indent_size, tab_width, end_of_line, insert_final_newline and
+// trim_trailing_whitespace. See https://editorconfig.org for details.
+func EditorConfigOptions(path string, opts Options) (Options, error) {
+	props, err := editorConfig(path)
+	if err != nil {
+		return opts, err
+	}
+
+	size := props["indent_size"]
+	if size == "tab" || size == "" {
+		size = props["tab_width"]
+	}
+	switch props["indent_style"] {
+	case "tab":
+		opts.Indent = "\t"
+	case "space":
+		if n, err := strconv.Atoi(size); err == nil && n >= 0 {
+			opts.Indent = strings.Repeat(" ", n)
+		}
+	default:
+		if n, err := strconv.Atoi(props["indent_size"]); err == nil && n >= 0 {
+			opts.Indent = strings.Repeat(" ", n)
+		}
+	}
+
+	switch props["end_of_line"] {
+	case "lf":
+		opts.LineEnding = "\n"
+	case "crlf":
+		opts.LineEnding = "\r\n"
+	case "cr":
+		opts.LineEnding = "\r"
+	}
+
+	if b, err := strconv.ParseBool(props["insert_final_newline"]); err == nil {
+		opts.FinalNewline = b
+	}
+	if b, err := strconv.ParseBool(props["trim_trailing_whitespace"]); err == nil {
+		opts.TrimTrailingSpace = b
+	}
+	return opts, nil
+}
+
+// editorConfig returns the .editorconfig properties for a file. The files
+// closest to it take precedence, and so do later sections within a file.
+func editorConfig(path string) (map[string]string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the files from the closest one up to the root one.
+	var files []string
+	for dir := filepath.Dir(path); ; {
+		file := filepath.Join(dir, ".editorconfig")
+		root, err := editorConfigIsRoot(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+		parent := filepath.Dir(dir)
+		if root || parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	props := map[string]string{}
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := readEditorConfig(files[i], path, props); err != nil {
+			return nil, err
+		}
+	}
+	return props, nil
+}
+
+// editorConfigIsRoot reports whether a file exists and has root = true.
+func editorConfigIsRoot(file string) (bool, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if k, v, ok := editorConfigPair(line); ok && k == "root" {
+			return strings.EqualFold(v, "true"), nil
+		}
+	}
+	return false, s.Err()
+}
+
+// readEditorConfig adds the properties in file that apply to path.
+func readEditorConfig(file, path string, props map[string]string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir := filepath.ToSlash(filepath.Dir(file))
+	path = filepath.ToSlash(path)
+	matched := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			matched = editorConfigMatch(line[1:len(line)-1], dir, path)
+			continue
+		}
+		if k, v, ok := editorConfigPair(line); ok && matched {
+			props[k] = strings.ToLower(v)
+		}
+	}
+	return s.Err()
+}
+
+func editorConfigPair(line string) (key, value string, ok bool) {
+	i := strings.IndexByte(line, '=')
+	if i == -1 {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(line[:i]))
+	value = strings.TrimSpace(line[i+1:])
+	return key, value, true
+}
+
+// editorConfigMatch reports whether a section's glob matches a path.
+// Globs without a slash can match files in any directory below dir.
+func editorConfigMatch(glob, dir, path string) bool {
+	if !strings.Contains(glob, "/") {
+		glob = "**/" + glob
+	} else if !strings.HasPrefix(glob, "/") {
+		glob = "/" + glob
+	}
+	re, err := regexp.Compile("^" + regexp.QuoteMeta(dir) + editorConfigRegexp(strings.TrimPrefix(glob, "/")) + "$")
+	if err != nil {
+		return false
+	}
+	return re.MatchString(path)
+}
+
+// editorConfigRegexp converts an EditorConfig glob into a regular
+// expression. It supports *, **, ?, [...], {a,b} and {1..9}.
+func editorConfigRegexp(glob string) string {
+	out := strings.Builder{}
+	out.WriteString("/")
+	depth := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && strings.HasPrefix(glob[i:], "**/"):
+			out.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			out.WriteString(".*")
+			i++
+		case c == '*':
+			out.WriteString("[^/]*")
+		case c == '?':
+			out.WriteString("[^/]")
+		case c == '[':
+			if j := strings.IndexByte(glob[i:], ']'); j != -1 {
+				class := glob[i+1 : i+j]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				out.WriteString("[" + class + "]")
+				i += j
+			} else {
+				out.WriteString(`\[`)
+			}
+		case c == '{':
+			if j := strings.IndexByte(glob[i:], '}'); j != -1 {
+				if m := editorConfigRange.FindStringSubmatch(glob[i+1 : i+j]); m != nil {
+					out.WriteString(numberRange(m[1], m[2]))
+					i += j
+					continue
+				}
+			}
+			out.WriteString("(?:")
+			depth++
+		case c == '}' && depth > 0:
+			out.WriteString(")")
+			depth--
+		case c == ',' && depth > 0:
+			out.WriteString("|")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			out.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			out.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	for ; depth > 0; depth-- {
+		out.WriteString(")")
+	}
+	return out.String()
+}
+
+var editorConfigRange = regexp.MustCompile(`^(-?\d+)\.\.(-?\d+)$`)
+
+// numberRange returns a regular expression matching the
+// integers from a to b.
+func numberRange(a, b string) string {
+	lo, _ := strconv.Atoi(a)
+	hi, _ := strconv.Atoi(b)
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	nums := make([]string, 0, hi-lo+1)
+	for n := lo; n <= hi && len(nums) < 1000; n++ {
+		nums = append(nums, strconv.Itoa(n))
+	}
+	return "(?:" + strings.Join(nums, "|") + ")"
+}
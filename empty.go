@@ -0,0 +1,51 @@
+package tidyhtml
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements that are never removed for being empty, because they mean
+// something even when they are, or are needed by the document structure.
+var keepEmptyElements = map[string]bool{
+	"audio": true, "body": true, "canvas": true, "head": true,
+	"html": true, "iframe": true, "object": true, "option": true,
+	"script": true, "style": true, "td": true, "template": true,
+	"textarea": true, "th": true, "title": true, "tr": true,
+	"video": true,
+}
+
+// removeEmpty removes the elements within n that have no content other
+// than whitespace, and no attributes unless they match sel. Elements that
+// become empty when their children are removed are removed too. Inline
+// elements that contain whitespace are replaced by a space, so that the
+// words on either side of them stay apart.
+func removeEmpty(n *html.Node, sel selector) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		removeEmpty(c, sel)
+		if isRemovableEmpty(c, sel) {
+			if !blockElements[c.Data] && c.FirstChild != nil {
+				n.InsertBefore(&html.Node{Type: html.TextNode, Data: " "}, c)
+			}
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+func isRemovableEmpty(n *html.Node, sel selector) bool {
+	if n.Type != html.ElementNode || n.Namespace != "" || isVoid(n) || keepEmptyElements[n.Data] || isTemplateNode(n) {
+		return false
+	}
+	if len(n.Attr) != 0 && (sel == nil || !sel.match(n)) {
+		return false
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.TextNode || strings.Trim(c.Data, " \t\n\f\r") != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/raymondbutcher/tidyhtml/internal/diff"
+)
+
+// EqualHTML reports whether a and b are the same HTML, apart from the
+// whitespace that tidying changes and the order of their attributes, for
+// tests where comparing the exact bytes would fail over differences that
+// do not matter. Both are read and parsed as CopyWithOptions does with
+// opts, and tidied with their attributes sorted. When they are not the
+// same, the diff is a unified diff of the tidy versions, or else it is "".
+// The options for templates are not used.
+func EqualHTML(a, b io.Reader, opts Options) (bool, string, error) {
+	opts.FinalNewline = true
+	ta, err := sortedHTML(a, opts)
+	if err != nil {
+		return false, "", err
+	}
+	tb, err := sortedHTML(b, opts)
+	if err != nil {
+		return false, "", err
+	}
+	d := diff.Unified("a", "b", ta, tb)
+	return d == nil, string(d), nil
+}
+
+// sortedHTML returns a tidy version of the HTML in r, with the attributes
+// of each element sorted.
+func sortedHTML(r io.Reader, opts Options) ([]byte, error) {
+	b, err := readInput(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = toUTF8(b, opts); err != nil {
+		return nil, err
+	}
+	doc, err := parse(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	sortAttrs(doc)
+	buf := bytes.Buffer{}
+	err = Render(&buf, doc, opts)
+	return buf.Bytes(), err
+}
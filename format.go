@@ -0,0 +1,89 @@
+package tidyhtml
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ElementFormat overrides how the elements with a name are written, for
+// use with Options.ElementFormats. The zero value writes them as usual.
+type ElementFormat int
+
+const (
+	// DefaultFormat writes an element as to its kind and its content.
+	DefaultFormat ElementFormat = iota
+
+	// InlineFormat writes an element on the same line as its content and
+	// the elements next to it, as if it were text, instead of on a line
+	// of its own.
+	InlineFormat
+
+	// BlockFormat treats an element like a block element such as <div>,
+	// which the whitespace around is not displayed next to, so that it is
+	// put on a line of its own even with SafeWhitespace, unless it is
+	// within text. Custom elements that are styled as blocks can use it.
+	BlockFormat
+
+	// VerbatimFormat writes an element exactly as it was in the input,
+	// like ExcludeSelector.
+	VerbatimFormat
+
+	// PreFormat keeps the whitespace in an element as it is, like the
+	// content of a <pre>, while the element itself is indented as usual.
+	PreFormat
+
+	// CompactFormat writes an element on a single line with its content,
+	// like a table row with CompactTableWidth, when the line is no longer
+	// than CompactTableWidth, or DefaultCompactWidth if that is not set.
+	CompactFormat
+)
+
+// DefaultCompactWidth is the longest line that CompactFormat writes an
+// element on, when CompactTableWidth is not set.
+const DefaultCompactWidth = 80
+
+var elementFormatNames = map[string]ElementFormat{
+	"default":  DefaultFormat,
+	"inline":   InlineFormat,
+	"block":    BlockFormat,
+	"verbatim": VerbatimFormat,
+	"pre":      PreFormat,
+	"compact":  CompactFormat,
+}
+
+// ParseElementFormats parses element formats in the form
+// "x-icon=inline,math=verbatim". The formats are "default", "inline",
+// "block", "verbatim", "pre" and "compact".
+func ParseElementFormats(s string) (map[string]ElementFormat, error) {
+	formats := map[string]ElementFormat{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		i := strings.IndexByte(item, '=')
+		name, format := "", ""
+		if i != -1 {
+			name, format = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		if name == "" || format == "" {
+			return nil, fmt.Errorf("tidyhtml: invalid element format: %q, expected name=format", item)
+		}
+		f, ok := elementFormatNames[format]
+		if !ok {
+			return nil, fmt.Errorf("tidyhtml: unknown element format: %q", format)
+		}
+		formats[name] = f
+	}
+	return formats, nil
+}
+
+// elementFormat returns the format of n from formats.
+func elementFormat(n *html.Node, formats map[string]ElementFormat) ElementFormat {
+	if n == nil || n.Type != html.ElementNode || len(formats) == 0 {
+		return DefaultFormat
+	}
+	return formats[n.Data]
+}
@@ -0,0 +1,172 @@
+// Package goldentest tests code that produces HTML against golden files,
+// which are pairs of files such as demo.in.html, the input, and
+// demo.out.html, the output that is expected from it.
+//
+// For example, to test that the files in testdata are tidied as expected:
+//
+//	func TestTidy(t *testing.T) {
+//		goldentest.Run(t, "testdata", tidyhtml.Options{})
+//	}
+//
+// Each pair is run as a subtest named after it. When the output is not
+// the same as the .out.html file, the test fails with a diff of them.
+// Running the tests with the -update flag rewrites the .out.html files
+// with the output instead, so that the changes can be reviewed with the
+// rest of a commit:
+//
+//	go test -run TestTidy -update
+//
+// Subdirectories are run as well, with the options in any config file
+// that they contain, such as .tidyhtml.yaml, applied on top of the options
+// of the directory above them. This keeps the files that test each set of
+// options together, in a directory of their own.
+package goldentest
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/raymondbutcher/tidyhtml"
+	"github.com/raymondbutcher/tidyhtml/internal/diff"
+)
+
+// The suffixes of the input and output files.
+const (
+	InSuffix  = ".in.html"
+	OutSuffix = ".out.html"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden "+OutSuffix+" files with the output")
+
+// File is a pair of golden files, Name+InSuffix and Name+OutSuffix, in
+// the directory Dir.
+type File struct {
+	Name, Dir string
+}
+
+// InPath returns the path of the input file.
+func (f File) InPath() string {
+	return filepath.Join(f.Dir, f.Name+InSuffix)
+}
+
+// OutPath returns the path of the output file.
+func (f File) OutPath() string {
+	return filepath.Join(f.Dir, f.Name+OutSuffix)
+}
+
+// ReadIn returns the contents of the input file, without the whitespace
+// at its end, which editors tend to add.
+func (f File) ReadIn() ([]byte, error) {
+	b, err := ioutil.ReadFile(f.InPath())
+	return bytes.TrimRightFunc(b, unicode.IsSpace), err
+}
+
+// Files returns the golden files in dir, in the order of their names,
+// leaving out those in subdirectories.
+func Files(dir string) ([]File, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []File
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), InSuffix) {
+			files = append(files, File{strings.TrimSuffix(e.Name(), InSuffix), dir})
+		}
+	}
+	return files, nil
+}
+
+// Run tidies the input files in dir and its subdirectories with opts, and
+// compares the output with the output files. The options are changed by
+// the config files in the directories, as described above. Errors
+// are compared with the output files too, as "Error: " and the message,
+// so that inputs which are expected to fail can be tested as well.
+func Run(t *testing.T, dir string, opts tidyhtml.Options) {
+	t.Helper()
+	run(t, dir, "", opts, func(in []byte, opts tidyhtml.Options) ([]byte, error) {
+		buf := bytes.Buffer{}
+		err := tidyhtml.CopyWithOptions(&buf, bytes.NewReader(in), opts)
+		return buf.Bytes(), err
+	})
+}
+
+// RunFunc is like Run, but it gets the output of each input file from fn,
+// which is given the options for the directory that the file is in.
+func RunFunc(t *testing.T, dir string, opts tidyhtml.Options, fn func(in []byte, opts tidyhtml.Options) ([]byte, error)) {
+	t.Helper()
+	run(t, dir, "", opts, fn)
+}
+
+func run(t *testing.T, dir, prefix string, opts tidyhtml.Options, fn func([]byte, tidyhtml.Options) ([]byte, error)) {
+	t.Helper()
+	for _, name := range tidyhtml.ConfigFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		c, err := tidyhtml.LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = c.Apply(opts)
+		break
+	}
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		f := f
+		t.Run(prefix+f.Name, func(t *testing.T) {
+			in, err := f.ReadIn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := fn(in, opts)
+			if err != nil {
+				got = []byte("Error: " + err.Error())
+			}
+			check(t, f, got)
+		})
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			run(t, filepath.Join(dir, e.Name()), prefix+e.Name()+"/", opts, fn)
+		}
+	}
+}
+
+// check compares got with the output file, or rewrites it with -update.
+// The whitespace at the end of both is left out of the comparison.
+func check(t *testing.T, f File, got []byte) {
+	t.Helper()
+	got = bytes.TrimRightFunc(got, unicode.IsSpace)
+	if *update {
+		if err := ioutil.WriteFile(f.OutPath(), append(got, '\n'), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(f.OutPath())
+	if os.IsNotExist(err) {
+		t.Fatalf("%s does not exist; run the test with -update to write it", f.OutPath())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = bytes.TrimRightFunc(want, unicode.IsSpace)
+	if d := diff.Unified(f.OutPath(), "got", append(want, '\n'), append(got, '\n')); d != nil {
+		t.Errorf("The output is not the same as the golden file:\n%s", d)
+	}
+}
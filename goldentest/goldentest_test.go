@@ -0,0 +1,49 @@
+package goldentest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+func TestRun(t *testing.T) {
+	Run(t, "testdata", tidyhtml.Options{})
+}
+
+// The files that the tidyhtml package is tested with can be updated
+// by running this with -update.
+func TestRunTidyhtml(t *testing.T) {
+	Run(t, filepath.Join("..", "tests"), tidyhtml.Options{})
+}
+
+func TestFiles(t *testing.T) {
+	files, err := Files("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name != "list" || files[0].OutPath() != filepath.Join("testdata", "list.out.html") {
+		t.Errorf("Expected the list files, got %v", files)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "a"+InSuffix), []byte("<p>a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	*update = true
+	defer func() { *update = false }()
+	RunFunc(t, dir, tidyhtml.Options{}, func(in []byte, opts tidyhtml.Options) ([]byte, error) {
+		return []byte(strings.ToUpper(string(in))), nil
+	})
+	b, err := ioutil.ReadFile(filepath.Join(dir, "a"+OutSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "<P>A\n" {
+		t.Errorf("Expected the output to be written, got %q", b)
+	}
+}
@@ -0,0 +1,94 @@
+package tidyhtml
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// headOrder returns where an element in the <head> goes in the order that
+// OrganizeHead puts them in.
+func headOrder(n *html.Node) int {
+	switch n.DataAtom {
+	case atom.Meta:
+		if _, ok := attrValue(n, "charset"); ok || isContentTypeMeta(n) {
+			return 0
+		}
+		return 2
+	case atom.Title:
+		return 1
+	case atom.Base:
+		// This comes before the links, as it changes what their URLs
+		// mean.
+		return 2
+	case atom.Link:
+		return 3
+	case atom.Style:
+		return 4
+	case atom.Script, atom.Noscript:
+		return 5
+	}
+	return 6
+}
+
+// organizeHead puts the elements in the <head> in a conventional order,
+// and removes <meta> and <link> elements that are the same as one before.
+// Comments go with the element after them. Nothing is changed when the
+// <head> has template tags, whose meaning would depend on the order.
+func organizeHead(doc *html.Node) {
+	head := findElement(doc, atom.Head)
+	if head == nil {
+		return
+	}
+	type group struct {
+		nodes []*html.Node
+		order int
+	}
+	var groups []group
+	var pending []*html.Node
+	seen := map[string]bool{}
+	for c := head.FirstChild; c != nil; c = c.NextSibling {
+		if isTemplateNode(c) || c.Type == html.RawNode {
+			return
+		}
+		if c.Type != html.ElementNode {
+			pending = append(pending, c)
+			continue
+		}
+		if c.DataAtom == atom.Meta || c.DataAtom == atom.Link {
+			key := elementKey(c)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		groups = append(groups, group{append(pending, c), headOrder(c)})
+		pending = nil
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].order < groups[j].order })
+
+	for head.FirstChild != nil {
+		head.RemoveChild(head.FirstChild)
+	}
+	for _, g := range groups {
+		for _, n := range g.nodes {
+			head.AppendChild(n)
+		}
+	}
+	for _, n := range pending {
+		head.AppendChild(n)
+	}
+}
+
+// elementKey returns a string that is the same for elements with the same
+// name and attributes, whatever order the attributes are in.
+func elementKey(n *html.Node) string {
+	attrs := make([]string, len(n.Attr))
+	for i, a := range n.Attr {
+		attrs[i] = a.Namespace + " " + a.Key + "=" + a.Val
+	}
+	sort.Strings(attrs)
+	return n.Data + "\x00" + strings.Join(attrs, "\x00")
+}
@@ -0,0 +1,92 @@
+// Package htmltest helps to test code that produces HTML, by comparing
+// tidy versions of the HTML instead of the exact bytes.
+//
+// For example:
+//
+//	func TestPage(t *testing.T) {
+//		got := renderPage()
+//		htmltest.AssertEqualHTML(t, `<p>Hello, <b>world</b></p>`, got)
+//	}
+//
+// Both sides are tidied before they are compared, so differences in
+// indentation, attribute quoting and other formatting do not matter. When
+// they are not equal, the test fails with a diff of the tidy versions, with
+// spaces shown as "·" and tabs as "→" so that whitespace changes can be seen.
+package htmltest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/raymondbutcher/tidyhtml"
+	"github.com/raymondbutcher/tidyhtml/internal/diff"
+)
+
+// AssertEqualHTML reports an error if want and got are not the same HTML
+// once they are tidied. They are tidied as fragments, unless either of them
+// starts with a doctype or an <html> element.
+func AssertEqualHTML(t testing.TB, want, got string) {
+	t.Helper()
+	opts := tidyhtml.Options{Fragment: !isDocument(want) && !isDocument(got)}
+	AssertEqualHTMLOptions(t, opts, want, got)
+}
+
+// AssertEqualHTMLOptions is like AssertEqualHTML, but it tidies both sides
+// using the given options.
+func AssertEqualHTMLOptions(t testing.TB, opts tidyhtml.Options, want, got string) {
+	t.Helper()
+	d, err := Diff(opts, want, got)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d != "" {
+		t.Errorf("HTML is not equal (-want +got):\n%s", d)
+	}
+}
+
+// Diff returns a diff of want and got once they are tidied using the
+// given options, with whitespace made visible, or "" if they are the same.
+func Diff(opts tidyhtml.Options, want, got string) (string, error) {
+	opts.FinalNewline = true
+	a, err := tidy(want, opts)
+	if err != nil {
+		return "", err
+	}
+	b, err := tidy(got, opts)
+	if err != nil {
+		return "", err
+	}
+	d := diff.Unified("want", "got", a, b)
+	if d == nil {
+		return "", nil
+	}
+	return visibleSpace(string(d)), nil
+}
+
+func tidy(s string, opts tidyhtml.Options) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := tidyhtml.CopyWithOptions(&buf, strings.NewReader(s), opts)
+	return buf.Bytes(), err
+}
+
+// isDocument reports whether s starts with a doctype or an <html> element.
+func isDocument(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "<!doctype") || strings.HasPrefix(s, "<html")
+}
+
+// visibleSpace shows the spaces and tabs in the changed and unchanged
+// lines of a diff, leaving the prefix of each line alone.
+func visibleSpace(d string) string {
+	lines := strings.SplitAfter(d, "\n")
+	for i, line := range lines {
+		if line == "" || i < 2 || line[0] == '@' || line[0] == '\\' {
+			continue
+		}
+		body := strings.Replace(line[1:], " ", "·", -1)
+		lines[i] = line[:1] + strings.Replace(body, "\t", "→", -1)
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,56 @@
+package htmltest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/raymondbutcher/tidyhtml"
+)
+
+// recorder records the errors reported by the assertions.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertEqualHTML(t *testing.T) {
+	r := &recorder{TB: t}
+	AssertEqualHTML(r, "<ul><li>a<li>b</ul>", "<ul>\n  <li>a</li>\n  <li>b</li>\n</ul>")
+	AssertEqualHTML(r, "<!doctype html><title>x</title>", "<!DOCTYPE html>\n<html><head><title>x</title></head></html>")
+	if len(r.errors) != 0 {
+		t.Errorf("Expected no errors, got %q", r.errors)
+	}
+
+	AssertEqualHTML(r, "<p>Hello <b>world</b></p>", "<p>Hello  <b>world</b> </p>\n<p>again <i>x</i> </p>")
+	want := `HTML is not equal (-want +got):
+--- want
++++ got
+@@ -1 +1,2 @@
+ <p>Hello·<b>world</b></p>
++<p>again·<i>x</i></p>
+`
+	if len(r.errors) != 1 || r.errors[0] != want {
+		t.Errorf("Expected error:\n%s\nGot:\n%q", want, r.errors)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	d, err := Diff(tidyhtml.Options{Fragment: true, Indent: "\t"}, "<div><p>a</p></div>", "<div><p>b</p></div>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- want\n+++ got\n@@ -1,3 +1,3 @@\n <div>\n-→<p>a</p>\n+→<p>b</p>\n </div>\n"
+	if d != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, d)
+	}
+}
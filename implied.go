@@ -0,0 +1,93 @@
+package tidyhtml
+
+import (
+	"bytes"
+
+	"golang.org/x/net/html"
+)
+
+// writtenMark is the name of an attribute that markWritten adds to the
+// start tags of the elements that the parser adds when they are left out,
+// so that those that were in the input can be told apart after parsing.
+const writtenMark = "\uE007"
+
+// The elements that the parser adds when their tags are not in the input.
+var impliedElements = map[string]bool{
+	"html": true, "head": true, "body": true, "tbody": true,
+}
+
+// markWritten adds the writtenMark attribute to the start tags of the
+// impliedElements in b, just after the tag name.
+func markWritten(b []byte) []byte {
+	buf := bytes.Buffer{}
+	buf.Grow(len(b))
+	z := html.NewTokenizer(bytes.NewReader(b))
+	offset := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// Keep anything that the tokenizer did not return.
+			buf.Write(b[offset:])
+			break
+		}
+		raw := b[offset : offset+len(z.Raw())]
+		offset += len(raw)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			buf.Write(raw)
+			continue
+		}
+		name, _ := z.TagName()
+		if !impliedElements[string(name)] {
+			buf.Write(raw)
+			continue
+		}
+		i := 1 + len(name)
+		buf.Write(raw[:i])
+		buf.WriteString(" " + writtenMark + "=\"\"")
+		buf.Write(raw[i:])
+	}
+	return buf.Bytes()
+}
+
+// takeWritten removes the writtenMark attributes from n and its
+// descendants, and returns the elements that had them.
+func takeWritten(n *html.Node) map[*html.Node]bool {
+	found := map[*html.Node]bool{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if a.Key == writtenMark {
+					n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+					found[n] = true
+					break
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// removeImplied replaces the impliedElements within n that are not in
+// written with their children, so that they are left out of the output
+// as they were left out of the input. The parser adds them back in the
+// same places when the output is parsed.
+func removeImplied(n *html.Node, written map[*html.Node]bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		removeImplied(c, written)
+		if c.Type == html.ElementNode && c.Namespace == "" && impliedElements[c.Data] && !written[c] {
+			for c.FirstChild != nil {
+				gc := c.FirstChild
+				c.RemoveChild(gc)
+				n.InsertBefore(gc, c)
+			}
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
@@ -0,0 +1,324 @@
+// Package diff makes unified diffs of the lines in two texts, for showing
+// the changes that tidying makes.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// The number of unchanged lines shown around each change in a diff.
+const diffContext = 3
+
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+// edit is one line of a diff. For deleted and equal lines, i is the
+// index of the line in a. For inserted lines, j is its index in b.
+type edit struct {
+	kind editKind
+	i, j int
+}
+
+// Unified returns a unified diff of the lines in a and b,
+// or nil if they are the same.
+func Unified(aName, bName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	al, bl := SplitLines(a), SplitLines(b)
+	edits := diffLines(al, bl)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(edits); {
+		// Find the next change.
+		for start < len(edits) && edits[start].kind == editEqual {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		// Extend the hunk until there are enough unchanged
+		// lines to separate it from the next change.
+		end := start
+		for end < len(edits) {
+			if edits[end].kind != editEqual {
+				end++
+				continue
+			}
+			n := 0
+			for end+n < len(edits) && edits[end+n].kind == editEqual {
+				n++
+			}
+			if end+n == len(edits) || n > 2*diffContext {
+				break
+			}
+			end += n
+		}
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+		to := end + diffContext
+		if to > len(edits) {
+			to = len(edits)
+		}
+		writeHunk(&buf, edits[from:to], al, bl)
+		start = to
+	}
+	return buf.Bytes()
+}
+
+// Change is a run of lines in a that are replaced by lines from b.
+type Change struct {
+	// Line is the number of the first line in a that is replaced,
+	// starting at 1, or of the line that the new lines go before if
+	// none are.
+	Line int
+
+	// Lines is the number of lines in a that are replaced.
+	Lines int
+
+	// Text is the lines from b that replace them.
+	Text []byte
+}
+
+// Changes returns the runs of changed lines that turn a into b,
+// or nil if they are the same.
+func Changes(a, b []byte) []Change {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	al, bl := SplitLines(a), SplitLines(b)
+	var changes []Change
+	i := 0
+	var c *Change
+	for _, e := range diffLines(al, bl) {
+		if e.kind == editEqual {
+			c = nil
+			i++
+			continue
+		}
+		if c == nil {
+			changes = append(changes, Change{Line: i + 1})
+			c = &changes[len(changes)-1]
+		}
+		if e.kind == editDelete {
+			c.Lines++
+			i++
+		} else {
+			c.Text = append(c.Text, bl[e.j]...)
+		}
+	}
+	return changes
+}
+
+// writeHunk writes a hunk header and its lines.
+func writeHunk(buf *bytes.Buffer, edits []edit, a, b [][]byte) {
+	// Lines are numbered from 1, and an empty range refers to
+	// the line before it.
+	ai, bj, an, bn := -1, -1, 0, 0
+	for _, e := range edits {
+		if e.kind != editInsert {
+			if ai == -1 {
+				ai = e.i
+			}
+			an++
+		}
+		if e.kind != editDelete {
+			if bj == -1 {
+				bj = e.j
+			}
+			bn++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(ai, an, edits[0].i), hunkRange(bj, bn, edits[0].j))
+	for _, e := range edits {
+		switch e.kind {
+		case editEqual:
+			writeDiffLine(buf, ' ', a[e.i])
+		case editDelete:
+			writeDiffLine(buf, '-', a[e.i])
+		case editInsert:
+			writeDiffLine(buf, '+', b[e.j])
+		}
+	}
+}
+
+func hunkRange(start, n, fallback int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", fallback)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func writeDiffLine(buf *bytes.Buffer, prefix byte, line []byte) {
+	buf.WriteByte(prefix)
+	buf.Write(line)
+	if !bytes.HasSuffix(line, []byte("\n")) {
+		buf.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// SplitLines splits b into lines, keeping their line endings.
+func SplitLines(b []byte) [][]byte {
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edits which turn a into b, using the linear
+// space version of the algorithm from "An O(ND) Difference Algorithm
+// and Its Variations" by Eugene W. Myers.
+func diffLines(a, b [][]byte) []edit {
+	// Compare lines by number to avoid comparing their bytes repeatedly.
+	ids := map[string]int{}
+	id := func(lines [][]byte) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			n, ok := ids[string(l)]
+			if !ok {
+				n = len(ids)
+				ids[string(l)] = n
+			}
+			out[i] = n
+		}
+		return out
+	}
+	d := &differ{a: id(a), b: id(b)}
+	d.compare(0, len(a), 0, len(b))
+
+	// Put deletions before insertions within each run of changes.
+	for i := 0; i < len(d.edits); {
+		if d.edits[i].kind == editEqual {
+			i++
+			continue
+		}
+		j := i
+		for j < len(d.edits) && d.edits[j].kind != editEqual {
+			j++
+		}
+		sort.SliceStable(d.edits[i:j], func(x, y int) bool {
+			return d.edits[i+x].kind == editDelete && d.edits[i+y].kind == editInsert
+		})
+		i = j
+	}
+	return d.edits
+}
+
+type differ struct {
+	a, b  []int
+	edits []edit
+}
+
+// compare adds the edits which turn a[a0:a1] into b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	// Skip over the common prefix.
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.edits = append(d.edits, edit{editEqual, a0, b0})
+		a0++
+		b0++
+	}
+	// Find the common suffix, which is added at the end.
+	n := 0
+	for a0 < a1-n && b0 < b1-n && d.a[a1-n-1] == d.b[b1-n-1] {
+		n++
+	}
+	a1 -= n
+	b1 -= n
+
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.edits = append(d.edits, edit{editInsert, a0, j})
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.edits = append(d.edits, edit{editDelete, i, b0})
+		}
+	default:
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for i := x; i < u; i++ {
+			d.edits = append(d.edits, edit{editEqual, i, y + i - x})
+		}
+		d.compare(u, a1, v, b1)
+	}
+
+	for i := 0; i < n; i++ {
+		d.edits = append(d.edits, edit{editEqual, a1 + i, b1 + i})
+	}
+}
+
+// middleSnake finds the middle snake of an optimal path through the
+// edit graph of a[a0:a1] and b[b0:b1], which goes from (x, y) to (u, v).
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+	off := max + 1
+	// vf holds the furthest x reached on each diagonal going forwards,
+	// and vb the furthest distance from the end going backwards.
+	vf := make([]int, 2*off+1)
+	vb := make([]int, 2*off+1)
+
+	for k := 0; k <= max; k++ {
+		// Forwards.
+		for diag := -k; diag <= k; diag += 2 {
+			var x int
+			if diag == -k || diag != k && vf[off+diag-1] < vf[off+diag+1] {
+				x = vf[off+diag+1]
+			} else {
+				x = vf[off+diag-1] + 1
+			}
+			y := x - diag
+			sx, sy := x, y
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x++
+				y++
+			}
+			vf[off+diag] = x
+			if r := delta - diag; odd && r >= -(k-1) && r <= k-1 {
+				if x+vb[off+r] >= n {
+					return a0 + sx, b0 + sy, a0 + x, b0 + y
+				}
+			}
+		}
+		// Backwards, on the reversed sequences.
+		for diag := -k; diag <= k; diag += 2 {
+			var x int
+			if diag == -k || diag != k && vb[off+diag-1] < vb[off+diag+1] {
+				x = vb[off+diag+1]
+			} else {
+				x = vb[off+diag-1] + 1
+			}
+			y := x - diag
+			sx, sy := x, y
+			for x < n && y < m && d.a[a1-x-1] == d.b[b1-y-1] {
+				x++
+				y++
+			}
+			vb[off+diag] = x
+			if f := delta - diag; !odd && f >= -k && f <= k {
+				if x+vf[off+f] >= n {
+					return a1 - x, b1 - y, a1 - sx, b1 - sy
+				}
+			}
+		}
+	}
+	// The paths always meet, so this cannot happen.
+	panic("tidyhtml: no middle snake found")
+}
@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []byte("<html>\n<body>\n<p>a</p>\n<p>b</p>\n</body>\n</html>\n")
+	b := []byte("<html>\n    <body>\n        <p>a</p>\n<p>b</p>\n</body>\n</html>")
+	want := `--- a.html
++++ b.html
+@@ -1,6 +1,6 @@
+ <html>
+-<body>
+-<p>a</p>
++    <body>
++        <p>a</p>
+ <p>b</p>
+ </body>
+-</html>
++</html>
+\ No newline at end of file
+`
+	if got := string(Unified("a.html", "b.html", a, b)); got != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, got)
+	}
+	if got := Unified("a", "b", a, a); got != nil {
+		t.Errorf("Expected no diff, got:\n%s", got)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	a := []byte("<html>\n<body>\n<p>a</p>\n<p>b</p>\n</body>\n</html>\n")
+	b := []byte("<html>\n    <body>\n        <p>a</p>\n<p>b</p>\n<p>c</p>\n</body>\n</html>\n")
+	got := Changes(a, b)
+	want := []Change{
+		{2, 2, []byte("    <body>\n        <p>a</p>\n")},
+		{5, 0, []byte("<p>c</p>\n")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d changes, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].Line != want[i].Line || got[i].Lines != want[i].Lines || !bytes.Equal(got[i].Text, want[i].Text) {
+			t.Errorf("Expected %+v, got %+v", want[i], got[i])
+		}
+	}
+	if got := Changes(a, a); got != nil {
+		t.Errorf("Expected no changes, got %+v", got)
+	}
+}
+
+// TestDiffLines checks that the edits turn a into b using
+// as few changes as possible, by comparing them with the
+// longest common subsequence.
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	words := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	random := func() [][]byte {
+		lines := make([][]byte, r.Intn(20))
+		for i := range lines {
+			lines[i] = words[r.Intn(len(words))]
+		}
+		return lines
+	}
+	for n := 0; n < 1000; n++ {
+		a, b := random(), random()
+		edits := diffLines(a, b)
+
+		var gotA, gotB [][]byte
+		equal := 0
+		for _, e := range edits {
+			switch e.kind {
+			case editEqual:
+				gotA, gotB = append(gotA, a[e.i]), append(gotB, b[e.j])
+				equal++
+			case editDelete:
+				gotA = append(gotA, a[e.i])
+			case editInsert:
+				gotB = append(gotB, b[e.j])
+			}
+		}
+		if !bytes.Equal(bytes.Join(gotA, nil), bytes.Join(a, nil)) ||
+			!bytes.Equal(bytes.Join(gotB, nil), bytes.Join(b, nil)) {
+			t.Fatalf("edits do not match the input: %q %q", a, b)
+		}
+		if lcs := lcsLength(a, b); equal != lcs {
+			t.Fatalf("expected %d equal lines, got %d: %q %q", lcs, equal, a, b)
+		}
+	}
+}
+
+func lcsLength(a, b [][]byte) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if bytes.Equal(a[i], b[j]) {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] > dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
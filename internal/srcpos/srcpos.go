@@ -0,0 +1,206 @@
+// Package srcpos parses HTML and records where each element
+// started in the source.
+//
+// The HTML parser does not keep track of positions, so a marker attribute
+// holding the offset of each start tag is added to the source before it is
+// parsed, and then removed from the elements afterwards. Elements that are
+// added by the parser, such as an implied <tbody>, have no position of
+// their own.
+package srcpos
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// The name of the marker attribute. It contains characters that are not
+// allowed in attribute names, so it cannot clash with a real one.
+const marker = "pos"
+
+// Position is a location in the source.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in characters, starting at 1
+}
+
+// IsValid reports whether the position is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Positions maps elements to where their start tags are in the source.
+type Positions map[*html.Node]Position
+
+// Lookup returns the position of a node. Nodes without a position of their
+// own use the position of their first descendant element that has one, or
+// else their nearest ancestor that has one.
+func (p Positions) Lookup(n *html.Node) Position {
+	if pos, ok := p[n]; ok {
+		return pos
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if pos := p.first(c); pos.IsValid() {
+			return pos
+		}
+	}
+	for a := n.Parent; a != nil; a = a.Parent {
+		if pos, ok := p[a]; ok {
+			return pos
+		}
+	}
+	return Position{}
+}
+
+func (p Positions) first(n *html.Node) Position {
+	if pos, ok := p[n]; ok {
+		return pos
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if pos := p.first(c); pos.IsValid() {
+			return pos
+		}
+	}
+	return Position{}
+}
+
+// Parse parses an HTML document, or a fragment within the context element
+// if it is not nil, which is placed within a DocumentNode. It returns the
+// positions of the elements.
+func Parse(b []byte, context *html.Node) (*html.Node, Positions, error) {
+	marked := mark(b)
+
+	var doc *html.Node
+	if context == nil {
+		var err error
+		if doc, err = html.Parse(bytes.NewReader(marked)); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		nodes, err := html.ParseFragment(bytes.NewReader(marked), context)
+		if err != nil {
+			return nil, nil, err
+		}
+		doc = &html.Node{Type: html.DocumentNode}
+		for _, n := range nodes {
+			doc.AppendChild(n)
+		}
+	}
+
+	lines := lineStarts(b)
+	pos := Positions{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if a.Key != marker {
+					continue
+				}
+				n.Attr = append(n.Attr[:i:i], n.Attr[i+1:]...)
+				if off, err := strconv.Atoi(a.Val); err == nil {
+					pos[n] = position(b, lines, off)
+				}
+				break
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return doc, pos, nil
+}
+
+// mark adds the marker attribute to each start tag, just after the tag
+// name, so that the other attributes are not affected.
+func mark(b []byte) []byte {
+	out := bytes.Buffer{}
+	z := html.NewTokenizer(bytes.NewReader(b))
+	offset := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// Keep anything that the tokenizer did not return.
+			if offset < len(b) {
+				out.Write(b[offset:])
+			}
+			break
+		}
+		raw := z.Raw()
+		start := offset
+		offset += len(raw)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(raw)
+			continue
+		}
+
+		// Find the end of the tag name.
+		i := 1
+		for i < len(raw) && !isNameEnd(raw[i]) {
+			i++
+		}
+		out.Write(raw[:i])
+		out.WriteString(" " + marker + "=" + strconv.Itoa(start) + " ")
+		out.Write(raw[i:])
+	}
+	return out.Bytes()
+}
+
+func isNameEnd(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\f', '\r', '/', '>':
+		return true
+	}
+	return false
+}
+
+// Source finds the positions of offsets within a source.
+type Source struct {
+	b     []byte
+	lines []int
+}
+
+// NewSource returns a Source for b.
+func NewSource(b []byte) *Source {
+	return &Source{b, lineStarts(b)}
+}
+
+// Position returns the position of an offset.
+func (s *Source) Position(off int) Position {
+	return position(s.b, s.lines, off)
+}
+
+// lineStarts returns the offsets where each line starts.
+func lineStarts(b []byte) []int {
+	starts := []int{0}
+	for i, c := range b {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func position(b []byte, lines []int, off int) Position {
+	if off > len(b) {
+		off = len(b)
+	}
+	// Find the last line that starts at or before the offset.
+	lo, hi := 0, len(lines)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if lines[mid] <= off {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return Position{
+		Offset: off,
+		Line:   lo + 1,
+		Column: utf8.RuneCount(b[lines[lo]:off]) + 1,
+	}
+}
@@ -0,0 +1,124 @@
+package tidyhtml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrLimitExceeded is returned, wrapped in a *LimitError, when the input
+// is larger than one of the limits in the options. Use errors.Is to check
+// for it.
+var ErrLimitExceeded = errors.New("tidyhtml: limit exceeded")
+
+// ErrTooDeep is matched by the *LimitError that is returned when elements
+// are nested more deeply than MaxDepth, as well as ErrLimitExceeded.
+// Use errors.Is to check for it.
+var ErrTooDeep = errors.New("tidyhtml: elements nested too deeply")
+
+// LimitError says which limit was exceeded.
+type LimitError struct {
+
+	// Limit is the name of the option, such as "MaxInputBytes".
+	Limit string
+
+	// Max is the value of the option.
+	Max int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s is %d", ErrLimitExceeded, e.Limit, e.Max)
+}
+
+// Unwrap returns ErrLimitExceeded.
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Is reports whether target is ErrTooDeep, for the MaxDepth limit.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrTooDeep && e.Limit == "MaxDepth"
+}
+
+// readInput reads all of src, unless it is longer than MaxInputBytes.
+func readInput(src io.Reader, opts Options) ([]byte, error) {
+	if opts.MaxInputBytes <= 0 {
+		return ioutil.ReadAll(src)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(src, int64(opts.MaxInputBytes)+1))
+	if err == nil && len(b) > opts.MaxInputBytes {
+		err = &LimitError{"MaxInputBytes", opts.MaxInputBytes}
+	}
+	return b, err
+}
+
+// parserMaxDepth is how many elements the parser can have open at once.
+// It fails with an error for input that is nested any deeper.
+const parserMaxDepth = 512
+
+// parseError returns a *LimitError for MaxDepth instead of the error that
+// the parser fails with when elements are nested too deeply for it, even
+// when MaxDepth is not set.
+func parseError(err error) error {
+	if strings.Contains(err.Error(), "open stack of elements exceeds") {
+		return &LimitError{"MaxDepth", parserMaxDepth}
+	}
+	return err
+}
+
+// checkLimits checks a parsed document against MaxNodes and MaxDepth.
+// The parser builds the whole tree first, so its own work is only bounded
+// by MaxInputBytes, and by parserMaxDepth for the nesting.
+func checkLimits(n *html.Node, opts Options) error {
+	if opts.MaxNodes <= 0 && opts.MaxDepth <= 0 {
+		return nil
+	}
+	nodes := 0
+	var walk func(n *html.Node, depth int) error
+	walk = func(n *html.Node, depth int) error {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			nodes++
+			if opts.MaxNodes > 0 && nodes > opts.MaxNodes {
+				return &LimitError{"MaxNodes", opts.MaxNodes}
+			}
+			if c.Type == html.ElementNode {
+				if opts.MaxDepth > 0 && depth+1 > opts.MaxDepth {
+					return &LimitError{"MaxDepth", opts.MaxDepth}
+				}
+				if err := walk(c, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(n, 0)
+}
+
+// limitWriter writes to w, and returns a *LimitError instead of
+// writing more than MaxOutputBytes.
+type limitWriter struct {
+	w      io.Writer
+	max, n int
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.n+len(p) > l.max {
+		return 0, &LimitError{"MaxOutputBytes", l.max}
+	}
+	n, err := l.w.Write(p)
+	l.n += n
+	return n, err
+}
+
+// limitOutput returns w, limited to MaxOutputBytes if it is set.
+func limitOutput(w io.Writer, opts Options) io.Writer {
+	if opts.MaxOutputBytes <= 0 {
+		return w
+	}
+	return &limitWriter{w: w, max: opts.MaxOutputBytes}
+}
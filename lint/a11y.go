@@ -0,0 +1,153 @@
+package lint
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Accessibility rules.
+
+// checkImgAlt reports images without an alt attribute. An empty alt is
+// fine, because it marks the image as decorative.
+func checkImgAlt(d *Document) {
+	d.Elements(func(n *html.Node) {
+		if n.Data == "img" && n.Namespace == "" {
+			if _, ok := attr(n, "alt"); !ok {
+				d.Report(n, Warning, "<img> without an alt attribute")
+			}
+		}
+	})
+}
+
+// checkHTMLLang reports documents without a language.
+func checkHTMLLang(d *Document) {
+	if d.Fragment {
+		return
+	}
+	d.Elements(func(n *html.Node) {
+		if n.Data == "html" && n.Parent == d.Root {
+			if lang, _ := attr(n, "lang"); strings.TrimSpace(lang) == "" {
+				d.Report(n, Warning, "<html> without a lang attribute")
+			}
+		}
+	})
+}
+
+// Input types that do not need a label.
+var unlabelledInputs = map[string]bool{
+	"button": true, "hidden": true, "image": true, "reset": true, "submit": true,
+}
+
+// checkInputLabel reports form controls without a label.
+func checkInputLabel(d *Document) {
+	labelled := map[string]bool{}
+	d.Elements(func(n *html.Node) {
+		if n.Data == "label" {
+			if id, ok := attr(n, "for"); ok {
+				labelled[id] = true
+			}
+		}
+	})
+	d.Elements(func(n *html.Node) {
+		if n.Namespace != "" {
+			return
+		}
+		switch n.Data {
+		case "input":
+			typ, _ := attr(n, "type")
+			if unlabelledInputs[strings.ToLower(typ)] {
+				return
+			}
+		case "select", "textarea":
+		default:
+			return
+		}
+		if hasAccessibleName(n) {
+			return
+		}
+		if id, _ := attr(n, "id"); id != "" && labelled[id] {
+			return
+		}
+		for a := n.Parent; a != nil; a = a.Parent {
+			if a.Type == html.ElementNode && a.Data == "label" {
+				return
+			}
+		}
+		d.Report(n, Warning, "<%s> without a label", n.Data)
+	})
+}
+
+// checkEmptyLinks reports links and buttons without any text.
+func checkEmptyLinks(d *Document) {
+	d.Elements(func(n *html.Node) {
+		if n.Namespace != "" {
+			return
+		}
+		switch n.Data {
+		case "a":
+			if _, ok := attr(n, "href"); !ok {
+				return
+			}
+		case "button":
+		default:
+			return
+		}
+		if !hasAccessibleName(n) && !hasText(n) {
+			what := "link"
+			if n.Data == "button" {
+				what = "button"
+			}
+			d.Report(n, Warning, "empty %s", what)
+		}
+	})
+}
+
+// checkHeadingOrder reports headings that skip a level, such
+// as an <h3> after an <h1>.
+func checkHeadingOrder(d *Document) {
+	prev := 0
+	d.Elements(func(n *html.Node) {
+		if n.Namespace != "" || len(n.Data) != 2 || n.Data[0] != 'h' || n.Data[1] < '1' || n.Data[1] > '6' {
+			return
+		}
+		level := int(n.Data[1] - '0')
+		if prev != 0 && level > prev+1 {
+			d.Report(n, Warning, "<%s> after <h%d> skips a heading level", n.Data, prev)
+		}
+		prev = level
+	})
+}
+
+// hasAccessibleName reports whether an element is named by its attributes.
+func hasAccessibleName(n *html.Node) bool {
+	for _, key := range []string{"aria-label", "aria-labelledby", "title"} {
+		if v, _ := attr(n, key); strings.TrimSpace(v) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasText reports whether an element contains any text,
+// including the alt text of images.
+func hasText(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			if strings.TrimSpace(c.Data) != "" {
+				return true
+			}
+		case html.ElementNode:
+			if c.Data == "img" {
+				if alt, _ := attr(c, "alt"); strings.TrimSpace(alt) != "" {
+					return true
+				}
+			}
+			if hasAccessibleName(c) || hasText(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
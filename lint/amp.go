@@ -0,0 +1,85 @@
+package lint
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The attributes on <html> that make a document an AMP document.
+var ampFormats = []string{"⚡", "amp", "⚡4ads", "amp4ads", "⚡4email", "amp4email"}
+
+// Elements that AMP does not allow, with what to use instead.
+var ampDisallowed = map[string]string{
+	"applet":   "use <amp-iframe>",
+	"audio":    "use <amp-audio>",
+	"embed":    "use <amp-iframe>",
+	"frame":    "use <amp-iframe>",
+	"frameset": "use <amp-iframe>",
+	"iframe":   "use <amp-iframe>",
+	"img":      "use <amp-img>",
+	"object":   "use <amp-iframe>",
+	"param":    "use <amp-iframe>",
+	"video":    "use <amp-video>",
+}
+
+// Input types that AMP does not allow.
+var ampDisallowedInputs = map[string]bool{
+	"button": true, "file": true, "image": true, "password": true,
+}
+
+// checkAMP reports the elements that AMP documents cannot have, which
+// would make the AMP validator reject the page. Other documents are not
+// checked.
+func checkAMP(d *Document) {
+	if d.Fragment || !isAMP(d) {
+		return
+	}
+	d.Elements(func(n *html.Node) {
+		if n.Namespace != "" {
+			return
+		}
+		if instead, ok := ampDisallowed[n.Data]; ok {
+			d.Report(n, Warning, "<%s> is not allowed in AMP, %s", n.Data, instead)
+			return
+		}
+		switch n.Data {
+		case "input":
+			if typ, _ := attr(n, "type"); ampDisallowedInputs[strings.ToLower(typ)] {
+				d.Report(n, Warning, "<input type=%q> is not allowed in AMP", strings.ToLower(typ))
+			}
+		case "script":
+			typ, _ := attr(n, "type")
+			src, _ := attr(n, "src")
+			switch strings.ToLower(typ) {
+			case "application/ld+json", "application/json":
+			default:
+				if !strings.HasPrefix(src, "https://cdn.ampproject.org/") {
+					d.Report(n, Warning, "<script> is not allowed in AMP, except for the AMP runtime and components, and JSON")
+				}
+			}
+		case "style":
+			for _, a := range n.Attr {
+				switch a.Key {
+				case "amp-custom", "amp-keyframes", "amp-boilerplate", "amp4ads-boilerplate", "amp4email-boilerplate":
+					return
+				}
+			}
+			d.Report(n, Warning, "<style> is not allowed in AMP, use a single <style amp-custom>")
+		}
+	})
+}
+
+// isAMP reports whether a document is an AMP document.
+func isAMP(d *Document) bool {
+	for c := d.Root.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "html" {
+			for _, name := range ampFormats {
+				if _, ok := attr(c, name); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package lint
+
+import (
+	"golang.org/x/net/html"
+)
+
+// Content model rules, for markup that the parser repairs or accepts
+// but that is not valid HTML.
+
+// Elements that are flow content but not phrasing content, so they
+// cannot be within a <p> or a <button>.
+var flowOnlyElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"details": true, "dialog": true, "div": true, "dl": true,
+	"fieldset": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "main": true, "menu": true,
+	"nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "ul": true,
+}
+
+// Interactive elements, which cannot be within a <button>.
+var interactiveElements = map[string]bool{
+	"a": true, "button": true, "details": true, "embed": true,
+	"iframe": true, "input": true, "label": true, "select": true,
+	"textarea": true,
+}
+
+// checkBlockInParagraph reports block elements that were written within a
+// <p>. The parser ends the <p> before them, and turns the </p> that comes
+// after them into an empty paragraph, which is how they are found.
+func checkBlockInParagraph(d *Document) {
+	d.Elements(func(n *html.Node) {
+		if n.Data != "p" || n.Namespace != "" || n.FirstChild != nil || !d.Implied(n) {
+			return
+		}
+		// Find the paragraph that was ended early, and the
+		// element that ended it.
+		var block *html.Node
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type != html.ElementNode {
+				continue
+			}
+			if s.Data == "p" && !d.Implied(s) {
+				if block != nil {
+					d.Report(block, Error, "<%s> is not allowed within <p>, so the <p> is ended before it", block.Data)
+				}
+				return
+			}
+			block = s
+		}
+	})
+}
+
+// checkListItems reports <li> elements that are not within a list.
+// The top level of a fragment is not checked, because the fragment
+// may be included within a list.
+func checkListItems(d *Document) {
+	d.Elements(func(n *html.Node) {
+		if n.Data != "li" || n.Namespace != "" || n.Parent == d.Root {
+			return
+		}
+		switch n.Parent.Data {
+		case "ul", "ol", "menu", "template":
+		default:
+			d.Report(n, Error, "<li> is not within <ul>, <ol> or <menu>")
+		}
+	})
+}
+
+// checkMultipleMain reports more than one visible <main> element.
+func checkMultipleMain(d *Document) {
+	found := false
+	d.Elements(func(n *html.Node) {
+		if n.Data != "main" || n.Namespace != "" {
+			return
+		}
+		if _, hidden := attr(n, "hidden"); hidden {
+			return
+		}
+		if found {
+			d.Report(n, Error, "more than one visible <main> element")
+		}
+		found = true
+	})
+}
+
+// checkButtonContent reports block and interactive elements within a
+// <button>, which can only contain phrasing content.
+func checkButtonContent(d *Document) {
+	d.Elements(func(n *html.Node) {
+		if n.Data != "button" || n.Namespace != "" {
+			return
+		}
+		var walk func(c *html.Node)
+		walk = func(c *html.Node) {
+			for ; c != nil; c = c.NextSibling {
+				if c.Type != html.ElementNode || c.Namespace != "" {
+					continue
+				}
+				if flowOnlyElements[c.Data] {
+					d.Report(c, Error, "<%s> is not allowed within <button>", c.Data)
+				} else if interactiveElements[c.Data] && !isHiddenInput(c) {
+					d.Report(c, Error, "interactive <%s> is not allowed within <button>", c.Data)
+				}
+				walk(c.FirstChild)
+			}
+		}
+		walk(n.FirstChild)
+	})
+}
+
+func isHiddenInput(n *html.Node) bool {
+	typ, _ := attr(n, "type")
+	return n.Data == "input" && typ == "hidden"
+}
@@ -0,0 +1,90 @@
+package lint
+
+import (
+	"unicode/utf8"
+)
+
+// Characters that change the order that text is shown in. They can make
+// source code look different to what it does, as in the Trojan Source
+// attacks, and links and names look like others.
+var bidiControls = map[rune]string{
+	0x202A: "LEFT-TO-RIGHT EMBEDDING",
+	0x202B: "RIGHT-TO-LEFT EMBEDDING",
+	0x202C: "POP DIRECTIONAL FORMATTING",
+	0x202D: "LEFT-TO-RIGHT OVERRIDE",
+	0x202E: "RIGHT-TO-LEFT OVERRIDE",
+	0x2066: "LEFT-TO-RIGHT ISOLATE",
+	0x2067: "RIGHT-TO-LEFT ISOLATE",
+	0x2068: "FIRST STRONG ISOLATE",
+	0x2069: "POP DIRECTIONAL ISOLATE",
+}
+
+// Characters that are not shown, but that make text that looks the same
+// compare differently.
+var invisibleChars = map[rune]string{
+	0x00AD: "SOFT HYPHEN",
+	0x200B: "ZERO WIDTH SPACE",
+	0x200C: "ZERO WIDTH NON-JOINER",
+	0x200D: "ZERO WIDTH JOINER",
+	0x2060: "WORD JOINER",
+	0xFEFF: "ZERO WIDTH NO-BREAK SPACE",
+}
+
+// findInvisible calls f with the offset, size and name of each bidi
+// control and invisible character in b. Character references such as
+// &shy; are not included, as they can be seen in the source. Nor are the
+// joiners that are not next to an ASCII character, as emoji sequences and
+// many writing systems need them, or a byte order mark at the start.
+func findInvisible(b []byte, f func(offset, size int, bidi bool, name string)) {
+	prev := rune(-1)
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		next, _ := utf8.DecodeRune(b[i+size:])
+		if name, ok := bidiControls[r]; ok {
+			f(i, size, true, name)
+		} else if name, ok := invisibleChars[r]; ok {
+			switch {
+			case r == 0xFEFF && i == 0:
+			case (r == 0x200C || r == 0x200D) && !isASCIIText(prev) && !isASCIIText(next):
+			default:
+				f(i, size, false, name)
+			}
+		}
+		prev = r
+		i += size
+	}
+}
+
+func isASCIIText(r rune) bool {
+	return r > ' ' && r < utf8.RuneSelf
+}
+
+// checkInvisibleChars reports bidi control characters and invisible
+// characters anywhere in the source, including in text, attribute values,
+// scripts and comments. StripInvisible removes them.
+func checkInvisibleChars(d *Document) {
+	findInvisible(d.Source, func(offset, size int, bidi bool, name string) {
+		r, _ := utf8.DecodeRune(d.Source[offset:])
+		if bidi {
+			d.ReportAt(offset, Warning, "bidi control character %U %s can make text look different from what it is", r, name)
+		} else {
+			d.ReportAt(offset, Info, "invisible character %U %s", r, name)
+		}
+	})
+}
+
+// StripInvisible returns src without the characters that the
+// invisible-chars rule reports, which fixes the findings of that rule.
+// The rest of src is left byte for byte as it was.
+func StripInvisible(src []byte) []byte {
+	var out []byte
+	last := 0
+	findInvisible(src, func(offset, size int, bidi bool, name string) {
+		out = append(out, src[last:offset]...)
+		last = offset + size
+	})
+	if out == nil && last == 0 {
+		return src
+	}
+	return append(out, src[last:]...)
+}
@@ -0,0 +1,228 @@
+// Package lint checks HTML documents for problems.
+//
+// Each problem is reported as a Finding by a Rule. There are built-in
+// rules, which are returned by DefaultRules, and custom rules can be added
+// by implementing the Rule interface:
+//
+//	noBlink := lint.RuleFunc("no-blink", func(d *lint.Document) {
+//		d.Elements(func(n *html.Node) {
+//			if n.Data == "blink" {
+//				d.Report(n, lint.Error, "do not use <blink>")
+//			}
+//		})
+//	})
+//	findings, err := lint.Check(src, lint.Options{
+//		Rules: append(lint.DefaultRules(), noBlink),
+//	})
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/raymondbutcher/tidyhtml/internal/srcpos"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Severity is how serious a finding is.
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+var severityNames = map[Severity]string{
+	Info:    "info",
+	Warning: "warning",
+	Error:   "error",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity returns the severity with the given name,
+// such as "warning".
+func ParseSeverity(name string) (Severity, error) {
+	for s, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return s, nil
+		}
+	}
+	return Info, fmt.Errorf("lint: unknown severity: %q", name)
+}
+
+// Position is a location in the source, with a line and column
+// starting at 1. The zero value means that the location is not known.
+type Position = srcpos.Position
+
+// Finding is a problem found in a document.
+type Finding struct {
+	Rule     string
+	Severity Severity
+	Pos      Position
+	Message  string
+}
+
+// String formats the finding as "line:column: severity: message (rule)".
+func (f Finding) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s (%s)", f.Pos.Line, f.Pos.Column, f.Severity, f.Message, f.Rule)
+}
+
+// Rule checks a document for one kind of problem.
+type Rule interface {
+
+	// ID is a short name for the rule, such as "duplicate-id",
+	// which is used in findings and for disabling the rule.
+	ID() string
+
+	// Check reports the problems in a document with Document.Report.
+	Check(d *Document)
+}
+
+// RuleFunc returns a rule with the given ID that calls check.
+func RuleFunc(id string, check func(d *Document)) Rule {
+	return funcRule{id, check}
+}
+
+type funcRule struct {
+	id    string
+	check func(d *Document)
+}
+
+func (r funcRule) ID() string        { return r.id }
+func (r funcRule) Check(d *Document) { r.check(d) }
+
+// Document is a parsed document being checked by a rule.
+type Document struct {
+
+	// Root is the DocumentNode at the root of the tree.
+	Root *html.Node
+
+	// Fragment is true when the document is a fragment, without
+	// its own <html>, <head> and <body> elements.
+	Fragment bool
+
+	// Source is the source that the document was parsed from.
+	Source []byte
+
+	positions srcpos.Positions
+	source    *srcpos.Source
+	rule      string
+	findings  []Finding
+}
+
+// Pos returns the position of a node in the source. Nodes that were not in
+// the source, such as an implied <tbody>, use a position near to them.
+func (d *Document) Pos(n *html.Node) Position {
+	return d.positions.Lookup(n)
+}
+
+// Implied reports whether an element was added by the parser, such as
+// an implied <tbody>, rather than having a start tag in the source.
+func (d *Document) Implied(n *html.Node) bool {
+	_, ok := d.positions[n]
+	return n.Type == html.ElementNode && !ok
+}
+
+// Report adds a finding for the rule being run.
+func (d *Document) Report(n *html.Node, severity Severity, format string, args ...interface{}) {
+	d.findings = append(d.findings, Finding{
+		Rule:     d.rule,
+		Severity: severity,
+		Pos:      d.Pos(n),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// ReportAt adds a finding for the rule being run at an offset in the
+// Source, for problems that are not where an element starts.
+func (d *Document) ReportAt(offset int, severity Severity, format string, args ...interface{}) {
+	if d.source == nil {
+		d.source = srcpos.NewSource(d.Source)
+	}
+	d.findings = append(d.findings, Finding{
+		Rule:     d.rule,
+		Severity: severity,
+		Pos:      d.source.Position(offset),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Elements calls f for each element in the document, in document order.
+func (d *Document) Elements(f func(n *html.Node)) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			f(n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(d.Root)
+}
+
+// Options control how documents are checked.
+type Options struct {
+
+	// Rules are the rules to run. The default is DefaultRules.
+	Rules []Rule
+
+	// Disable lists the IDs of rules that are not run.
+	Disable []string
+
+	// Fragment treats the source as a fragment of a document,
+	// which is parsed as if it were within a <body>.
+	Fragment bool
+
+	// Context is the name of the element that a fragment is
+	// parsed within. The default is "body".
+	Context string
+}
+
+// Check parses a document and runs the rules on it. The findings are
+// returned in the order that they appear in the source.
+func Check(src []byte, opts Options) ([]Finding, error) {
+	var context *html.Node
+	if opts.Fragment {
+		name := strings.ToLower(opts.Context)
+		if name == "" {
+			name = "body"
+		}
+		context = &html.Node{Type: html.ElementNode, Data: name, DataAtom: atom.Lookup([]byte(name))}
+	}
+	root, positions, err := srcpos.Parse(src, context)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Document{Root: root, Fragment: opts.Fragment, Source: src, positions: positions}
+	rules := opts.Rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+	disabled := map[string]bool{}
+	for _, id := range opts.Disable {
+		disabled[id] = true
+	}
+	for _, r := range rules {
+		if disabled[r.ID()] {
+			continue
+		}
+		d.rule = r.ID()
+		r.Check(d)
+	}
+
+	sort.SliceStable(d.findings, func(i, j int) bool {
+		return d.findings[i].Pos.Offset < d.findings[j].Pos.Offset
+	})
+	return d.findings, nil
+}
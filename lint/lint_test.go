@@ -0,0 +1,157 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// assertFindings checks the source with the options and compares the
+// findings, formatted one per line, with the expected ones.
+func assertFindings(t *testing.T, opts Options, src, want string) {
+	t.Helper()
+	findings, err := Check([]byte(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, f := range findings {
+		lines = append(lines, f.String())
+	}
+	if got := strings.Join(lines, "\n"); got != strings.TrimSpace(want) {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, got)
+	}
+}
+
+func TestDefaultRules(t *testing.T) {
+	src := `<html>
+<head><title> </title></head>
+<body>
+  <p id="a">one</p>
+  <table><tr><td id="a">two</td></tr></table>
+</body>
+</html>`
+	assertFindings(t, Options{}, src, `
+1:1: warning: missing <!doctype html> (doctype)
+1:1: warning: <html> without a lang attribute (html-lang)
+2:7: warning: empty <title> (title)
+5:14: error: duplicate id "a" (duplicate-id)
+`)
+	assertFindings(t, Options{Disable: []string{"doctype", "title", "html-lang"}}, src, `
+5:14: error: duplicate id "a" (duplicate-id)
+`)
+	assertFindings(t, Options{Fragment: true}, `<p id=x><span id=x>`, `
+1:9: error: duplicate id "x" (duplicate-id)
+`)
+}
+
+func TestAccessibilityRules(t *testing.T) {
+	src := `<h1>Title</h1>
+<img src="a.png"> <img src="b.png" alt="">
+<label>Name <input name="name"></label>
+<label for="email">Email</label> <input id="email">
+<input name="phone"> <input type="submit"> <textarea aria-label="Notes"></textarea>
+<a href="/"></a> <a href="/"><img src="home.png" alt="Home"></a> <button> </button>
+<h3>Skipped</h3> <h2>Fine</h2>`
+	assertFindings(t, Options{Fragment: true}, src, `
+2:1: warning: <img> without an alt attribute (img-alt)
+5:1: warning: <input> without a label (input-label)
+6:1: warning: empty link (empty-link)
+6:66: warning: empty button (empty-link)
+7:1: warning: <h3> after <h1> skips a heading level (heading-order)
+`)
+}
+
+func TestObsoleteRule(t *testing.T) {
+	src := `<center>Hi</center>
+<table bgcolor="red" width="100%"><tr><td valign="top"><font size=2>x</font></td></tr></table>
+<img src="a.png" alt="" width="10">`
+	assertFindings(t, Options{Fragment: true}, src, `
+1:1: warning: <center> is obsolete, use CSS (obsolete)
+2:1: warning: the bgcolor attribute on <table> is obsolete, use CSS (obsolete)
+2:1: warning: the width attribute on <table> is obsolete, use CSS (obsolete)
+2:39: warning: the valign attribute on <td> is obsolete, use CSS (obsolete)
+2:56: warning: <font> is obsolete, use CSS (obsolete)
+`)
+}
+
+func TestContentModelRules(t *testing.T) {
+	src := `<main><p>Intro<div>Block</div></p>
+<p>Fine</p><p>Also fine
+<div><li>Item</li></div>
+<button><div>Click</div><a href="/">here</a><input type="hidden"></button></main>
+<main>Again</main>
+<main hidden>Hidden</main>`
+	assertFindings(t, Options{Fragment: true}, src, `
+1:15: error: <div> is not allowed within <p>, so the <p> is ended before it (block-in-paragraph)
+3:6: error: <li> is not within <ul>, <ol> or <menu> (list-item)
+4:9: error: <div> is not allowed within <button> (button-content)
+4:25: error: interactive <a> is not allowed within <button> (button-content)
+5:1: error: more than one visible <main> element (multiple-main)
+`)
+}
+
+func TestAMPRule(t *testing.T) {
+	src := `<!doctype html>
+<html ⚡ lang="en">
+<head><title>x</title><script async src="https://cdn.ampproject.org/v0.js"></script>
+<style amp-boilerplate>body{}</style><style amp-custom>p{}</style><style>a{}</style></head>
+<body><img src="a.png" alt=""> <amp-img src="a.png" alt=""></amp-img>
+<script>alert(1)</script><script type="application/ld+json">{}</script> <input type="password"></body>
+</html>`
+	assertFindings(t, Options{Disable: []string{"input-label"}}, src, `
+4:67: warning: <style> is not allowed in AMP, use a single <style amp-custom> (amp)
+5:7: warning: <img> is not allowed in AMP, use <amp-img> (amp)
+6:1: warning: <script> is not allowed in AMP, except for the AMP runtime and components, and JSON (amp)
+6:73: warning: <input type="password"> is not allowed in AMP (amp)
+`)
+	assertFindings(t, Options{}, `<!doctype html><html lang="en"><title>x</title><img src="a.png" alt="">`, ``)
+}
+
+func TestInvisibleCharsRule(t *testing.T) {
+	src := "<p title=\"admin\u202E\u2066\">caf\u00ADé</p>\n<a href=\"pay\u200Bpal.com\">x</a> 👩\u200D💻 &shy;\n<script>// \u2067 x</script>"
+	assertFindings(t, Options{Fragment: true}, src, `
+1:16: warning: bidi control character U+202E RIGHT-TO-LEFT OVERRIDE can make text look different from what it is (invisible-chars)
+1:17: warning: bidi control character U+2066 LEFT-TO-RIGHT ISOLATE can make text look different from what it is (invisible-chars)
+1:23: info: invisible character U+00AD SOFT HYPHEN (invisible-chars)
+2:13: info: invisible character U+200B ZERO WIDTH SPACE (invisible-chars)
+3:12: warning: bidi control character U+2067 RIGHT-TO-LEFT ISOLATE can make text look different from what it is (invisible-chars)
+`)
+	want := "<p title=\"admin\">café</p>\n<a href=\"paypal.com\">x</a> 👩\u200D💻 &shy;\n<script>//  x</script>"
+	if got := string(StripInvisible([]byte(src))); got != want {
+		t.Errorf("Expected:\n%s\nGot:\n%s", want, got)
+	}
+	assertFindings(t, Options{Fragment: true}, want, ``)
+}
+
+func TestCustomRule(t *testing.T) {
+	noBlink := RuleFunc("no-blink", func(d *Document) {
+		d.Elements(func(n *html.Node) {
+			if n.Data == "blink" {
+				d.Report(n, Error, "do not use <%s>", n.Data)
+			}
+		})
+	})
+	src := "<p>Hello,\n  <blink class=\"x\">world</blink></p>"
+	assertFindings(t, Options{Rules: []Rule{noBlink}, Fragment: true}, src, `
+2:3: error: do not use <blink> (no-blink)
+`)
+
+	// The marker attributes used for positions are removed.
+	findings := 0
+	check := RuleFunc("attrs", func(d *Document) {
+		d.Elements(func(n *html.Node) {
+			if n.Data == "blink" && (len(n.Attr) != 1 || n.Attr[0].Key != "class") {
+				t.Errorf("Unexpected attributes: %v", n.Attr)
+			}
+			findings++
+		})
+	})
+	if _, err := Check([]byte(src), Options{Rules: []Rule{check}, Fragment: true}); err != nil {
+		t.Fatal(err)
+	}
+	if findings != 2 {
+		t.Errorf("Expected 2 elements, got %d", findings)
+	}
+}
@@ -0,0 +1,92 @@
+package lint
+
+import (
+	"golang.org/x/net/html"
+)
+
+// Obsolete elements, with what to use instead.
+var obsoleteElements = map[string]string{
+	"acronym":   "use <abbr>",
+	"applet":    "use <object>",
+	"basefont":  "use CSS",
+	"bgsound":   "use <audio>",
+	"big":       "use CSS",
+	"blink":     "use CSS",
+	"center":    "use CSS",
+	"dir":       "use <ul>",
+	"font":      "use CSS",
+	"frame":     "use <iframe>",
+	"frameset":  "use <iframe>",
+	"isindex":   "use a <form>",
+	"keygen":    "use the Web Cryptography API",
+	"listing":   "use <pre>",
+	"marquee":   "use CSS",
+	"multicol":  "use CSS",
+	"nextid":    "use GUIDs",
+	"nobr":      "use CSS",
+	"noembed":   "use <object>",
+	"noframes":  "use <iframe>",
+	"plaintext": "use <pre>",
+	"spacer":    "use CSS",
+	"strike":    "use <s> or <del>",
+	"tt":        "use <code> or CSS",
+	"xmp":       "use <pre>",
+}
+
+// Obsolete attributes, and the elements that they are obsolete on.
+// A nil list means all elements.
+var obsoleteAttrs = map[string][]string{
+	"align":        nil,
+	"alink":        {"body"},
+	"background":   nil,
+	"bgcolor":      nil,
+	"border":       {"img", "object"},
+	"cellpadding":  {"table"},
+	"cellspacing":  {"table"},
+	"clear":        {"br"},
+	"color":        {"hr"},
+	"frameborder":  {"iframe"},
+	"hspace":       {"img", "object"},
+	"language":     {"script"},
+	"link":         {"body"},
+	"marginheight": {"body", "iframe"},
+	"marginwidth":  {"body", "iframe"},
+	"noshade":      {"hr"},
+	"nowrap":       {"td", "th"},
+	"scrolling":    {"iframe"},
+	"text":         {"body"},
+	"valign":       nil,
+	"vlink":        {"body"},
+	"vspace":       {"img", "object"},
+	"width":        {"col", "colgroup", "hr", "pre", "table", "td", "th"},
+}
+
+// checkObsolete reports obsolete elements and attributes.
+func checkObsolete(d *Document) {
+	d.Elements(func(n *html.Node) {
+		if n.Namespace != "" {
+			return
+		}
+		if instead, ok := obsoleteElements[n.Data]; ok {
+			d.Report(n, Warning, "<%s> is obsolete, %s", n.Data, instead)
+		}
+		for _, a := range n.Attr {
+			elements, ok := obsoleteAttrs[a.Key]
+			if !ok || a.Namespace != "" {
+				continue
+			}
+			if elements == nil || contains(elements, n.Data) {
+				d.Report(n, Warning, "the %s attribute on <%s> is obsolete, use CSS", a.Key, n.Data)
+			}
+		}
+	})
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
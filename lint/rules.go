@@ -0,0 +1,91 @@
+package lint
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultRules returns the built-in rules.
+func DefaultRules() []Rule {
+	return []Rule{
+		RuleFunc("doctype", checkDoctype),
+		RuleFunc("title", checkTitle),
+		RuleFunc("duplicate-id", checkDuplicateID),
+		RuleFunc("img-alt", checkImgAlt),
+		RuleFunc("html-lang", checkHTMLLang),
+		RuleFunc("input-label", checkInputLabel),
+		RuleFunc("empty-link", checkEmptyLinks),
+		RuleFunc("heading-order", checkHeadingOrder),
+		RuleFunc("obsolete", checkObsolete),
+		RuleFunc("block-in-paragraph", checkBlockInParagraph),
+		RuleFunc("list-item", checkListItems),
+		RuleFunc("multiple-main", checkMultipleMain),
+		RuleFunc("button-content", checkButtonContent),
+		RuleFunc("amp", checkAMP),
+		RuleFunc("invisible-chars", checkInvisibleChars),
+	}
+}
+
+// attr returns the value of an attribute, and whether it was present.
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// checkDoctype reports documents without a doctype,
+// which are rendered in quirks mode.
+func checkDoctype(d *Document) {
+	if d.Fragment {
+		return
+	}
+	for c := d.Root.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.DoctypeNode {
+			return
+		}
+	}
+	d.Report(d.Root.FirstChild, Warning, "missing <!doctype html>")
+}
+
+// checkTitle reports documents without a title, or with an empty one.
+func checkTitle(d *Document) {
+	if d.Fragment {
+		return
+	}
+	found := false
+	d.Elements(func(n *html.Node) {
+		if n.Data != "title" || n.Namespace != "" || found {
+			return
+		}
+		found = true
+		text := ""
+		if n.FirstChild != nil {
+			text = n.FirstChild.Data
+		}
+		if strings.TrimSpace(text) == "" {
+			d.Report(n, Warning, "empty <title>")
+		}
+	})
+	if !found {
+		d.Report(d.Root.FirstChild, Warning, "missing <title>")
+	}
+}
+
+// checkDuplicateID reports id attributes that are used more than once.
+func checkDuplicateID(d *Document) {
+	seen := map[string]bool{}
+	d.Elements(func(n *html.Node) {
+		id, ok := attr(n, "id")
+		if !ok || id == "" {
+			return
+		}
+		if seen[id] {
+			d.Report(n, Error, "duplicate id %q", id)
+		}
+		seen[id] = true
+	})
+}
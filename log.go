@@ -0,0 +1,19 @@
+package tidyhtml
+
+import (
+	"context"
+	"log/slog"
+)
+
+// debugEnabled reports whether there is a Logger that writes debug
+// messages, so that the values for them need only be worked out then.
+func (opts *Options) debugEnabled() bool {
+	return opts.Logger != nil && opts.Logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// debug logs a message at the debug level to the Logger, if there is one.
+func (opts *Options) debug(msg string, args ...interface{}) {
+	if opts.Logger != nil {
+		opts.Logger.Debug(msg, args...)
+	}
+}
@@ -3,16 +3,38 @@ package tidyhtml
 import (
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/net/html"
 )
 
+// isNotSpace reports whether r is not HTML whitespace. Other spaces, such
+// as non-breaking spaces, are not collapsed when the document is displayed.
 func isNotSpace(r rune) bool {
-	return !unicode.IsSpace(r)
+	return !isHTMLSpace(r)
 }
 
-func hasChild(n *html.Node) bool {
-	return n.FirstChild != nil
+// hasContent - does the node have children other than whitespace, which
+// is not written within normal blocks?
+func hasContent(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.TextNode || strings.IndexFunc(c.Data, isNotSpace) != -1 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLeadingNewline - does the node's text start with a line break that
+// would be lost, as the parser removes one straight after a <pre>,
+// <listing> or <textarea> start tag?
+func hasLeadingNewline(n *html.Node) bool {
+	switch n.Data {
+	case "pre", "listing", "textarea":
+		c := n.FirstChild
+		return n.Namespace == "" && c != nil && c.Type == html.TextNode && strings.HasPrefix(c.Data, "\n")
+	}
+	return false
 }
 
 func hasNext(n *html.Node) bool {
@@ -40,6 +62,29 @@ func isPreNode(n *html.Node) bool {
 	return n != nil && n.Type == html.ElementNode && n.Data == "pre"
 }
 
+func isTemplateNode(n *html.Node) bool {
+	if n == nil || n.Type != html.CommentNode && n.Type != html.ElementNode {
+		return false
+	}
+	return strings.HasPrefix(n.Data, string(placeholderBlock)) ||
+		strings.HasPrefix(n.Data, string(placeholderInline))
+}
+
+func isTemplateAttr(a html.Attribute) bool {
+	if a.Val != "" {
+		return false
+	}
+	return strings.HasPrefix(a.Key, string(placeholderBlock)) ||
+		strings.HasPrefix(a.Key, string(placeholderInline))
+}
+
+// isInlineTemplate - is the node a template expression, which is
+// treated like text?
+func isInlineTemplate(n *html.Node) bool {
+	return n.Type == html.CommentNode &&
+		strings.HasPrefix(n.Data, string(placeholderInline))
+}
+
 func isTextBlock(n *html.Node) bool {
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
 		if c.Type == html.TextNode {
@@ -47,10 +92,76 @@ func isTextBlock(n *html.Node) bool {
 				return true
 			}
 		}
+		if isInlineTemplate(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAdjacentInline reports whether n has inline child elements that are
+// next to each other without any whitespace between them. Comments and
+// elements that are never displayed are skipped over. With punct, only
+// the elements whose text starts with punctuation such as a full stop or
+// a comma count as being next to the one before them. Elements with
+// BlockFormat in formats are not inline.
+func hasAdjacentInline(n *html.Node, punct bool, formats map[string]ElementFormat) bool {
+	inline := false
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.CommentNode && !isTemplateNode(c),
+			c.Type == html.ElementNode && hiddenElements[c.Data]:
+		case elementFormat(c, formats) == BlockFormat:
+			inline = false
+		case c.Type == html.ElementNode && !blockElements[c.Data] && !isTemplateNode(c):
+			if inline && (!punct || startsWithPunct(c)) {
+				return true
+			}
+			inline = true
+		default:
+			inline = false
+		}
 	}
 	return false
 }
 
+// startsWithPunct reports whether the first text within n starts with
+// punctuation that follows a word without a space, such as a full stop,
+// a comma or a closing bracket.
+func startsWithPunct(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.FirstChild {
+		if c.Type == html.TextNode {
+			r, _ := utf8.DecodeRuneInString(c.Data)
+			return strings.ContainsRune(".,;:!?%…", r) || unicode.In(r, unicode.Pe, unicode.Pf)
+		}
+		if c.Type != html.ElementNode || blockElements[c.Data] {
+			return false
+		}
+	}
+	return false
+}
+
+// Elements that are never displayed, so they do not separate the
+// elements around them.
+var hiddenElements = map[string]bool{
+	"base": true, "link": true, "meta": true, "script": true,
+	"style": true, "template": true, "title": true,
+}
+
+// prevSibling returns the previous sibling of n, skipping blank text.
+func prevSibling(n *html.Node) *html.Node {
+	for n = n.PrevSibling; isBlankText(n); n = n.PrevSibling {
+	}
+	return n
+}
+
+// nextSibling returns the next sibling of n, skipping blank text.
+func nextSibling(n *html.Node) *html.Node {
+	for n = n.NextSibling; isBlankText(n); n = n.NextSibling {
+	}
+	return n
+}
+
 func isVeryFirstNode(n *html.Node) bool {
 	return !hasParent(n) && !hasPrev(n)
 }
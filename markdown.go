@@ -0,0 +1,128 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The lines that start HTML blocks in Markdown, as in CommonMark. Blocks
+// of raw text elements end with their end tag, and the others end at a
+// blank line. A line with only a tag on it only starts a block when it is
+// not part of a paragraph.
+var (
+	markdownRawStart   = regexp.MustCompile(`(?i)^ {0,3}<(pre|script|style|textarea)(\s|>|$)`)
+	markdownBlockStart = regexp.MustCompile(`(?i)^ {0,3}</?(address|article|aside|base|basefont|blockquote|body|caption|center|col|colgroup|dd|details|dialog|dir|div|dl|dt|fieldset|figcaption|figure|footer|form|frame|frameset|h[1-6]|head|header|hr|html|iframe|legend|li|link|main|menu|menuitem|nav|noframes|ol|optgroup|option|p|param|search|section|summary|table|tbody|td|tfoot|th|thead|title|tr|track|ul)(\s|/?>|$)`)
+	markdownTagLine    = regexp.MustCompile(`^ {0,3}(<[A-Za-z][A-Za-z0-9-]*(\s[^<>]*)?/?>|</[A-Za-z][A-Za-z0-9-]*\s*>)\s*$`)
+	markdownFence      = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+// tidyMarkdown tidies the HTML blocks in a Markdown document, and leaves
+// the rest of it, including fenced code blocks, unchanged.
+func tidyMarkdown(b []byte, opts Options) ([]byte, error) {
+	opts.Fragment, opts.Context, opts.Template = true, "", NoTemplate
+	buf := bytes.Buffer{}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	fence := ""
+	blank := true
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if fence != "" {
+			// The fence is closed by one made of at least as many
+			// of the same character.
+			if m := markdownFence.FindSubmatch(line); m != nil && strings.HasPrefix(string(m[1]), fence) &&
+				len(bytes.TrimSpace(line[len(m[0]):])) == 0 {
+				fence = ""
+			}
+			buf.Write(line)
+			continue
+		}
+		if m := markdownFence.FindSubmatch(line); m != nil {
+			fence = string(m[1])
+			buf.Write(line)
+			continue
+		}
+
+		end := i
+		if m := markdownRawStart.FindSubmatch(line); m != nil {
+			closing := []byte("</" + strings.ToLower(string(m[1])) + ">")
+			for end < len(lines) && !bytes.Contains(bytes.ToLower(lines[end]), closing) {
+				end++
+			}
+			if end < len(lines) {
+				end++
+			}
+		} else if markdownBlockStart.Match(line) || blank && markdownTagLine.Match(line) {
+			for end < len(lines) && len(bytes.TrimSpace(lines[end])) != 0 {
+				end++
+			}
+		}
+		if end == i {
+			buf.Write(line)
+			blank = len(bytes.TrimSpace(line)) == 0
+			continue
+		}
+
+		block, err := tidyMarkdownBlock(bytes.Join(lines[i:end], nil), opts)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(block)
+		i = end - 1
+		blank = false
+	}
+	return buf.Bytes(), nil
+}
+
+// tidyMarkdownBlock tidies an HTML block from a Markdown document, at the
+// indentation of its first line. Blocks where the elements are not all
+// closed are left alone, because Markdown within them would be changed,
+// and so are those that would get blank lines, which would end the block.
+func tidyMarkdownBlock(block []byte, opts Options) ([]byte, error) {
+	if !isBalanced(block) {
+		return block, nil
+	}
+	out, err := tidyBytes(block, opts)
+	if err != nil {
+		return nil, err
+	}
+	indent := block[:len(block)-len(bytes.TrimLeft(block, " "))]
+	buf := bytes.Buffer{}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			return block, nil
+		}
+		buf.Write(indent)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if !bytes.HasSuffix(block, []byte("\n")) {
+		buf.Truncate(buf.Len() - 1)
+	}
+	return buf.Bytes(), nil
+}
+
+// isBalanced reports whether each element in b is closed within it.
+func isBalanced(b []byte) bool {
+	var stack []string
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return z.Err() == io.EOF && len(stack) == 0
+		case html.StartTagToken:
+			if name, _ := z.TagName(); !voidElements[string(name)] {
+				stack = append(stack, string(name))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if len(stack) == 0 || stack[len(stack)-1] != string(name) {
+				return false
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
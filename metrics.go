@@ -0,0 +1,34 @@
+package tidyhtml
+
+import (
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Metrics are measurements of tidying a document, as given to
+// Options.Metrics. Documents made of several parts that are tidied
+// separately, such as the blocks of HTML in Markdown, have the totals for
+// all of the parts.
+type Metrics struct {
+	// BytesIn is the size of the input, and BytesOut is the size of the
+	// output, or 0 if tidying failed.
+	BytesIn, BytesOut int
+
+	// Nodes is the number of nodes that the input was parsed into.
+	Nodes int
+
+	// ParseDuration and RenderDuration are how long was spent parsing
+	// the input and rendering the output, and Duration is how long the
+	// whole call took.
+	ParseDuration, RenderDuration, Duration time.Duration
+}
+
+// countNodes returns the number of nodes within n.
+func countNodes(n *html.Node) int {
+	count := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		count += 1 + countNodes(c)
+	}
+	return count
+}
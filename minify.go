@@ -0,0 +1,351 @@
+package tidyhtml
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Minify copies HTML from src to dst and makes it as small as possible
+// in the process, by doing the opposite of Copy.
+func Minify(dst io.Writer, src io.Reader) error {
+	return CopyWithOptions(dst, src, Options{Minify: true})
+}
+
+// minifier writes nodes without the whitespace that is not needed. When
+// minifying, it also leaves out the comments, quotes and attributes that
+// are not needed. Otherwise, when collapsing whitespace, it puts each
+// block element on its own line.
+type minifier struct {
+
+	// The options being used.
+	opts Options
+
+	// The template tags that were replaced with placeholders.
+	templates *templateSet
+
+	// The void elements that had a self-closing slash in the input,
+	// for PreserveSelfClosing.
+	selfClosed map[*html.Node]bool
+
+	// The offsets in the input of the elements whose positions are
+	// written in the output, for tidyWithAnchors.
+	positions map[*html.Node]int
+
+	// The number of <pre> and <textarea> elements that the current node
+	// is within, where whitespace is meaningful and must be kept.
+	pre int
+
+	// Whether anything has been written yet, and whether a line break
+	// is needed before anything else is written.
+	started, newline bool
+
+	err error
+}
+
+// Elements that are displayed as blocks by default, so that whitespace
+// around them does not affect rendering. The hiddenElements are not here,
+// as the whitespace around them is still seen, as if they were not there.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true,
+	"blockquote": true, "body": true, "caption": true, "col": true,
+	"colgroup": true, "dd": true, "details": true, "dialog": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"head": true, "header": true, "hgroup": true, "hr": true, "html": true,
+	"legend": true, "li": true, "main": true, "menu": true,
+	"nav": true, "ol": true, "optgroup": true, "option": true,
+	"p": true, "pre": true, "section": true,
+	"summary": true, "table": true, "tbody": true, "td": true,
+	"template": true, "tfoot": true, "th": true, "thead": true,
+	"tr": true, "ul": true,
+}
+
+// Elements where text is not displayed, so whitespace within them
+// can always be removed.
+var noTextElements = map[string]bool{
+	"colgroup": true, "datalist": true, "head": true, "html": true,
+	"optgroup": true, "select": true, "table": true, "tbody": true,
+	"tfoot": true, "thead": true, "tr": true,
+}
+
+// Attribute values that are the same as the default,
+// so the attributes can be left out.
+var redundantAttrs = map[string]map[string]string{
+	"script": {"type": "text/javascript", "language": "javascript"},
+	"style":  {"type": "text/css", "media": "all"},
+	"link":   {"type": "text/css"},
+	"form":   {"method": "get"},
+	"input":  {"type": "text"},
+	"area":   {"shape": "rect"},
+}
+
+// Characters that stop an attribute value from being written without quotes.
+const unquotedAttrUnsafe = " \t\n\f\r\"'=<>`"
+
+// minify renders a document or fragment without the parts that
+// are not needed.
+func (m *minifier) minify(n *html.Node) ([]byte, error) {
+	buf := bytes.Buffer{}
+	w := bufio.NewWriter(limitOutput(&buf, m.opts))
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		m.writeNode(w, c)
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	err := w.Flush()
+	return buf.Bytes(), err
+}
+
+func (m *minifier) writeString(w *bufio.Writer, s string) {
+	if s == "" {
+		return
+	}
+	if m.newline {
+		m.newline = false
+		m.writeString(w, "\n")
+	}
+	m.started = true
+	if m.err == nil {
+		_, m.err = w.WriteString(s)
+	}
+}
+
+// lineBreak puts the next node on a new line when collapsing whitespace,
+// which is only done next to block elements, where it is not rendered.
+func (m *minifier) lineBreak() {
+	if !m.opts.Minify && m.pre == 0 && m.started {
+		m.newline = true
+	}
+}
+
+func (m *minifier) writeNode(w *bufio.Writer, n *html.Node) {
+	switch n.Type {
+	case html.ElementNode:
+		m.writeEl(w, n)
+	case html.TextNode:
+		m.writeText(w, n)
+	case html.CommentNode:
+		// Template tags are written as their placeholders, and
+		// conditional comments are kept because they have meaning.
+		if isTemplateNode(n) {
+			m.writeString(w, n.Data)
+		} else if !isRemovedComment(n) || !m.opts.Minify {
+			m.writeString(w, "<!--"+n.Data+"-->")
+		}
+	case html.DoctypeNode:
+		m.writeString(w, "<!doctype "+n.Data+">")
+	case html.RawNode:
+		m.writeString(w, n.Data)
+	}
+}
+
+func (m *minifier) writeEl(w *bufio.Writer, n *html.Node) {
+	if m.templates.isBlock(n) {
+		m.writeString(w, n.Data)
+		m.writeChildren(w, n)
+		m.writeString(w, m.templates.closing(n))
+		return
+	}
+
+	// Hidden elements are only put on their own lines where
+	// whitespace is not displayed at all, such as in the <head>.
+	block := blockElements[n.Data] || hiddenElements[n.Data] && n.Parent != nil && noTextElements[n.Parent.Data]
+	if n.Data == "noscript" {
+		// The <noscript> elements are parsed as plain text, as when tidying.
+		parseTextNode(n)
+	}
+	if block {
+		m.lineBreak()
+	}
+	m.writeString(w, positionPlaceholder(n, m.positions)+"<"+n.Data)
+	for _, a := range n.Attr {
+		if isTemplateAttr(a) {
+			m.writeString(w, " "+a.Key)
+			continue
+		}
+		if !m.opts.Minify {
+			m.writeAttr(w, a)
+			continue
+		}
+		if isRedundantAttr(n, a) {
+			continue
+		}
+		m.writeString(w, " ")
+		if a.Namespace != "" {
+			m.writeString(w, a.Namespace+":")
+		}
+		m.writeString(w, a.Key)
+		val := escapeControls(strings.Replace(a.Val, "&", "&amp;", -1), m.opts.ControlChars, false)
+		switch {
+		case a.Val == "":
+			// Boolean attributes do not need a value.
+		case m.templates.isBareAttr(a.Val):
+			m.writeString(w, "="+a.Val)
+		case !strings.ContainsAny(m.templates.expand(a.Val), unquotedAttrUnsafe):
+			m.writeString(w, "="+val)
+		default:
+			// Use whichever quote needs escaping the least.
+			expanded := m.templates.expand(a.Val)
+			if strings.Count(expanded, `"`) > strings.Count(expanded, "'") {
+				m.writeString(w, "='"+strings.Replace(val, "'", "&#39;", -1)+"'")
+			} else {
+				m.writeString(w, `="`+strings.Replace(val, `"`, "&#34;", -1)+`"`)
+			}
+		}
+	}
+	if selfClosing(m.opts.SelfClosing, n, m.selfClosed) {
+		m.writeString(w, " /")
+	}
+	m.writeString(w, ">")
+	if isVoid(n) {
+		if block {
+			m.lineBreak()
+		}
+		return
+	}
+
+	if n.Data == "pre" || n.Data == "textarea" {
+		// The parser removes a line break at the start,
+		// so another one is needed to keep it.
+		if c := n.FirstChild; c != nil && c.Type == html.TextNode && strings.HasPrefix(c.Data, "\n") {
+			m.writeString(w, "\n")
+		}
+		m.pre++
+		m.writeChildren(w, n)
+		m.pre--
+	} else {
+		m.writeChildren(w, n)
+	}
+	if m.opts.Minify && n.Parent != nil && noTextElements[n.Parent.Data] {
+		// The whitespace after the element is not written, so it does not
+		// stop the end tag of a <head>, <colgroup> or <caption> from being
+		// left out, as it would not when the output is minified again.
+		for s := n.NextSibling; isBlankText(s); s = n.NextSibling {
+			n.Parent.RemoveChild(s)
+		}
+	}
+	if (!m.opts.OmitEndTags || !m.templates.canOmitEndTag(n)) && n.Data != "plaintext" && !isSelfClosedComponent(n, m.selfClosed) {
+		m.writeString(w, "</"+n.Data+">")
+	}
+	if block {
+		m.lineBreak()
+	}
+}
+
+// writeAttr writes an attribute in the same way as when tidying.
+func (m *minifier) writeAttr(w *bufio.Writer, a html.Attribute) {
+	m.writeString(w, " ")
+	if a.Namespace != "" {
+		m.writeString(w, a.Namespace+":")
+	}
+	m.writeString(w, a.Key+"=")
+	if m.templates.isBareAttr(a.Val) {
+		m.writeString(w, a.Val)
+	} else if strings.Contains(m.templates.expand(a.Val), `"`) {
+		m.writeString(w, "'"+escapeAttr(a.Val, m.opts)+"'")
+	} else {
+		m.writeString(w, `"`+escapeAttr(a.Val, m.opts)+`"`)
+	}
+}
+
+func (m *minifier) writeChildren(w *bufio.Writer, n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		m.writeNode(w, c)
+	}
+}
+
+func (m *minifier) writeText(w *bufio.Writer, n *html.Node) {
+	if p := n.Parent; m.pre > 0 || p != nil && rawTextElements[p.Data] {
+		m.writeString(w, escapeText(n, n.Data, m.opts))
+		return
+	}
+
+	s := collapseSpace(n.Data)
+	if s == " " && n.Parent != nil && noTextElements[n.Parent.Data] {
+		return
+	}
+	if strings.HasPrefix(s, " ") && isBlockBoundary(n.Parent, prevNode(n)) {
+		s = s[1:]
+	}
+	if strings.HasSuffix(s, " ") {
+		// Leave the space for the next text node when there is one.
+		next := nextNode(n)
+		if isBlockBoundary(n.Parent, next) || next != nil && next.Type == html.TextNode && startsWithSpace(next.Data) {
+			s = s[:len(s)-1]
+		}
+	}
+	m.writeString(w, escapeText(n, s, m.opts))
+}
+
+// collapseSpace replaces each run of whitespace with a single space.
+func collapseSpace(s string) string {
+	b := strings.Builder{}
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\f' || r == '\r' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.IndexByte(" \t\n\f\r", s[0]) != -1
+}
+
+// isBlockBoundary reports whether whitespace next to a sibling, or at the
+// start or end of the parent when there is no sibling, cannot be seen.
+func isBlockBoundary(parent, sibling *html.Node) bool {
+	if sibling == nil {
+		return parent == nil || parent.Type != html.ElementNode || blockElements[parent.Data]
+	}
+	return sibling.Type == html.ElementNode && blockElements[sibling.Data]
+}
+
+// prevNode returns the previous sibling, skipping comments that are removed
+// and hidden elements, which the whitespace on either side of is seen
+// across as if they were not there.
+func prevNode(n *html.Node) *html.Node {
+	for n = n.PrevSibling; n != nil && isSkippedNode(n); n = n.PrevSibling {
+	}
+	return n
+}
+
+// nextNode returns the next sibling, skipping the same nodes as prevNode.
+func nextNode(n *html.Node) *html.Node {
+	for n = n.NextSibling; n != nil && isSkippedNode(n); n = n.NextSibling {
+	}
+	return n
+}
+
+func isSkippedNode(n *html.Node) bool {
+	return isRemovedComment(n) || n.Type == html.ElementNode && hiddenElements[n.Data] && !blockElements[n.Data]
+}
+
+func isRemovedComment(n *html.Node) bool {
+	return n.Type == html.CommentNode && !isTemplateNode(n) &&
+		!strings.HasPrefix(n.Data, "[if") && !strings.HasPrefix(n.Data, "<![endif]")
+}
+
+func isRedundantAttr(n *html.Node, a html.Attribute) bool {
+	if a.Namespace != "" {
+		return false
+	}
+	val, ok := redundantAttrs[n.Data][a.Key]
+	return ok && strings.EqualFold(a.Val, val)
+}
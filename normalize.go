@@ -0,0 +1,48 @@
+package tidyhtml
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/text/unicode/norm"
+)
+
+// mergeText merges adjacent text nodes within n, and removes empty ones.
+// The parser does not leave adjacent text nodes, but removing elements
+// can, such as when sanitizing. The renderer decides how to write the
+// whitespace in each text node by looking at its siblings, so merging
+// them means that the decision is made once for each run of text.
+func mergeText(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type != html.TextNode:
+			mergeText(c)
+		case c.Data == "":
+			n.RemoveChild(c)
+		case next != nil && next.Type == html.TextNode:
+			c.Data += next.Data
+			n.RemoveChild(next)
+			next = c
+		}
+		c = next
+	}
+}
+
+// normalizeNFC puts the text and attribute values within n into Unicode
+// Normalization Form C, so that characters such as é are written the same
+// way whether they were composed or decomposed. The text of elements such
+// as <script> and <style> is left alone, as it is code.
+func normalizeNFC(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if p := n.Parent; p == nil || !rawTextElements[p.Data] || p.Data == "textarea" || p.Data == "title" {
+			n.Data = norm.NFC.String(n.Data)
+		}
+	case html.ElementNode:
+		for i, a := range n.Attr {
+			n.Attr[i].Val = norm.NFC.String(a.Val)
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		normalizeNFC(c)
+	}
+}
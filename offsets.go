@@ -0,0 +1,222 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"golang.org/x/net/html"
+)
+
+// FormatWithOffsets tidies src like CopyWithOptions, and also maps byte
+// offsets in src, such as the position of the cursor or the ends of the
+// selection in an editor, to the corresponding offsets in the output, so
+// that they can be put back in the same place after formatting.
+//
+// An offset is mapped to the start tag of the element that comes before
+// it, and then moved on past the same number of characters other than
+// whitespace and quotes as there are between the start tag and the offset
+// in src. This is exact for changes in whitespace, indentation and the
+// quoting of attributes, which are most of the changes that tidying
+// makes, and close for the others.
+// Offsets that are out of range are mapped to the start or end of the
+// output.
+func FormatWithOffsets(src []byte, opts Options, offsets []int) ([]byte, []int, error) {
+	out, anchors, err := tidyWithAnchors(src, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	mapped := make([]int, len(offsets))
+	for i, off := range offsets {
+		mapped[i] = mapOffset(src, out, anchors, off)
+	}
+	return out, mapped, nil
+}
+
+// An anchor is the offset of the start of an element's start tag in the
+// input, and where that start tag was written in the output.
+type anchor struct {
+	in, out int
+}
+
+// positionMark is the name of an attribute that markPositions adds to each
+// start tag, with the offset of the tag in the input as its value. The
+// renderers write the elements that had one with a placeholder made of
+// the mark, the offset and placeholderEnd just before their start tags.
+const positionMark = "\uE005"
+
+var (
+	positionRegexp     = regexp.MustCompile(positionMark + `([0-9]+)` + string(placeholderEnd))
+	positionAttrRegexp = regexp.MustCompile(` ` + positionMark + `=([0-9]+)`)
+)
+
+// tidyWithAnchors tidies src with the positions of its elements marked,
+// and returns the output with the marks removed, and the anchors that
+// they show, in order of where they are in the input.
+func tidyWithAnchors(src []byte, opts Options) (out []byte, anchors []anchor, err error) {
+	opts.positions = true
+	limit := opts.MaxOutputBytes
+	opts.MaxOutputBytes = 0
+	// The metrics are for the input and output without the marks.
+	var m *Metrics
+	if report := opts.Metrics; report != nil {
+		opts.Metrics = func(got Metrics) { m = &got }
+		defer func() {
+			m.BytesIn = len(src)
+			if out == nil {
+				m.BytesOut = 0
+			} else {
+				m.BytesOut = len(out)
+			}
+			report(*m)
+		}()
+	}
+	buf := bytes.Buffer{}
+	if err := CopyWithOptions(&buf, bytes.NewReader(markPositions(src)), opts); err != nil {
+		return nil, nil, err
+	}
+
+	// Marks in sections that were not tidied, such as prose in Markdown,
+	// are still attributes.
+	marked := buf.Bytes()
+	out = make([]byte, 0, len(marked))
+	for len(marked) != 0 {
+		loc := positionRegexp.FindSubmatchIndex(marked)
+		attr := positionAttrRegexp.FindSubmatchIndex(marked)
+		if loc == nil || attr != nil && attr[0] < loc[0] {
+			loc = attr
+		}
+		if loc == nil {
+			out = append(out, marked...)
+			break
+		}
+		out = append(out, marked[:loc[0]]...)
+		in, _ := strconv.Atoi(string(marked[loc[2]:loc[3]]))
+		at := len(out)
+		if marked[loc[0]] == ' ' {
+			// The attribute comes just after the tag name.
+			at = bytes.LastIndexByte(out, '<')
+		}
+		anchors = append(anchors, anchor{in, at})
+		marked = marked[loc[1]:]
+	}
+	if limit > 0 && len(out) > limit {
+		return nil, nil, &LimitError{"MaxOutputBytes", limit}
+	}
+	sort.SliceStable(anchors, func(i, j int) bool { return anchors[i].in < anchors[j].in })
+	return out, anchors, nil
+}
+
+// mapOffset maps an offset in the input to one in the output.
+func mapOffset(in, out []byte, anchors []anchor, off int) int {
+	if off <= 0 {
+		return 0
+	}
+	if off >= len(in) {
+		return len(out)
+	}
+	a, limit := anchor{}, len(out)
+	if i := sort.Search(len(anchors), func(i int) bool { return anchors[i].in > off }); i > 0 {
+		a = anchors[i-1]
+		if i < len(anchors) && anchors[i].out > a.out {
+			limit = anchors[i].out
+		}
+	}
+
+	// Count the characters up to the offset, apart from whitespace and
+	// the quotes that may be added around attribute values, and then pass
+	// the same number in the output.
+	n := 0
+	for _, c := range in[a.in:off] {
+		if isCounted(c) {
+			n++
+		}
+	}
+	j := a.out
+	for ; j < limit && n > 0; j++ {
+		if isCounted(out[j]) {
+			n--
+		}
+	}
+	if !isHTMLSpace(rune(in[off])) {
+		// The offset is before a character, so skip the whitespace
+		// before it in the output.
+		for j < limit && isHTMLSpace(rune(out[j])) {
+			j++
+		}
+	}
+	return j
+}
+
+func isCounted(c byte) bool {
+	return !isHTMLSpace(rune(c)) && c != '"' && c != '\''
+}
+
+// markPositions adds the positionMark attribute to each start tag in b,
+// just after the tag name.
+func markPositions(b []byte) []byte {
+	buf := bytes.Buffer{}
+	buf.Grow(len(b) + len(b)/8)
+	z := html.NewTokenizer(bytes.NewReader(b))
+	offset := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// Keep anything that the tokenizer did not return.
+			buf.Write(b[offset:])
+			break
+		}
+		raw := z.Raw()
+		start := offset
+		offset += len(raw)
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			buf.Write(raw)
+			continue
+		}
+		i := 1
+		for i < len(raw) && !isTagSpace(rune(raw[i])) && raw[i] != '/' && raw[i] != '>' {
+			i++
+		}
+		buf.Write(raw[:i])
+		buf.WriteString(" " + positionMark + "=" + strconv.Itoa(start))
+		buf.Write(raw[i:])
+	}
+	return buf.Bytes()
+}
+
+// takePositions removes the positionMark attributes from n and its
+// descendants, and returns the input offsets of the elements that had
+// them.
+func takePositions(n *html.Node) map[*html.Node]int {
+	found := map[*html.Node]int{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if a.Key == positionMark {
+					n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+					if off, err := strconv.Atoi(a.Val); err == nil {
+						found[n] = off
+					}
+					break
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// positionPlaceholder returns what the renderers write before the start
+// tag of an element to show where it was in the input, if it is known.
+func positionPlaceholder(n *html.Node, positions map[*html.Node]int) string {
+	off, ok := positions[n]
+	if !ok {
+		return ""
+	}
+	return positionMark + strconv.Itoa(off) + string(placeholderEnd)
+}
@@ -0,0 +1,91 @@
+package tidyhtml
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements that end a <p> element when they start.
+var closesParagraph = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"details": true, "dialog": true, "div": true, "dl": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hgroup": true, "hr": true, "main": true,
+	"menu": true, "nav": true, "ol": true, "p": true, "pre": true,
+	"search": true, "section": true, "table": true, "ul": true,
+}
+
+// Elements where the end tag of a <p> element at the end of their
+// content cannot be left out.
+var keepsParagraphEnd = map[string]bool{
+	"a": true, "audio": true, "del": true, "ins": true, "map": true,
+	"noscript": true, "video": true,
+}
+
+// canOmitEndTag reports whether the end tag of an element can be left out
+// without changing the document, following the rules in section 13.1.2.4
+// of the HTML standard, "Optional tags".
+func (ts *templateSet) canOmitEndTag(n *html.Node) bool {
+	if n.Type != html.ElementNode || ts.isBlock(n) || n.Parent != nil && ts.isBlock(n.Parent) {
+		return false
+	}
+
+	// Find what follows the element, ignoring whitespace,
+	// but keep track of whether there was any.
+	next, space := n.NextSibling, false
+	for isBlankText(next) {
+		next, space = next.NextSibling, true
+	}
+	last := next == nil
+	comment := next != nil && next.Type == html.CommentNode
+	followedBy := func(names ...string) bool {
+		if next == nil || next.Type != html.ElementNode || ts.isBlock(next) {
+			return false
+		}
+		for _, name := range names {
+			if next.Data == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch n.Data {
+	case "html", "body":
+		return !comment
+	case "head", "colgroup", "caption":
+		return !comment && !space
+	case "li":
+		return last || followedBy("li")
+	case "dt":
+		return followedBy("dt", "dd")
+	case "dd":
+		return last || followedBy("dd", "dt")
+	case "p":
+		if last {
+			p := n.Parent
+			return p == nil || p.Type != html.ElementNode ||
+				!keepsParagraphEnd[p.Data] && !strings.Contains(p.Data, "-")
+		}
+		return next.Type == html.ElementNode && !ts.isBlock(next) && closesParagraph[next.Data]
+	case "rt", "rp":
+		return last || followedBy("rt", "rp")
+	case "optgroup":
+		return last || followedBy("optgroup", "hr")
+	case "option":
+		return last || followedBy("option", "optgroup", "hr")
+	case "thead":
+		return followedBy("tbody", "tfoot")
+	case "tbody":
+		return last || followedBy("tbody", "tfoot")
+	case "tfoot":
+		return last
+	case "tr":
+		return last || followedBy("tr")
+	case "td", "th":
+		return last || followedBy("td", "th")
+	}
+	return false
+}
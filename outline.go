@@ -0,0 +1,94 @@
+package tidyhtml
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// OutlineItem is a heading or a sectioning element in the outline of a
+// document, as returned by Outline.
+type OutlineItem struct {
+
+	// Tag is the name of the element, such as "h2" or "section".
+	Tag string
+
+	// Text is the text of a heading, with its whitespace collapsed, or
+	// the aria-label of a sectioning element, if it has one.
+	Text string
+
+	// Depth is how deeply the item is nested in the outline, starting
+	// at 0. Headings are nested within the sectioning elements that they
+	// are in, and within the headings of higher levels before them in the
+	// same section, and so are sectioning elements.
+	Depth int
+}
+
+var sectioningElements = map[string]bool{
+	"article": true, "aside": true, "nav": true, "section": true,
+}
+
+// Outline parses a document, as controlled by the Fragment, Context and
+// Charset options, and returns its headings and sectioning elements in
+// the order that they appear.
+func Outline(src io.Reader, opts Options) ([]OutlineItem, error) {
+	doc, err := Parse(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	var items []OutlineItem
+	// The levels of the headings that later items in the current
+	// section are nested within.
+	var walk func(n *html.Node, depth int, levels *[]int)
+	walk = func(n *html.Node, depth int, levels *[]int) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.Namespace != "" {
+				continue
+			}
+			if level := headingLevel(c); level != 0 {
+				for len(*levels) != 0 && (*levels)[len(*levels)-1] >= level {
+					*levels = (*levels)[:len(*levels)-1]
+				}
+				items = append(items, OutlineItem{c.Data, textContent(c), depth + len(*levels)})
+				*levels = append(*levels, level)
+				continue
+			}
+			if sectioningElements[c.Data] {
+				label, _ := attrValue(c, "aria-label")
+				d := depth + len(*levels)
+				items = append(items, OutlineItem{c.Data, label, d})
+				walk(c, d+1, &[]int{})
+				continue
+			}
+			walk(c, depth, levels)
+		}
+	}
+	walk(doc, 0, &[]int{})
+	return items, nil
+}
+
+// headingLevel returns the level of an <h1> to <h6> element, or 0.
+func headingLevel(n *html.Node) int {
+	if len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6' {
+		return int(n.Data[1] - '0')
+	}
+	return 0
+}
+
+// textContent returns the text within a node, with its whitespace
+// collapsed.
+func textContent(n *html.Node) string {
+	b := strings.Builder{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(collapseSpace(b.String()))
+}
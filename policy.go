@@ -0,0 +1,129 @@
+package tidyhtml
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Policy is an allowlist of elements, attributes and URL schemes, for
+// Options.Policy. Everything that it does not allow is removed before
+// the document is rendered.
+//
+// Elements that are not allowed are replaced by their contents, except
+// for elements such as <script> and <style> whose contents are not text,
+// which are removed along with their contents. The <html>, <head> and
+// <body> elements are always kept, so that documents keep their shape.
+type Policy struct {
+
+	// Elements maps the names of the allowed elements to the
+	// attributes that are allowed on them.
+	Elements map[string][]string
+
+	// GlobalAttrs are the attributes that are allowed on all of the
+	// allowed elements, such as "class" and "title".
+	GlobalAttrs []string
+
+	// URLSchemes are the schemes allowed in attributes that contain URLs,
+	// such as "https" and "mailto". Relative URLs are always allowed.
+	// When it is empty, any scheme is allowed.
+	URLSchemes []string
+}
+
+// Elements that are always kept by a Policy.
+var structuralElements = map[string]bool{"html": true, "head": true, "body": true}
+
+// apply removes everything that the policy does not allow from the
+// children of n.
+func (p *Policy) apply(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		p.apply(c)
+		if c.Type == html.ElementNode && !isTemplateNode(c) {
+			if attrs, ok := p.Elements[c.Data]; ok || structuralElements[c.Data] {
+				c.Attr = p.filterAttrs(c.Attr, attrs)
+			} else {
+				if !rawTextElements[c.Data] {
+					for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+						c.RemoveChild(gc)
+						n.InsertBefore(gc, c)
+					}
+				}
+				n.RemoveChild(c)
+			}
+		}
+		c = next
+	}
+}
+
+// filterAttrs returns the attributes that are allowed, given the
+// attributes that are allowed for the element.
+func (p *Policy) filterAttrs(attrs []html.Attribute, allowed []string) []html.Attribute {
+	kept := attrs[:0]
+	for _, a := range attrs {
+		key := a.Key
+		if a.Namespace != "" {
+			key = a.Namespace + ":" + a.Key
+		}
+		switch {
+		case isTemplateAttr(a):
+		case !contains(allowed, key) && !contains(p.GlobalAttrs, key):
+			continue
+		case urlAttrs[key] && !p.allowsURL(a.Val):
+			continue
+		}
+		kept = append(kept, a)
+	}
+	return kept
+}
+
+// allowsURL reports whether a URL is relative, or uses an allowed scheme.
+func (p *Policy) allowsURL(url string) bool {
+	if len(p.URLSchemes) == 0 {
+		return true
+	}
+	scheme := urlScheme(url)
+	if scheme == "" {
+		return true
+	}
+	for _, s := range p.URLSchemes {
+		if strings.EqualFold(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlScheme returns the scheme of a URL, without the colon,
+// or an empty string for a relative URL. The URL is read as browsers
+// read it, which is after removing the tabs and line breaks within it,
+// and the control characters and spaces around it.
+func urlScheme(url string) string {
+	url = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, url)
+	url = strings.TrimFunc(url, func(r rune) bool { return r <= ' ' })
+	for i, r := range url {
+		switch {
+		case r == ':':
+			return url[:i]
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case i > 0 && ('0' <= r && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
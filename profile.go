@@ -0,0 +1,81 @@
+package tidyhtml
+
+import (
+	"fmt"
+	"sort"
+)
+
+// profiles are the named presets of options. Each one sets
+// some of the options, and leaves the others as they are.
+var profiles = map[string]func(*Options){
+	"default": func(o *Options) {
+		o.Indent = DefaultIndent
+	},
+	"2space": func(o *Options) {
+		o.Indent = "  "
+	},
+	"tab": func(o *Options) {
+		o.Indent = "\t"
+	},
+	"prettier": func(o *Options) {
+		o.Indent = "  "
+		o.FinalNewline = true
+		o.TrimTrailingSpace = true
+	},
+	"compact": func(o *Options) {
+		o.CollapseWhitespace = true
+		o.FinalNewline = true
+	},
+	// The canonical form is for snapshots, which should only change when
+	// the content does. Whitespace is collapsed, and the characters
+	// that can be written in more than one way are written in one of
+	// them. Entities, quotes and the doctype are always written the same
+	// way anyway.
+	"canonical": func(o *Options) {
+		o.CollapseWhitespace = true
+		o.SortAttributes = true
+		o.EscapeNBSP = true
+		o.NFC = true
+		o.ControlChars = EscapeControlChars
+		o.LineEnding = "\n"
+		o.FinalNewline = true
+		o.TrimTrailingSpace = true
+	},
+	// HTML email is rendered by clients such as Outlook where whitespace
+	// between inline elements and table cells can show, and which use
+	// VML and Office elements. Conditional comments, including the
+	// downlevel-revealed <!--[if !mso]><!--> kind, are always kept
+	// as they are, and attributes are never reordered.
+	"amp": func(o *Options) {
+		o.AMP = true
+		o.FinalNewline = true
+	},
+	"email": func(o *Options) {
+		o.SafeWhitespace = true
+		o.NamespacePrefixes = true
+		o.SelfClosing = PreserveSelfClosing
+		o.FinalNewline = true
+	},
+}
+
+// ProfileNames returns the names of the profiles, in order.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile sets the options from a named profile, which is a preset
+// bundle of options such as "prettier" or "2space", leaving the options
+// that are not part of the profile as they are.
+func ApplyProfile(name string, opts Options) (Options, error) {
+	f, ok := profiles[name]
+	if !ok {
+		return opts, fmt.Errorf("tidyhtml: unknown profile: %q", name)
+	}
+	f(&opts)
+	return opts, nil
+}
@@ -0,0 +1,198 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// FormatRange tidies the elements of src that are entirely within the
+// lines from startLine to endLine, which are numbered from 1 and include
+// both ends, and leaves the rest of src byte for byte as it was. It is for
+// formatting a selection in an editor, and for large files where tidying
+// all of the file would change too much.
+//
+// Elements that are next to each other within the range are tidied
+// together, as a fragment within their parent, and are indented to match
+// the line where they start. An element that starts or ends outside of the
+// range is not changed, although the elements within it can be, and so
+// are the <html>, <head> and <body> elements themselves. The
+// input must already be UTF-8, and the options for the output as a whole,
+// such as FinalNewline and BOM, are not used.
+func FormatRange(src []byte, startLine, endLine int, opts Options) ([]byte, error) {
+	if startLine < 1 || endLine < startLine {
+		return nil, fmt.Errorf("tidyhtml: invalid line range: %d-%d", startLine, endLine)
+	}
+	lo, hi := lineOffset(src, startLine), lineOffset(src, endLine+1)
+	return tidySpans(src, containedSpans(src, lo, hi), opts)
+}
+
+// tidySpans tidies each of the spans of src as a fragment within its
+// parent, indented to match the line where it starts, and leaves the rest
+// of src as it was.
+func tidySpans(src []byte, spans []span, opts Options) ([]byte, error) {
+	newline := opts.LineEnding
+	if newline == "" {
+		newline = "\n"
+	}
+	opts.FinalNewline, opts.LineEnding = false, ""
+	if opts.Template == Markdown {
+		opts.Template = NoTemplate
+	}
+
+	buf := bytes.Buffer{}
+	last := 0
+	for _, s := range spans {
+		opts.Fragment, opts.Context = true, s.parent
+		out, err := tidyBytes(src[s.start:s.end], opts)
+		if err != nil {
+			return nil, err
+		}
+		out = bytes.TrimRight(finishLines(out, opts), "\n")
+		if len(out) == 0 {
+			continue
+		}
+
+		// Continuation lines are indented like the line where the span
+		// starts, and one more level if it is within an element that
+		// starts on the same line.
+		lineStart := bytes.LastIndexByte(src[:s.start], '\n') + 1
+		before := src[lineStart:s.start]
+		indent := before[:len(before)-len(bytes.TrimLeft(before, " \t"))]
+		if len(indent) != len(before) {
+			indent = append(append([]byte{}, indent...), opts.indentation()...)
+		}
+		buf.Write(src[last:s.start])
+		for i, line := range bytes.Split(out, []byte("\n")) {
+			if i > 0 {
+				buf.WriteString(newline)
+				if len(line) != 0 {
+					buf.Write(indent)
+				}
+			}
+			buf.Write(line)
+		}
+		last = s.end
+	}
+	if last == 0 {
+		return src, nil
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
+
+// lineOffset returns the offset of the start of a line, numbered from 1,
+// or the length of b if there are not that many lines.
+func lineOffset(b []byte, line int) int {
+	off := 0
+	for ; line > 1; line-- {
+		i := bytes.IndexByte(b[off:], '\n')
+		if i == -1 {
+			return len(b)
+		}
+		off += i + 1
+	}
+	return off
+}
+
+// A span is a run of sibling elements in the source, from the start of the
+// first one to the end of the last one, with the name of their parent.
+type span struct {
+	start, end int
+	parent     string
+	id         int
+}
+
+// containedSpans returns the runs of sibling elements in b that start and
+// end between lo and hi, leaving out those that are within others.
+func containedSpans(b []byte, lo, hi int) []span {
+	type frame struct {
+		name  string
+		start int
+		id    int
+	}
+	var stack []frame
+	var spans []span
+	ids := 0
+	offset := 0
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return nil
+			}
+			break
+		}
+		start := offset
+		offset += len(z.Raw())
+		parent, parentID := "", 0
+		if len(stack) != 0 {
+			parent, parentID = stack[len(stack)-1].name, stack[len(stack)-1].id
+		}
+
+		var s span
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if !voidElements[string(name)] {
+				ids++
+				stack = append(stack, frame{string(name), start, ids})
+				continue
+			}
+			s = span{start, offset, parent, parentID}
+		case html.SelfClosingTagToken:
+			s = span{start, offset, parent, parentID}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			i := len(stack) - 1
+			for i >= 0 && stack[i].name != string(name) {
+				i--
+			}
+			if i < 0 {
+				continue
+			}
+			// Elements that are still open were closed implicitly,
+			// so where they end is not known.
+			f := stack[i]
+			stack = stack[:i]
+			if documentElements[f.name] {
+				// These cannot be tidied as fragments, but the
+				// elements within them can.
+				continue
+			}
+			s = span{f.start, offset, "", 0}
+			if i > 0 {
+				s.parent, s.id = stack[i-1].name, stack[i-1].id
+			}
+		default:
+			continue
+		}
+		if s.start < lo || s.end > hi {
+			continue
+		}
+
+		// Spans within this one are left out, and one just before it
+		// with the same parent is joined to it.
+		for len(spans) != 0 && spans[len(spans)-1].start >= s.start {
+			spans = spans[:len(spans)-1]
+		}
+		if n := len(spans); n != 0 && spans[n-1].id == s.id && spans[n-1].parent == s.parent && isSiblingGap(b[spans[n-1].end:s.start]) {
+			spans[n-1].end = s.end
+			continue
+		}
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+var documentElements = map[string]bool{"html": true, "head": true, "body": true}
+
+// isSiblingGap reports whether the source between two sibling elements
+// can be tidied along with them, which is when it has no tags that close
+// or open anything.
+func isSiblingGap(b []byte) bool {
+	return bytes.IndexByte(b, '<') == -1 || isBalanced(b)
+}
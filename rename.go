@@ -0,0 +1,75 @@
+package tidyhtml
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ObsoleteRenames maps obsolete elements to the modern elements that
+// they can be replaced with without changing the document, for use
+// with Options.RenameElements.
+var ObsoleteRenames = map[string]string{
+	"acronym": "abbr",
+	"dir":     "ul",
+	"listing": "pre",
+	"strike":  "s",
+	"tt":      "code",
+}
+
+// SemanticRenames maps presentational elements to the elements that
+// give their text the same appearance and also say what it means, such
+// as b to strong. These change the meaning of the document, so they are
+// only used when asked for.
+var SemanticRenames = map[string]string{
+	"b": "strong",
+	"i": "em",
+}
+
+// ParseRenames parses element renames in the form "b=strong,i=em". The
+// names "obsolete" and "semantic" can be used for ObsoleteRenames and
+// SemanticRenames.
+func ParseRenames(s string) (map[string]string, error) {
+	renames := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch {
+		case item == "":
+		case item == "obsolete":
+			addRenames(renames, ObsoleteRenames)
+		case item == "semantic":
+			addRenames(renames, SemanticRenames)
+		default:
+			i := strings.IndexByte(item, '=')
+			from, to := "", ""
+			if i != -1 {
+				from, to = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+			}
+			if from == "" || to == "" {
+				return nil, fmt.Errorf("tidyhtml: invalid rename: %q, expected from=to", item)
+			}
+			renames[from] = to
+		}
+	}
+	return renames, nil
+}
+
+func addRenames(dst, src map[string]string) {
+	for from, to := range src {
+		dst[from] = to
+	}
+}
+
+// renameElements renames the HTML elements within n.
+func renameElements(n *html.Node, renames map[string]string) {
+	if n.Type == html.ElementNode && n.Namespace == "" {
+		if to, ok := renames[n.Data]; ok && to != "" {
+			n.Data, n.DataAtom = to, atom.Lookup([]byte(to))
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		renameElements(c, renames)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
-	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 type tidy struct {
@@ -26,6 +28,33 @@ type tidy struct {
 	// a child node with actual text, not counting blank text nodes.
 	textBlock int
 
+	// The options being used.
+	opts Options
+
+	// The indentation for the deepest level reached so far, which the
+	// indentation for the other levels is taken from.
+	indents string
+
+	// The expected size of the output, used to allocate enough
+	// space for it at the start.
+	size int
+
+	// The template tags that were replaced with placeholders.
+	templates *templateSet
+
+	// The void elements that had a self-closing slash in the input,
+	// for PreserveSelfClosing.
+	selfClosed map[*html.Node]bool
+
+	// The offsets in the input of the elements whose positions are
+	// written in the output, for tidyWithAnchors.
+	positions map[*html.Node]int
+
+	// The elements to put a blank line before and after, and whether
+	// a blank line is wanted before the next line.
+	blankBefore, blankAfter selector
+	blankLine               bool
+
 	err error
 }
 
@@ -34,6 +63,7 @@ func newTidy() tidy {
 		indent:    0,
 		preBlock:  -1,
 		textBlock: -1,
+		templates: newTemplateSet(Options{}),
 		err:       nil,
 	}
 }
@@ -51,6 +81,23 @@ func (t *tidy) inPreBlock() bool {
 	return t.preBlock != -1
 }
 
+// isPreBlock - is n the pre that started the current pre block?
+func (t *tidy) isPreBlock(n *html.Node) bool {
+	return n.Data == "pre" && t.preBlock == t.indent
+}
+
+// withinPreBlock - is the current node within a pre block, rather than
+// the element that started it? Elements with PreFormat are written where
+// they are like other elements, with their content kept as it is.
+func (t *tidy) withinPreBlock() bool {
+	return t.inPreBlock() && t.preBlock != t.indent
+}
+
+// format - how is the node to be written, as set by ElementFormats?
+func (t *tidy) format(n *html.Node) ElementFormat {
+	return elementFormat(n, t.opts.ElementFormats)
+}
+
 // inTextBlock - is the current node within a text block?
 func (t *tidy) inTextBlock() bool {
 	return t.textBlock != -1
@@ -61,14 +108,97 @@ func (t *tidy) isTextBlock() bool {
 	return t.textBlock == t.indent
 }
 
+// isTextBlockNode - should the node start a text block? This includes
+// nodes with an inline child followed by another that starts with
+// punctuation, which must not be separated by putting them on their own
+// lines, and with SafeWhitespace, any inline children next to each other.
+// Elements with InlineFormat start one, and so do their parents, so that
+// they are written on the same line as the nodes around them.
+func (t *tidy) isTextBlockNode(n *html.Node) bool {
+	if t.format(n) == InlineFormat {
+		return true
+	}
+	for c := n.FirstChild; c != nil && len(t.opts.ElementFormats) != 0; c = c.NextSibling {
+		if t.format(c) == InlineFormat {
+			return true
+		}
+	}
+	return isTextBlock(n) || hasAdjacentInline(n, !t.opts.SafeWhitespace, t.opts.ElementFormats)
+}
+
+// parseBlankLines parses the BlankLineBefore and BlankLineAfter selectors.
+func (t *tidy) parseBlankLines() (err error) {
+	if t.opts.BlankLineBefore != "" {
+		if t.blankBefore, err = parseSelector(t.opts.BlankLineBefore); err != nil {
+			return err
+		}
+	}
+	if t.opts.BlankLineAfter != "" {
+		if t.blankAfter, err = parseSelector(t.opts.BlankLineAfter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isCompactRow - should the node be written on a single line, as a table
+// row that fits within CompactTableWidth, or an element with CompactFormat
+// that fits within it or DefaultCompactWidth?
+func (t *tidy) isCompactRow(n *html.Node) bool {
+	maxWidth := t.opts.CompactTableWidth
+	switch {
+	case t.format(n) == CompactFormat:
+		if maxWidth <= 0 {
+			maxWidth = DefaultCompactWidth
+		}
+	case n.Data != "tr" || maxWidth <= 0:
+		return false
+	default:
+		// Whitespace between the cells is not displayed, so it can be
+		// removed instead of becoming spaces between them.
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if isBlankText(c) {
+				n.RemoveChild(c)
+			}
+			c = next
+		}
+	}
+
+	// Write the row on its own as a text block, to see how long it is.
+	row := newTidy()
+	row.opts = t.opts
+	row.templates = t.templates
+	row.textBlock = 0
+	out, err := row.render(cloneNode(n))
+	if err != nil || bytes.IndexByte(out, '\n') != -1 {
+		return false
+	}
+	width := utf8.RuneCountInString(t.opts.indentation())*t.indent +
+		utf8.RuneCountInString(t.templates.expand(string(out)))
+	return width <= maxWidth
+}
+
+// fragmentTextBlock is the level of the text block made by the nodes at the
+// top level of a fragment. It is above the top level, which the nodes are at
+// once the document node is thrown away, so that the block is never ended by
+// ascending out of an element and lines in it are continued without indenting.
+const fragmentTextBlock = -2
+
 // Render the node and all related nodes to HTML.
 func (t *tidy) render(n *html.Node) (out []byte, err error) {
 
 	buf := bytes.Buffer{}
-	w := bufio.NewWriter(&buf)
+	buf.Grow(t.size)
+	w := bufio.NewWriter(limitOutput(&buf, t.opts))
 
-	// Throw away the document node as it gets in the way.
+	// Throw away the document node as it gets in the way. The nodes
+	// of a fragment can be a text block without any parent element, and
+	// that block lasts until the end.
 	if n.Type == html.DocumentNode {
+		if t.isTextBlockNode(n) {
+			t.textBlock = fragmentTextBlock
+		}
 		n = n.FirstChild
 		for s := n; s != nil; s = s.NextSibling {
 			s.Parent = nil
@@ -91,15 +221,18 @@ func (t *tidy) render(n *html.Node) (out []byte, err error) {
 			case "noscript":
 				// The <noscript> elements are parsed as plain text.
 				// Convert them into HTML nodes so they can be tidied.
-				t.err = parseTextNode(n)
+				parseTextNode(n)
 			case "pre":
 				if !t.inPreBlock() {
 					t.preBlock = t.indent
 				}
 			}
+			if t.format(n) == PreFormat && !t.inPreBlock() {
+				t.preBlock = t.indent
+			}
 
 			// Start a new text block?
-			if t.inNormalBlock() && isTextBlock(n) {
+			if t.inNormalBlock() && (t.isTextBlockNode(n) || t.isCompactRow(n)) {
 				t.textBlock = t.indent
 			}
 
@@ -113,8 +246,15 @@ func (t *tidy) render(n *html.Node) (out []byte, err error) {
 				continue
 			}
 
-			// If there were no children, then close the element here.
+			// If there were no children, then close the element here,
+			// along with any block that it started.
 			t.writeElClose(w, n)
+			if t.indent == t.textBlock {
+				t.textBlock = -1
+			}
+			if t.indent == t.preBlock {
+				t.preBlock = -1
+			}
 
 		case html.TextNode:
 			t.writeText(w, n)
@@ -125,6 +265,9 @@ func (t *tidy) render(n *html.Node) (out []byte, err error) {
 		case html.DoctypeNode:
 			t.writeDoctype(w, n)
 
+		case html.RawNode:
+			t.writeRaw(w, n)
+
 		case html.DocumentNode:
 			t.err = errors.New("tidyhtml: cannot render a DocumentNode node")
 
@@ -198,7 +341,7 @@ func (t *tidy) writeString(w *bufio.Writer, s string) {
 // From https://github.com/golang/net/blob/master/html/render.go
 func (t *tidy) writeQuoted(w *bufio.Writer, s string) {
 	var q byte
-	if strings.Contains(s, `"`) {
+	if strings.Contains(t.templates.expand(s), `"`) {
 		q = '\''
 	} else {
 		q = '"'
@@ -208,10 +351,41 @@ func (t *tidy) writeQuoted(w *bufio.Writer, s string) {
 	t.writeByte(w, q)
 }
 
-// writeIndentation adds spaces for indentation.
+// advance returns the column that writing s from col reaches, or -1 if
+// col is -1.
+func (t *tidy) advance(col int, s string) int {
+	if col == -1 {
+		return -1
+	}
+	s = t.templates.expand(s)
+	if i := strings.LastIndexByte(s, '\n'); i != -1 {
+		return utf8.RuneCountInString(s[i+1:])
+	}
+	return col + utf8.RuneCountInString(s)
+}
+
+// writeIndentation adds spaces for indentation. The indentation for each
+// level is a prefix of the same string, which is only made longer when a
+// deeper level is reached.
 func (t *tidy) writeIndentation(w *bufio.Writer) {
-	for i := 0; i < t.indent; i++ {
-		t.writeString(w, "    ")
+	t.writeBlankLine(w)
+	if t.indent <= 0 {
+		return
+	}
+	unit := t.opts.indentation()
+	n := t.indent * len(unit)
+	if n > len(t.indents) {
+		t.indents = strings.Repeat(unit, t.indent*2)
+	}
+	t.writeString(w, t.indents[:n])
+}
+
+// writeBlankLine adds a blank line if one is wanted before
+// the next line.
+func (t *tidy) writeBlankLine(w *bufio.Writer) {
+	if t.blankLine {
+		t.writeByte(w, '\n')
+		t.blankLine = false
 	}
 }
 
@@ -227,17 +401,71 @@ func (t *tidy) writeIndentationGuide(w *bufio.Writer, guide string) {
 	}
 }
 
+var indentationGuideRegexp = regexp.MustCompile(`^(?:( <==)+|( ==>)+) $`)
+
+// isIndentationGuide reports whether n is a comment that was added by
+// writeIndentationGuide.
+func isIndentationGuide(n *html.Node) bool {
+	return n.Type == html.CommentNode && indentationGuideRegexp.MatchString(n.Data)
+}
+
+// removeIndentationGuides removes the comments that writeIndentationGuide
+// added when the input was tidied before, so that they are not kept as
+// well as being written again. The line breaks that were written after
+// them, and between the <pre> and one after it, are removed too.
+func removeIndentationGuides(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if isIndentationGuide(c) {
+			if s := c.NextSibling; s != nil && s.Type == html.TextNode {
+				s.Data = strings.TrimPrefix(s.Data, "\n")
+			}
+			if s := c.PrevSibling; strings.HasPrefix(c.Data, " ==>") && s != nil && s.Type == html.TextNode {
+				s.Data = strings.TrimSuffix(s.Data, "\n")
+			}
+			n.RemoveChild(c)
+		} else {
+			removeIndentationGuides(c)
+		}
+		c = next
+	}
+}
+
 // Functions for writing HTML nodes:
 
 func (t *tidy) writeComment(w *bufio.Writer, n *html.Node) {
 	if !isVeryFirstNode(n) && t.inNormalBlock() {
-		t.writeIndentation(w)
+		// Statements like "else" line up with the block they are in.
+		if t.templates.isMiddle(n) {
+			t.indent--
+			t.writeIndentation(w)
+			t.indent++
+		} else {
+			t.writeIndentation(w)
+		}
 	}
 
-	t.writeString(w, "<!--")
-	t.writeString(w, n.Data)
-	t.writeString(w, "-->")
+	if isTemplateNode(n) {
+		// Template tags are written as their placeholders.
+		t.writeString(w, n.Data)
+	} else {
+		t.writeString(w, "<!--")
+		t.writeString(w, n.Data)
+		t.writeString(w, "-->")
+	}
+
+	if !isVeryLastNode(n) && t.inNormalBlock() {
+		t.writeByte(w, '\n')
+	}
+}
 
+// writeRaw writes the data of a RawNode exactly as it is, at the
+// current indentation.
+func (t *tidy) writeRaw(w *bufio.Writer, n *html.Node) {
+	if !isVeryFirstNode(n) && t.inNormalBlock() {
+		t.writeIndentation(w)
+	}
+	t.writeString(w, n.Data)
 	if !isVeryLastNode(n) && t.inNormalBlock() {
 		t.writeByte(w, '\n')
 	}
@@ -273,99 +501,202 @@ func (t *tidy) writeDoctype(w *bufio.Writer, n *html.Node) {
 
 func (t *tidy) writeEl(w *bufio.Writer, n *html.Node) {
 
+	// The column that the start tag has reached, for WrapAttrWidth, or -1
+	// when it is not known because the tag does not start a line.
+	col := -1
+	if t.opts.WrapAttrWidth > 0 && isVeryFirstNode(n) {
+		col = 0
+	}
 	if !isVeryFirstNode(n) {
-		if n.Data == "pre" {
+		startsLine := t.isPreBlock(n) ||
+			!t.withinPreBlock() && (!t.inTextBlock() || t.isTextBlock())
+		if startsLine && t.blankBefore.match(n) && prevSibling(n) != nil {
+			t.blankLine = true
+		}
+		if t.isPreBlock(n) {
+			t.writeBlankLine(w)
 			if !isPreNode(getPrevElement(n)) {
 				t.writeIndentationGuide(w, " <==")
 				t.writeByte(w, '\n')
 			}
-		} else if !t.inPreBlock() && (!t.inTextBlock() || t.isTextBlock()) {
+		} else if !t.withinPreBlock() && (!t.inTextBlock() || t.isTextBlock()) {
 			t.writeIndentation(w)
+			if t.opts.WrapAttrWidth > 0 {
+				col = t.indent * utf8.RuneCountInString(t.opts.indentation())
+			}
 		}
 	}
 
+	if t.templates.isBlock(n) {
+		// Paired template statements are written as their placeholders.
+		t.writeString(w, n.Data)
+		if t.inNormalBlock() && hasContent(n) {
+			t.writeByte(w, '\n')
+		}
+		return
+	}
+
+	t.writeString(w, positionPlaceholder(n, t.positions))
 	t.writeByte(w, '<')
 	t.writeString(w, n.Data)
+	col = t.advance(col, "<"+n.Data)
 	for _, a := range n.Attr {
 		t.writeByte(w, ' ')
+		if isTemplateAttr(a) {
+			// Framework attributes are written as their placeholders.
+			t.writeString(w, a.Key)
+			col = t.advance(col, " "+a.Key)
+			continue
+		}
 		if a.Namespace != "" {
 			t.writeString(w, a.Namespace)
 			t.writeByte(w, ':')
+			col = t.advance(col, " "+a.Namespace+":")
 		}
 		t.writeString(w, a.Key)
+		col = t.advance(col, " "+a.Key)
+		if isAMPAttr(t.opts, a) {
+			continue
+		}
 		t.writeByte(w, '=')
-		t.writeQuoted(w, html.EscapeString(a.Val))
+		if t.templates.isBareAttr(a.Val) {
+			t.writeString(w, a.Val)
+			col = t.advance(col, "="+a.Val)
+		} else {
+			var val string
+			if col != -1 {
+				val = t.wrapAttr(n, a, col+2)
+			} else {
+				val = escapeAttr(a.Val, t.opts)
+			}
+			t.writeQuoted(w, val)
+			col = t.advance(col, "=\""+val+"\"")
+		}
+	}
+	if selfClosing(t.opts.SelfClosing, n, t.selfClosed) {
+		t.writeString(w, " /")
 	}
 	t.writeByte(w, '>')
+	if hasLeadingNewline(n) {
+		t.writeByte(w, '\n')
+	}
 
-	if t.inNormalBlock() && hasChild(n) {
+	if t.inNormalBlock() && hasContent(n) {
 		t.writeByte(w, '\n')
 	}
 }
 
 func (t *tidy) writeElClose(w *bufio.Writer, n *html.Node) {
-	if t.inNormalBlock() && hasChild(n) {
+	omit := t.opts.OmitEndTags && t.templates.canOmitEndTag(n)
+	if t.inNormalBlock() && hasContent(n) {
+		if omit {
+			// The children already ended with a line break.
+			return
+		}
 		t.writeIndentation(w)
 	}
 
-	if !isVoid(n) {
+	if t.isLineBreak(n) {
+		// Continue the text on a new line, indented like the
+		// start of the text block.
+		indent := t.indent
+		t.indent = t.textBlock + 1
+		t.writeByte(w, '\n')
+		t.writeIndentation(w)
+		t.indent = indent
+		return
+	}
+
+	if t.templates.isBlock(n) {
+		t.writeString(w, t.templates.closing(n))
+	} else if !isVoid(n) && !omit && n.Data != "plaintext" && !isSelfClosedComponent(n, t.selfClosed) {
+		// A <plaintext> lasts until the end of the document,
+		// so it cannot have an end tag.
 		t.writeString(w, "</")
 		t.writeString(w, n.Data)
 		t.writeByte(w, '>')
 	}
 
-	if n.Data == "pre" {
+	if t.isPreBlock(n) {
 		if !isPreNode(n.NextSibling) {
 			t.writeByte(w, '\n')
 			t.writeIndentationGuide(w, " ==>")
 		}
 	}
 	if !isVeryLastNode(n) {
-		if n.Data == "pre" || !t.inPreBlock() {
+		if !t.withinPreBlock() {
 			if !t.inTextBlock() || t.isTextBlock() {
 				t.writeByte(w, '\n')
+				if t.blankAfter.match(n) && nextSibling(n) != nil {
+					t.blankLine = true
+				}
 			}
 		}
 	}
 }
 
+// isLineBreak - is the node a <br> in a text block that the rest of the
+// text is put on a new line after, with BreakAfterBR?
+func (t *tidy) isLineBreak(n *html.Node) bool {
+	return t.opts.BreakAfterBR && n.Type == html.ElementNode && n.Data == "br" &&
+		t.inTextBlock() && !t.inPreBlock() && !t.isTextBlock() && nextSibling(n) != nil
+}
+
+// Legacy elements with raw text content that is displayed, and so must
+// be kept exactly as it is, like the content of a <pre>.
+var verbatimElements = map[string]bool{
+	"noembed": true, "noframes": true, "plaintext": true, "xmp": true,
+}
+
 func (t *tidy) writeText(w *bufio.Writer, n *html.Node) {
-	if t.inPreBlock() {
-		t.writeString(w, n.Data)
+	if t.inPreBlock() || n.Parent != nil && verbatimElements[n.Parent.Data] {
+		t.writeString(w, escapeText(n, n.Data, t.opts))
 		return
 	}
 	if !t.inTextBlock() {
 		return
 	}
 
-	input := bytes.TrimSpace([]byte(n.Data))
+	input := escapeText(n, strings.TrimFunc(n.Data, isHTMLSpace), t.opts)
+
+	// Whitespace at the start or end of an element is removed, unless
+	// it could be seen, with SafeWhitespace.
+	keep := t.opts.SafeWhitespace && !isBlockBoundary(n.Parent, nil)
+
+	// Spaces at the start of a line after a <br> cannot be seen either.
+	afterBreak := n.PrevSibling != nil && t.isLineBreak(n.PrevSibling)
 
 	if len(input) == 0 {
-		if hasPrev(n) || hasNext(n) {
-			t.writeByte(w, ' ')
+		if afterBreak {
 			return
 		}
+		// Whitespace at the end of a block cannot be seen either, such
+		// as the line break after </body>, which the parser puts in it.
+		if hasNext(n) || keep || hasPrev(n) && !isBlockBoundary(n.Parent, nil) {
+			t.writeByte(w, ' ')
+		}
+		return
 	}
 
-	if hasPrev(n) && unicode.IsSpace(rune(n.Data[0])) {
+	if (hasPrev(n) || keep) && !afterBreak && isHTMLSpace(rune(n.Data[0])) {
 		t.writeByte(w, ' ')
 	}
 
-	if hasNext(n) && unicode.IsSpace(rune(n.Data[len(n.Data)-1])) {
+	if (hasNext(n) || keep) && isHTMLSpace(rune(n.Data[len(n.Data)-1])) {
 		defer t.writeByte(w, ' ')
 	}
 
 	for {
-		i := bytes.IndexFunc(input, unicode.IsSpace)
+		i := strings.IndexFunc(input, isHTMLSpace)
 		if i == -1 {
 			// There is no more whitespace, write what is left.
-			t.write(w, input)
+			t.writeString(w, input)
 			break
 		} else if i == 0 {
 			// This is whitespace, write 1 space and move
 			// forward to the next non-whitespace character.
 			t.writeByte(w, ' ')
-			i = bytes.IndexFunc(input, isNotSpace)
+			i = strings.IndexFunc(input, isNotSpace)
 			if i == -1 {
 				// Only trailing whitespace is left.
 				break
@@ -374,7 +705,7 @@ func (t *tidy) writeText(w *bufio.Writer, n *html.Node) {
 		} else {
 			// There is some whitespace further ahead. Write the characters
 			// up to that whitespace and move the position accordingly.
-			t.write(w, input[:i])
+			t.writeString(w, input[:i])
 			input = input[i:]
 		}
 	}
@@ -382,6 +713,158 @@ func (t *tidy) writeText(w *bufio.Writer, n *html.Node) {
 
 // Other helper functions:
 
+// escapeText escapes the text of a node so that it is parsed back into
+// the same text. Elements with raw text content, such as <script>, are
+// not parsed for character references, so their text is left as it is,
+// except for <textarea> and <title>, which are. Their text has "</"
+// escaped as well, so that an end tag that was written as character
+// references does not end the element early. With EscapeNBSP,
+// non-breaking spaces are written as &nbsp; where character references are
+// parsed, and control characters are changed as set by ControlChars.
+func escapeText(n *html.Node, s string, opts Options) string {
+	if p := n.Parent; p != nil && rawTextElements[p.Data] {
+		if p.Data != "textarea" && p.Data != "title" {
+			return escapeControls(s, opts.ControlChars, true)
+		}
+		s = strings.Replace(s, "&", "&amp;", -1)
+		s = strings.Replace(s, "</", "&lt;/", -1)
+	} else {
+		s = escapeMarkup(s)
+	}
+	s = escapeControls(s, opts.ControlChars, false)
+	if opts.EscapeNBSP {
+		s = strings.Replace(s, "\u00a0", "&nbsp;", -1)
+	}
+	return s
+}
+
+// escapeMarkup escapes the ampersands and less-than signs in text that
+// would otherwise start a character reference or a tag. Others, such as
+// in "a < b" or "R & D", are left as they are.
+func escapeMarkup(s string) string {
+	if strings.IndexAny(s, "&<") == -1 {
+		return s
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		var next byte
+		if i+1 < len(s) {
+			next = s[i+1]
+		}
+		switch {
+		case c == '&' && (isASCIILetter(next) || isASCIIDigit(next) || next == '#'):
+			b.WriteString("&amp;")
+		case c == '<' && (isASCIILetter(next) || next == '/' || next == '!' || next == '?'):
+			b.WriteString("&lt;")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isASCIIDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// markupSummary returns the names of the start tags, the comments and
+// the text of some markup, without whitespace. It is the same as the
+// nodesSummary of the nodes it is parsed into, unless the parser adds
+// elements, or moves or leaves out some of them. End tags for <body> and
+// <html>, after which the parser moves comments out of the document's
+// body, are included, so that they never have the same summary.
+func markupSummary(s string) string {
+	b := strings.Builder{}
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return b.String()
+		}
+		tok := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			b.WriteString("\x00<" + tok.Data + "\x00")
+		case html.EndTagToken:
+			if tok.Data == "body" || tok.Data == "html" {
+				b.WriteString("\x00/" + tok.Data + "\x00")
+			}
+		case html.CommentToken:
+			b.WriteString("\x00!" + tok.Data + "\x00")
+		case html.TextToken:
+			b.WriteString(strings.Join(strings.FieldsFunc(tok.Data, isHTMLSpace), ""))
+		}
+	}
+}
+
+// endMarkup returns markup s with any tag that is left unfinished at its
+// end, which can only happen at the end of the input, replaced with what it
+// is parsed as there, and any raw text element that is left open closed,
+// so that neither takes in the end tag for name that is written after it.
+func endMarkup(s, name string) string {
+	z := html.NewTokenizer(strings.NewReader(s + "</" + name + ">"))
+	offset := 0
+	open := ""
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		next := offset + len(z.Raw())
+		if next > len(s) {
+			break
+		}
+		offset = next
+		switch tag, _ := z.TagName(); {
+		case tt == html.StartTagToken && rawTextElements[string(tag)]:
+			open = string(tag)
+		case tt == html.EndTagToken:
+			open = ""
+		}
+	}
+	b := strings.Builder{}
+	b.WriteString(s[:offset])
+	if offset != len(s) {
+		z = html.NewTokenizer(strings.NewReader(s[offset:]))
+		for z.Next() != html.ErrorToken {
+			b.WriteString(z.Token().String())
+		}
+	}
+	if open != "" {
+		b.WriteString("</" + open + ">")
+	}
+	return b.String()
+}
+
+// nodesSummary returns the same as markupSummary for parsed nodes.
+func nodesSummary(nodes []*html.Node) string {
+	b := strings.Builder{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			// The parser corrects the case of some SVG names.
+			b.WriteString("\x00<" + strings.ToLower(n.Data) + "\x00")
+		case html.CommentNode:
+			b.WriteString("\x00!" + n.Data + "\x00")
+		case html.TextNode:
+			b.WriteString(strings.Join(strings.FieldsFunc(n.Data, isHTMLSpace), ""))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return b.String()
+}
+
 // findContext finds the parent body or head node.
 func findContext(n *html.Node) *html.Node {
 	for n != nil {
@@ -412,24 +895,38 @@ func getPrevElement(n *html.Node) *html.Node {
 }
 
 // parseTextNode parses a text node's text, and replaces the
-// text node, in place, with the generated nodes it contained.
-func parseTextNode(n *html.Node) error {
+// text node, in place, with the generated nodes it contained. Nodes
+// without a text node, such as an empty <noscript>, are left as they are.
+// Text that the parser would change, such as text in a <noscript> in the
+// <head>, which would be moved out of it, or which has a <noscript> of its
+// own, whose end tag would end it, is written exactly as it is, and so is
+// text that the parser fails to parse within the context.
+func parseTextNode(n *html.Node) {
+	if n.FirstChild == nil || n.FirstChild.Type != html.TextNode {
+		return
+	}
+	text := n.FirstChild.Data
 	context := findContext(n)
+	if context == nil {
+		// A fragment is parsed in the <body>, unless another context is
+		// given, and its <noscript> elements are read as if they were too.
+		context = &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	}
 	children, err := html.ParseFragment(
-		strings.NewReader(n.FirstChild.Data), context,
+		bytes.NewReader(markAttrOrder([]byte(text))), context,
 	)
-	if err != nil {
-		return err
+	n.RemoveChild(n.FirstChild)
+	nested := false
+	for _, c := range children {
+		nested = nested || findElement(c, atom.Noscript) != nil
 	}
-	for i, c := range children {
-		c.Parent = n
-		if i == 0 {
-			n.FirstChild = c
-		} else {
-			p := children[i-1]
-			p.NextSibling = c
-			c.PrevSibling = p
-		}
+	if err != nil || nested || markupSummary(text) != nodesSummary(children) {
+		raw := strings.TrimFunc(endMarkup(text, n.Data), isHTMLSpace)
+		n.AppendChild(&html.Node{Type: html.RawNode, Data: raw})
+		return
+	}
+	for _, c := range children {
+		restoreAttrOrder(c)
+		n.AppendChild(c)
 	}
-	return nil
 }
@@ -0,0 +1,102 @@
+package tidyhtml
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// URLRewriter is called for each URL in the document by
+// Options.RewriteURL, with the names of the element and attribute
+// that contain it, and returns the URL to use instead.
+type URLRewriter func(element, attr, url string) (string, error)
+
+// Attributes that contain lists of URLs with descriptors, such as
+// "a.png 1x, b.png 2x".
+var srcsetAttrs = map[string]bool{"srcset": true, "imagesrcset": true}
+
+// rewriteURLs calls rewrite for each URL within n. URLs that contain
+// template tags are left as they are.
+func rewriteURLs(n *html.Node, rewrite URLRewriter) error {
+	if n.Type == html.ElementNode {
+		for i, a := range n.Attr {
+			key := a.Key
+			if a.Namespace != "" {
+				key = a.Namespace + ":" + a.Key
+			}
+			if placeholderRegexp.MatchString(a.Val) {
+				continue
+			}
+			var err error
+			switch {
+			case urlAttrs[key]:
+				n.Attr[i].Val, err = rewrite(n.Data, key, a.Val)
+			case srcsetAttrs[key]:
+				n.Attr[i].Val, err = rewriteSrcset(n.Data, key, a.Val, rewrite)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := rewriteURLs(c, rewrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteSrcset rewrites each of the URLs in a srcset attribute,
+// keeping their descriptors.
+func rewriteSrcset(element, attr, val string, rewrite URLRewriter) (string, error) {
+	var candidates []string
+	for _, c := range splitSrcset(val) {
+		url, err := rewrite(element, attr, c[0])
+		if err != nil {
+			return "", err
+		}
+		c[0] = url
+		candidates = append(candidates, strings.Join(c, " "))
+	}
+	return strings.Join(candidates, ", "), nil
+}
+
+// splitSrcset splits a srcset attribute into its candidates, each of which
+// is its URL followed by its descriptors, as browsers read them. A URL runs
+// up to the next whitespace, so the commas in a data: URL are part of it,
+// and a comma only ends a candidate that is outside of the parentheses in
+// its descriptors, or at the end of its URL.
+func splitSrcset(val string) [][]string {
+	var candidates [][]string
+	i := 0
+	for {
+		for i < len(val) && (isHTMLSpace(rune(val[i])) || val[i] == ',') {
+			i++
+		}
+		if i == len(val) {
+			return candidates
+		}
+		start := i
+		for i < len(val) && !isHTMLSpace(rune(val[i])) {
+			i++
+		}
+		url := val[start:i]
+		if strings.HasSuffix(url, ",") {
+			candidates = append(candidates, []string{strings.TrimRight(url, ",")})
+			continue
+		}
+		start = i
+		parens := false
+		for ; i < len(val); i++ {
+			if val[i] == '(' {
+				parens = true
+			} else if val[i] == ')' {
+				parens = false
+			} else if val[i] == ',' && !parens {
+				break
+			}
+		}
+		candidates = append(candidates, append([]string{url}, strings.Fields(val[start:i])...))
+	}
+}
@@ -0,0 +1,94 @@
+package tidyhtml
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultSanitizeElements are the elements that are removed when
+// Options.Sanitize is used without Options.SanitizeElements.
+var DefaultSanitizeElements = []string{
+	"applet", "embed", "frame", "frameset", "iframe", "object", "script",
+}
+
+// Attributes that contain URLs.
+var urlAttrs = map[string]bool{
+	"action": true, "background": true, "cite": true, "data": true,
+	"formaction": true, "href": true, "longdesc": true, "manifest": true,
+	"poster": true, "src": true, "xlink:href": true,
+}
+
+// URL schemes that run scripts.
+var scriptSchemes = []string{"javascript:", "vbscript:"}
+
+// sanitize removes the elements, event handler attributes and script URLs
+// that are not safe to embed.
+func sanitize(n *html.Node, opts Options) {
+	names := opts.SanitizeElements
+	if names == nil {
+		names = DefaultSanitizeElements
+	}
+	remove := map[string]bool{}
+	for _, name := range names {
+		remove[strings.ToLower(name)] = true
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && remove[c.Data] {
+				n.RemoveChild(c)
+			} else {
+				walk(c)
+			}
+			c = next
+		}
+		if n.Type != html.ElementNode {
+			return
+		}
+		attrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			if !isUnsafeAttr(a) {
+				attrs = append(attrs, a)
+			}
+		}
+		n.Attr = attrs
+	}
+	walk(n)
+}
+
+// isUnsafeAttr reports whether an attribute is an event handler,
+// or contains a URL that runs a script.
+func isUnsafeAttr(a html.Attribute) bool {
+	key := a.Key
+	if a.Namespace != "" {
+		key = a.Namespace + ":" + a.Key
+	}
+	if strings.HasPrefix(key, "on") {
+		return true
+	}
+	return urlAttrs[key] && isScriptURL(a.Val)
+}
+
+// isScriptURL reports whether a URL uses a scheme that runs a script.
+// Browsers ignore whitespace and control characters within the scheme,
+// so they are ignored here too.
+func isScriptURL(url string) bool {
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, url)
+	if i := strings.IndexByte(scheme, ':'); i != -1 {
+		scheme = strings.ToLower(scheme[:i+1])
+	}
+	for _, s := range scriptSchemes {
+		if scheme == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// tidySelected tidies the elements of src that match the OnlySelector
+// option, and leaves the rest of src byte for byte as it was. Elements
+// within one that matches are tidied along with it, and those that match
+// next to each other are tidied together, as they are by FormatRange.
+func tidySelected(src []byte, opts Options) ([]byte, error) {
+	sel, err := parseSelector(opts.OnlySelector)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parse(markPositions(src), opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimits(doc, opts); err != nil {
+		return nil, err
+	}
+	positions := takePositions(doc)
+	ends := elementEnds(src)
+	context := opts.Context
+	if !opts.Fragment {
+		context = ""
+	}
+
+	var spans []span
+	ids := 0
+	var walk func(n *html.Node, matched bool)
+	walk = func(n *html.Node, matched bool) {
+		ids++
+		id := ids
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			m := matched || sel.match(c)
+			start, ok := positions[c]
+			end, closed := ends[start]
+			if !m || !ok || !closed || documentElements[c.Data] {
+				// The elements within these can still be tidied.
+				walk(c, m)
+				continue
+			}
+			parent := context
+			if n.Type == html.ElementNode {
+				parent = n.Data
+			}
+			s := span{start, end, parent, id}
+			if k := len(spans); k != 0 && spans[k-1].id == s.id && isSiblingGap(src[spans[k-1].end:s.start]) {
+				spans[k-1].end = s.end
+				continue
+			}
+			spans = append(spans, s)
+		}
+	}
+	walk(doc, false)
+	return tidySpans(src, spans, opts)
+}
+
+// elementEnds returns the offsets in b of the ends of the elements that
+// end where it says, by the offsets of their start tags. Elements that are
+// closed implicitly are left out, as where they end is not known.
+func elementEnds(b []byte) map[int]int {
+	type frame struct {
+		name  string
+		start int
+	}
+	var stack []frame
+	ends := map[int]int{}
+	offset := 0
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				return nil
+			}
+			return ends
+		}
+		start := offset
+		offset += len(z.Raw())
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if voidElements[string(name)] {
+				ends[start] = offset
+			} else {
+				stack = append(stack, frame{string(name), start})
+			}
+		case html.SelfClosingTagToken:
+			// Only void elements can really be self-closing in HTML.
+			if name, _ := z.TagName(); voidElements[string(name)] {
+				ends[start] = offset
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			i := len(stack) - 1
+			for i >= 0 && stack[i].name != string(name) {
+				i--
+			}
+			if i >= 0 {
+				ends[stack[i].start] = offset
+				stack = stack[:i]
+			}
+		}
+	}
+}
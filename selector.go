@@ -0,0 +1,238 @@
+package tidyhtml
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// selector is a list of CSS selectors, such as "div.clear, p > span",
+// which matches an element if any of them do. It supports type, class, ID
+// and attribute selectors, and the descendant and child combinators.
+type selector []complexSelector
+
+// complexSelector is a list of compound selectors joined by combinators,
+// with the last one being for the element itself.
+type complexSelector []compoundSelector
+
+type compoundSelector struct {
+
+	// The element name, or an empty string to match any element.
+	name string
+
+	attrs []attrSelector
+
+	// Whether the previous compound selector must match the parent,
+	// rather than any ancestor.
+	child bool
+}
+
+type attrSelector struct {
+	key, val string
+
+	// The operator, such as "=" or "^=", or an empty string to match
+	// any value.
+	op string
+}
+
+// parseSelector parses a list of CSS selectors.
+func parseSelector(s string) (selector, error) {
+	var sel selector
+	for _, group := range strings.Split(s, ",") {
+		c, err := parseComplexSelector(group)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			return nil, fmt.Errorf("tidyhtml: invalid selector: %q", s)
+		}
+		sel = append(sel, c)
+	}
+	return sel, nil
+}
+
+func parseComplexSelector(s string) (complexSelector, error) {
+	var c complexSelector
+	child := false
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '>' {
+			if c == nil || child {
+				return nil, fmt.Errorf("tidyhtml: invalid selector: %q", s)
+			}
+			child = true
+			s = s[1:]
+			continue
+		}
+		compound, rest, err := parseCompoundSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		compound.child = child
+		c = append(c, compound)
+		child, s = false, rest
+	}
+	if child {
+		return nil, fmt.Errorf("tidyhtml: invalid selector: %q", s)
+	}
+	return c, nil
+}
+
+func parseCompoundSelector(s string) (compoundSelector, string, error) {
+	var c compoundSelector
+	invalid := fmt.Errorf("tidyhtml: invalid selector: %q", s)
+	name, s := parseIdent(s)
+	if name == "" && strings.HasPrefix(s, "*") {
+		name, s = "*", s[1:]
+	}
+	if name != "*" {
+		c.name = strings.ToLower(name)
+	}
+	for s != "" {
+		switch s[0] {
+		case '.', '#':
+			key := "class"
+			if s[0] == '#' {
+				key = "id"
+			}
+			var val string
+			if val, s = parseIdent(s[1:]); val == "" {
+				return c, s, invalid
+			}
+			op := "="
+			if key == "class" {
+				op = "~="
+			}
+			c.attrs = append(c.attrs, attrSelector{key: key, val: val, op: op})
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end == -1 {
+				return c, s, invalid
+			}
+			a, ok := parseAttrSelector(s[1:end])
+			if !ok {
+				return c, s, invalid
+			}
+			c.attrs = append(c.attrs, a)
+			s = s[end+1:]
+		case ' ', '\t', '\n', '\r', '\f', '>':
+			return c, s, nil
+		default:
+			return c, s, invalid
+		}
+	}
+	if name == "" && len(c.attrs) == 0 {
+		return c, s, invalid
+	}
+	return c, s, nil
+}
+
+// parseAttrSelector parses the inside of an attribute selector,
+// such as `type="text"`.
+func parseAttrSelector(s string) (attrSelector, bool) {
+	var a attrSelector
+	i := strings.IndexAny(s, "~|^$*=")
+	if i == -1 {
+		a.key = strings.ToLower(strings.TrimSpace(s))
+		return a, a.key != ""
+	}
+	a.key = strings.ToLower(strings.TrimSpace(s[:i]))
+	rest := s[i:]
+	if rest[0] == '=' {
+		a.op, rest = "=", rest[1:]
+	} else if len(rest) > 1 && rest[1] == '=' {
+		a.op, rest = rest[:2], rest[2:]
+	} else {
+		return a, false
+	}
+	a.val = strings.TrimSpace(rest)
+	if len(a.val) >= 2 && (a.val[0] == '"' || a.val[0] == '\'') && a.val[len(a.val)-1] == a.val[0] {
+		a.val = a.val[1 : len(a.val)-1]
+	}
+	return a, a.key != ""
+}
+
+// parseIdent returns the identifier at the start of s, and the rest of s.
+func parseIdent(s string) (string, string) {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if c == '-' || c == '_' || c >= 0x80 || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' {
+			i++
+			continue
+		}
+		break
+	}
+	return s[:i], s[i:]
+}
+
+// match reports whether the selector matches an element.
+func (sel selector) match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, c := range sel {
+		if c.match(n, len(c)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the compound selectors up to i match n
+// and its ancestors.
+func (c complexSelector) match(n *html.Node, i int) bool {
+	if !c[i].match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if c.match(p, i-1) {
+			return true
+		}
+		if c[i].child {
+			break
+		}
+	}
+	return false
+}
+
+func (c compoundSelector) match(n *html.Node) bool {
+	if c.name != "" && n.Data != c.name {
+		return false
+	}
+	for _, a := range c.attrs {
+		val, ok := attrValue(n, a.key)
+		if !ok || !a.match(val) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a attrSelector) match(val string) bool {
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return val == a.val
+	case "~=":
+		for _, f := range strings.Fields(val) {
+			if f == a.val {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return val == a.val || strings.HasPrefix(val, a.val+"-")
+	case "^=":
+		return a.val != "" && strings.HasPrefix(val, a.val)
+	case "$=":
+		return a.val != "" && strings.HasSuffix(val, a.val)
+	case "*=":
+		return a.val != "" && strings.Contains(val, a.val)
+	}
+	return false
+}
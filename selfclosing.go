@@ -0,0 +1,130 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SelfClosingStyle controls whether void elements such as <br> and <img>
+// are written with a self-closing slash, as in <br />.
+type SelfClosingStyle int
+
+const (
+	// NoSelfClosing writes void elements without a slash, as in <br>.
+	NoSelfClosing SelfClosingStyle = iota
+
+	// VoidSelfClosing writes every void element with a slash,
+	// as in <br />.
+	VoidSelfClosing
+
+	// PreserveSelfClosing writes a slash for the void elements that had
+	// one in the input, and leaves it out for the others. Render has no
+	// input to go by, so it leaves out every slash.
+	PreserveSelfClosing
+)
+
+// ParseSelfClosingStyle returns the self-closing style with the given
+// name, which is one of "none", "always-void" or "preserve-input".
+func ParseSelfClosingStyle(name string) (SelfClosingStyle, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return NoSelfClosing, nil
+	case "always-void":
+		return VoidSelfClosing, nil
+	case "preserve-input":
+		return PreserveSelfClosing, nil
+	}
+	return NoSelfClosing, fmt.Errorf("tidyhtml: unknown self-closing style: %q", name)
+}
+
+// selfClosingMark is the name of an attribute that markSelfClosing adds
+// to the elements that had a slash, so that they can be found again after
+// parsing.
+const selfClosingMark = "\uE003"
+
+// markSelfClosing replaces the slash of each self-closing void element
+// with the selfClosingMark attribute. With components, other self-closing
+// elements, such as <MyButton />, are marked too, and given an end tag,
+// and so are those with a namespace prefix, such as <v:fill />, with
+// prefixed.
+func markSelfClosing(b []byte, components, prefixed bool) []byte {
+	if !bytes.Contains(b, []byte("/>")) {
+		return b
+	}
+	buf := bytes.Buffer{}
+	buf.Grow(len(b))
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				// The rest of the input is left as it is.
+				buf.Write(z.Raw())
+			}
+			break
+		}
+		raw := append([]byte{}, z.Raw()...)
+		if tt == html.SelfClosingTagToken {
+			name, _ := z.TagName()
+			if voidElements[string(name)] || components || prefixed && bytes.IndexByte(name, ':') > 0 {
+				buf.Write(raw[:len(raw)-2])
+				buf.WriteString(" " + selfClosingMark + ">")
+				if !voidElements[string(name)] {
+					buf.WriteString("</" + string(raw[1:1+len(name)]) + ">")
+				}
+				continue
+			}
+		}
+		buf.Write(raw)
+	}
+	return buf.Bytes()
+}
+
+// takeSelfClosing removes the selfClosingMark attributes from n and its
+// descendants, and returns the elements that had them.
+func takeSelfClosing(n *html.Node) map[*html.Node]bool {
+	found := map[*html.Node]bool{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if a.Key == selfClosingMark {
+					n.Attr = append(n.Attr[:i], n.Attr[i+1:]...)
+					found[n] = true
+					break
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// selfClosing reports whether an element should be written with a slash,
+// given the elements that had one in the input.
+func selfClosing(style SelfClosingStyle, n *html.Node, marked map[*html.Node]bool) bool {
+	if isSelfClosedComponent(n, marked) {
+		return true
+	}
+	switch style {
+	case VoidSelfClosing:
+		return isVoid(n)
+	case PreserveSelfClosing:
+		return isVoid(n) && marked[n]
+	}
+	return false
+}
+
+// isSelfClosedComponent reports whether an element that is not void had
+// a slash in the input, and so is written without an end tag. It must not
+// have gained any children since.
+func isSelfClosedComponent(n *html.Node, marked map[*html.Node]bool) bool {
+	return marked[n] && !isVoid(n) && n.FirstChild == nil
+}
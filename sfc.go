@@ -0,0 +1,188 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// The start of a top-level section of a single-file component, such as
+// <script setup> or <style scoped>, at the start of a line.
+var sectionStart = regexp.MustCompile(`(?im)^<([a-z][a-z0-9-]*)(?:\s[^>]*)?>`)
+
+// isComponentMode reports whether a template mode is for single-file
+// components, where the markup is mixed with top-level <script> and
+// <style> sections and the names of components keep their case.
+func isComponentMode(m TemplateMode) bool {
+	return m == Vue || m == Svelte
+}
+
+// maskSections replaces the top-level sections of a single-file component
+// that are not markup with placeholders, so that they are written back out
+// exactly as they were. In Vue, that is every section apart from a
+// <template> of HTML, and in Svelte, it is the <script> and <style>
+// sections. A blank line before a section is kept with it, and so is
+// one after it when markup follows.
+func (ts *templateSet) maskSections(b []byte, vue bool) []byte {
+	buf := bytes.Buffer{}
+	last, skip := 0, 0
+	for _, m := range sectionStart.FindAllSubmatchIndex(b, -1) {
+		if m[0] < skip {
+			continue
+		}
+		name := strings.ToLower(string(b[m[2]:m[3]]))
+		end := sectionEnd(b, m[1], name)
+		if !isSection(b[m[0]:m[1]], name, vue) {
+			// Lines within the markup of a Vue component are not
+			// the starts of sections.
+			if vue && end != -1 {
+				skip = end
+			}
+			continue
+		}
+		if end == -1 {
+			// The section is not closed, so leave the rest alone.
+			break
+		}
+		skip = end
+		start := m[0]
+		text := string(b[start:end])
+		if start > 0 && len(bytes.TrimSpace(b[:start])) != 0 && blankLines(b[:start], true) {
+			text = "\n" + text
+		}
+		if rest := bytes.TrimSpace(b[end:]); len(rest) != 0 && blankLines(b[end:], false) {
+			if m := sectionStart.FindSubmatch(rest); m == nil || !isSection(m[0], strings.ToLower(string(m[1])), vue) {
+				text += "\n"
+			}
+		}
+		buf.Write(b[last:start])
+		buf.WriteString("<!--")
+		buf.Write(ts.add(templateTag{text: text, kind: templateComment}))
+		buf.WriteString("-->")
+		last = end
+	}
+	if last == 0 {
+		return b
+	}
+	buf.Write(b[last:])
+	return buf.Bytes()
+}
+
+// isSection reports whether a top-level element with the given start tag
+// and name is a section that maskSections leaves unchanged.
+func isSection(open []byte, name string, vue bool) bool {
+	if vue {
+		return name != "template" || hasForeignLang(open)
+	}
+	return name == "script" || name == "style"
+}
+
+// blankLines reports whether the whitespace at the end of b, or at its
+// start, has a blank line in it.
+func blankLines(b []byte, atEnd bool) bool {
+	if atEnd {
+		b = b[len(bytes.TrimRight(b, " \t\r\n")):]
+	} else {
+		b = b[:len(b)-len(bytes.TrimLeft(b, " \t\r\n"))]
+	}
+	return bytes.Count(b, []byte("\n")) > 1
+}
+
+// sectionEnd returns the offset after the end tag of a top-level section
+// with the given name, searching from i, or -1 if it is not closed. A
+// <template> ends at the first end tag at the start of a line, since it
+// may contain others, and other sections end at their first end tag.
+func sectionEnd(b []byte, i int, name string) int {
+	lower := bytes.ToLower(b[i:])
+	closing := []byte("</" + name)
+	j := -1
+	if name == "template" {
+		if k := bytes.Index(lower, append([]byte("\n"), closing...)); k != -1 {
+			j = k + 1
+		}
+	} else {
+		j = bytes.Index(lower, closing)
+	}
+	if j == -1 {
+		return -1
+	}
+	k := bytes.IndexByte(lower[j:], '>')
+	if k == -1 {
+		return -1
+	}
+	return i + j + k + 1
+}
+
+var langAttrRegexp = regexp.MustCompile(`(?i)\slang\s*=\s*["']?([a-z0-9-]*)`)
+
+// hasForeignLang reports whether the start tag of a section has a lang
+// attribute for something other than HTML, such as lang="pug".
+func hasForeignLang(open []byte) bool {
+	m := langAttrRegexp.FindSubmatch(open)
+	return m != nil && !bytes.EqualFold(m[1], []byte("html"))
+}
+
+// SvelteAttrs are the prefixes of the Svelte directives, such as
+// on:click and bind:value, which are used along with DefaultFrameworkAttrs
+// when FrameworkAttrs is nil in Svelte mode.
+var SvelteAttrs = []string{"on:", "bind:", "class:", "style:", "use:", "transition:", "in:", "out:", "animate:", "let:"}
+
+// componentMark is in the names that maskName gives to elements whose
+// names have capital letters, such as <MyButton>, which the parser would
+// otherwise change to lower case.
+const componentMark = "\uE004"
+
+// maskName replaces the name in the raw bytes of a start or end tag with
+// one that keeps its case, when it has capital letters.
+func (ts *templateSet) maskName(raw []byte) []byte {
+	if !ts.components {
+		return raw
+	}
+	i := 1
+	if len(raw) > 1 && raw[1] == '/' {
+		i = 2
+	}
+	j := i
+	for j < len(raw) && !isTagSpace(rune(raw[j])) && raw[j] != '/' && raw[j] != '>' {
+		j++
+	}
+	name := string(raw[i:j])
+	if name == strings.ToLower(name) {
+		return raw
+	}
+	k := -1
+	for n, s := range ts.names {
+		if s == name {
+			k = n
+			break
+		}
+	}
+	if k == -1 {
+		ts.names = append(ts.names, name)
+		k = len(ts.names) - 1
+	}
+	out := append([]byte{}, raw[:i]...)
+	out = append(out, "c"+componentMark+strconv.Itoa(k)...)
+	return append(out, raw[j:]...)
+}
+
+// restoreNames gives the elements renamed by maskName their original
+// names again.
+func (ts *templateSet) restoreNames(n *html.Node) {
+	if len(ts.names) == 0 {
+		return
+	}
+	if n.Type == html.ElementNode {
+		if i := strings.Index(n.Data, componentMark); i != -1 {
+			if k, err := strconv.Atoi(n.Data[i+len(componentMark):]); err == nil && k < len(ts.names) {
+				n.Data, n.DataAtom = ts.names[k], 0
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ts.restoreNames(c)
+	}
+}
@@ -0,0 +1,54 @@
+package tidyhtml
+
+import (
+	"sort"
+
+	"github.com/raymondbutcher/tidyhtml/internal/srcpos"
+)
+
+// Position is a location in the input or output, with a line and column
+// starting at 1. The zero value means that the location is not known.
+type Position = srcpos.Position
+
+// A Mapping relates where the start tag of an element was written in the
+// output to where it was in the input.
+type Mapping struct {
+	Output, Input Position
+}
+
+// SourceMap holds a mapping for each element written in the output that
+// came from the input, in the order that they were written. Elements that
+// were added while tidying, such as an implied <tbody>, have none.
+type SourceMap []Mapping
+
+// FormatWithSourceMap tidies src like CopyWithOptions, and also returns
+// a source map from positions in the output to those in src, so that
+// problems found in the output can be reported where they are in src.
+func FormatWithSourceMap(src []byte, opts Options) ([]byte, SourceMap, error) {
+	out, anchors, err := tidyWithAnchors(src, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(anchors, func(i, j int) bool { return anchors[i].out < anchors[j].out })
+	in, o := srcpos.NewSource(src), srcpos.NewSource(out)
+	m := make(SourceMap, len(anchors))
+	for i, a := range anchors {
+		m[i] = Mapping{Output: o.Position(a.out), Input: in.Position(a.in)}
+	}
+	return out, m, nil
+}
+
+// Lookup returns the input position of the element that the given line
+// of the output belongs to. That is the first element that starts on the
+// line, or else the last one that starts before it. It returns the zero
+// Position if there is none.
+func (m SourceMap) Lookup(line int) Position {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Output.Line >= line })
+	if i < len(m) && m[i].Output.Line == line {
+		return m[i].Input
+	}
+	if i > 0 {
+		return m[i-1].Input
+	}
+	return Position{}
+}
@@ -0,0 +1,43 @@
+package tidyhtml
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// tidySrcdoc tidies the documents in the srcdoc attributes of the
+// <iframe> elements within n.
+func tidySrcdoc(n *html.Node, opts Options) error {
+	if n.Type == html.ElementNode && n.Data == "iframe" && n.Namespace == "" {
+		for i, a := range n.Attr {
+			if a.Key != "srcdoc" || a.Namespace != "" || strings.TrimSpace(a.Val) == "" {
+				continue
+			}
+			b, err := tidyBytes([]byte(a.Val), srcdocOptions(a.Val, opts))
+			if err != nil {
+				return err
+			}
+			n.Attr[i].Val = string(finishLines(b, Options{TrimTrailingSpace: opts.TrimTrailingSpace}))
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if err := tidySrcdoc(c, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// srcdocOptions returns the options for tidying a srcdoc document. It is
+// treated as a fragment unless it has a doctype or an <html> element, so
+// that they are not added to it. Template tags in it have already been
+// replaced with placeholders, which are kept as they are.
+func srcdocOptions(doc string, opts Options) Options {
+	opts.Template, opts.RawRegions, opts.FrameworkAttrs = NoTemplate, nil, nil
+	opts.MetaCharset = false
+	start := strings.ToLower(strings.TrimSpace(doc))
+	opts.Fragment = !strings.HasPrefix(start, "<!doctype") && !strings.HasPrefix(start, "<html")
+	opts.Context = ""
+	return opts
+}
@@ -0,0 +1,484 @@
+package tidyhtml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/unicode/norm"
+)
+
+// CopyStream copies HTML from src to dst and tidies it up in the process,
+// like CopyWithOptions, but it formats the tokens as they are read instead
+// of parsing the whole document first, so it uses a small, fixed amount of
+// memory however large the document is. This is meant for very large
+// documents, such as exports that are hundreds of megabytes.
+//
+// In return, some edge cases are handled differently. Missing <html>,
+// <head> and <body> elements are not added, elements that are not closed
+// are only ended where the common optional end tag rules say so, and end
+// tags without a matching start tag are removed. Block elements are put on
+// their own lines, and inline elements and text are kept together, with
+// the whitespace at the start and end of an inline element kept within it.
+// The content of a <noscript> is written as markup, as when tidying, but
+// the <noscript> itself is kept inline. The options for templates, and the
+// options that change the document, such as Sanitize and RemoveEmpty, are
+// not used. Only the Indent, LineEnding, FinalNewline, TrimTrailingSpace,
+// Charset, BOM, SelfClosing, SortAttributes, NFC, ControlChars and
+// EscapeNBSP options are, along with the limits, where MaxNodes counts the
+// tokens that are read.
+func CopyStream(dst io.Writer, src io.Reader, opts Options) error {
+	if opts.MaxInputBytes > 0 {
+		src = &limitReader{r: src, max: opts.MaxInputBytes}
+	}
+	r := bufio.NewReader(src)
+	head, err := r.Peek(1024)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return err
+	}
+	bom := opts.BOM == AddBOM || opts.BOM == KeepBOM && hasBOM(head)
+
+	var in io.Reader = r
+	name := "utf-8"
+	if opts.Charset != "" {
+		if _, name = charset.Lookup(opts.Charset); name == "" {
+			return fmt.Errorf("tidyhtml: unknown charset: %q", opts.Charset)
+		}
+	} else {
+		// Only the start of the input can be checked for UTF-8, leaving
+		// out a character that is cut off at its end.
+		valid := head
+		for i := len(valid) - 1; i >= 0 && i > len(valid)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(valid[i]) {
+				if !utf8.FullRune(valid[i:]) {
+					valid = valid[:i]
+				}
+				break
+			}
+		}
+		name = detectCharset(head, utf8.Valid(valid))
+	}
+	if name != "utf-8" {
+		if in, err = charset.NewReaderLabel(name, r); err != nil {
+			return err
+		}
+		opts.transcoded = true
+	}
+	br := bufio.NewReader(in)
+	if b, _ := br.Peek(len(utf8BOM)); bytes.Equal(b, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	w := bufio.NewWriter(limitOutput(dst, opts))
+	if bom {
+		if _, err := w.Write(utf8BOM); err != nil {
+			return err
+		}
+	}
+	s := streamer{opts: opts, w: lineWriter{w: w, opts: opts}}
+	if err := s.stream(br); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// limitReader reads from r, and returns a *LimitError if there
+// are more than max bytes.
+type limitReader struct {
+	r      io.Reader
+	max, n int
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if len(p) > l.max-l.n+1 {
+		p = p[:l.max-l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if l.n += n; l.n > l.max {
+		return 0, &LimitError{"MaxInputBytes", l.max}
+	}
+	return n, err
+}
+
+// streamer formats HTML tokens as they are read.
+type streamer struct {
+
+	// The options being used.
+	opts Options
+
+	w lineWriter
+
+	// The elements that are open.
+	stack []streamEl
+
+	// The number of <pre> elements that the current token is within,
+	// which are written exactly as they are.
+	pre int
+
+	// Whether anything has been written on the current line, and whether
+	// a line break or a space is needed before anything else is written.
+	started, newline, space bool
+
+	// Whether the start tag of a block element is the last thing written,
+	// after which whitespace is not displayed.
+	blockStart bool
+
+	// Whether the tokens being read are the content of a <noscript>.
+	noscript bool
+
+	// The number of tokens that have been read, for Options.MaxNodes.
+	nodes int
+}
+
+type streamEl struct {
+	name string
+
+	// Whether it is a block element, and whether it has any block
+	// elements within it, which puts its end tag on its own line.
+	block, hasBlock bool
+}
+
+// Start tags that end the open elements with these names, when they are
+// the current element.
+var streamCloses = map[string][]string{
+	"li":       {"li"},
+	"dt":       {"dt", "dd"},
+	"dd":       {"dt", "dd"},
+	"tr":       {"td", "th", "tr"},
+	"td":       {"td", "th"},
+	"th":       {"td", "th"},
+	"thead":    {"td", "th", "tr", "thead", "tbody", "tfoot"},
+	"tbody":    {"td", "th", "tr", "thead", "tbody", "tfoot"},
+	"tfoot":    {"td", "th", "tr", "thead", "tbody", "tfoot"},
+	"option":   {"option"},
+	"optgroup": {"option", "optgroup"},
+}
+
+func (s *streamer) stream(r io.Reader) error {
+	if err := s.streamTokens(html.NewTokenizer(r)); err != nil {
+		return err
+	}
+	for len(s.stack) != 0 {
+		s.closeEl()
+	}
+	if s.opts.FinalNewline && (s.started || s.newline) {
+		s.w.writeString("\n")
+	}
+	return s.w.err
+}
+
+// streamTokens writes the tokens from z until the end of its input.
+func (s *streamer) streamTokens(z *html.Tokenizer) error {
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+			return nil
+		}
+		if tt != html.EndTagToken {
+			if s.nodes++; s.opts.MaxNodes > 0 && s.nodes > s.opts.MaxNodes {
+				return &LimitError{"MaxNodes", s.opts.MaxNodes}
+			}
+		}
+		switch top := s.top(); {
+		case s.pre > 0:
+			s.streamPre(z, tt)
+		case tt == html.TextToken && top != nil && (rawTextElements[top.name] || top.name == "textarea" || top.name == "title"):
+			// The contents of these elements are written as they are.
+			s.inline(string(z.Raw()))
+		case tt == html.TextToken && top != nil && top.name == "noscript" && !s.noscript:
+			// The content of a <noscript> is read as text, and is
+			// written as the markup that it is, as when tidying.
+			s.noscript = true
+			err := s.streamTokens(html.NewTokenizer(bytes.NewReader(z.Raw())))
+			s.noscript = false
+			if err != nil {
+				return err
+			}
+		case tt == html.CommentToken && !bytes.HasPrefix(z.Raw(), []byte("<!--")):
+			// Processing instructions and other bogus comments are
+			// written as they are.
+			s.writeComment(string(z.Raw()))
+		default:
+			s.streamToken(z.Token())
+		}
+		if s.w.err != nil {
+			return s.w.err
+		}
+		if s.opts.MaxDepth > 0 && len(s.stack) > s.opts.MaxDepth {
+			return &LimitError{"MaxDepth", s.opts.MaxDepth}
+		}
+	}
+}
+
+// streamPre writes a token within a <pre> element exactly as it is.
+func (s *streamer) streamPre(z *html.Tokenizer, tt html.TokenType) {
+	name, _ := z.TagName()
+	switch {
+	case tt == html.StartTagToken && string(name) == "pre":
+		s.pre++
+	case tt == html.EndTagToken && string(name) == "pre":
+		s.pre--
+		if s.pre == 0 {
+			s.w.writeString("</pre>")
+			s.stack = s.stack[:len(s.stack)-1]
+			s.lineBreak()
+			return
+		}
+	}
+	s.w.write(z.Raw())
+}
+
+func (s *streamer) streamToken(tok html.Token) {
+	switch tok.Type {
+	case html.StartTagToken, html.SelfClosingTagToken:
+		s.startEl(tok)
+		if tok.Type == html.SelfClosingTagToken && !voidElements[tok.Data] {
+			s.endEl(tok.Data)
+		}
+	case html.EndTagToken:
+		s.endEl(tok.Data)
+	case html.TextToken:
+		s.writeText(tok.Data)
+	case html.CommentToken:
+		s.writeComment("<!--" + tok.Data + "-->")
+	case html.DoctypeToken:
+		data := tok.Data
+		if strings.EqualFold(data, "html") {
+			data = "html"
+		}
+		s.lineBreak()
+		s.startLine()
+		s.w.writeString("<!doctype " + data + ">")
+		s.lineBreak()
+	}
+}
+
+// writeComment writes a comment inline if the current line has been
+// started, or else on its own line.
+func (s *streamer) writeComment(comment string) {
+	if s.started {
+		s.inline(comment)
+		return
+	}
+	s.startLine()
+	s.w.writeString(comment)
+	s.lineBreak()
+}
+
+func (s *streamer) top() *streamEl {
+	if len(s.stack) == 0 {
+		return nil
+	}
+	return &s.stack[len(s.stack)-1]
+}
+
+func (s *streamer) startEl(tok html.Token) {
+	name := tok.Data
+	for top := s.top(); top != nil; top = s.top() {
+		if top.name == "p" && closesParagraph[name] || contains(streamCloses[name], top.name) {
+			s.closeEl()
+			continue
+		}
+		break
+	}
+
+	tag := "<" + name
+	if name == "meta" && s.opts.transcoded {
+		relabelMeta(tok.Attr)
+	}
+	if s.opts.SortAttributes {
+		sortAttrList(tok.Attr)
+	}
+	for _, a := range tok.Attr {
+		tag += " "
+		if a.Namespace != "" {
+			tag += a.Namespace + ":"
+		}
+		val := a.Val
+		if s.opts.NFC {
+			val = norm.NFC.String(val)
+		}
+		tag += a.Key + `="` + escapeAttr(val, s.opts) + `"`
+	}
+	switch style := s.opts.SelfClosing; {
+	case !voidElements[name]:
+	case style == VoidSelfClosing, style == PreserveSelfClosing && tok.Type == html.SelfClosingTagToken:
+		tag += " /"
+	}
+	tag += ">"
+
+	block := blockElements[name] || hiddenElements[name]
+	if block {
+		if top := s.top(); top != nil {
+			top.hasBlock = true
+		}
+		s.lineBreak()
+		s.startLine()
+		s.w.writeString(tag)
+		s.blockStart = true
+	} else {
+		s.inline(tag)
+	}
+	if voidElements[name] {
+		if block {
+			s.lineBreak()
+		}
+		return
+	}
+	s.stack = append(s.stack, streamEl{name: name, block: block})
+	if name == "pre" {
+		s.pre++
+	}
+}
+
+// endEl ends the open element with a name, and any open elements within
+// it. End tags without a matching start tag are left out.
+func (s *streamer) endEl(name string) {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i].name == name {
+			for len(s.stack) > i {
+				s.closeEl()
+			}
+			return
+		}
+	}
+}
+
+// closeEl writes the end tag of the current element.
+func (s *streamer) closeEl() {
+	el := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	tag := "</" + el.name + ">"
+	if el.name == "plaintext" {
+		tag = ""
+	}
+	if !el.block {
+		s.inline(tag)
+		return
+	}
+	s.space = false
+	if el.hasBlock {
+		s.lineBreak()
+		s.startLine()
+	}
+	s.w.writeString(tag)
+	s.lineBreak()
+}
+
+// writeText writes text with each run of whitespace collapsed to a space.
+func (s *streamer) writeText(text string) {
+	if startsWithSpace(text) {
+		s.space = s.started && !s.blockStart
+	}
+	for i, word := range strings.FieldsFunc(text, isHTMLSpace) {
+		if i > 0 {
+			s.space = true
+		}
+		if s.opts.NFC {
+			word = norm.NFC.String(word)
+		}
+		word = escapeControls(escapeMarkup(word), s.opts.ControlChars, false)
+		if s.opts.EscapeNBSP {
+			word = strings.Replace(word, "\u00a0", "&nbsp;", -1)
+		}
+		s.inline(word)
+	}
+	if text != "" && isHTMLSpace(rune(text[len(text)-1])) {
+		s.space = s.started
+	}
+}
+
+func isHTMLSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\f' || r == '\r'
+}
+
+// inline writes inline content, after a space if one is needed.
+func (s *streamer) inline(str string) {
+	if s.space && s.started {
+		s.w.writeString(" ")
+	}
+	s.space, s.blockStart = false, false
+	s.startLine()
+	s.w.writeString(str)
+}
+
+// startLine writes the indentation at the start of a line,
+// unless it has already been written.
+func (s *streamer) startLine() {
+	if s.started {
+		return
+	}
+	if s.newline {
+		s.w.writeString("\n")
+		s.newline = false
+	}
+	indent := s.opts.indentation()
+	for range s.stack {
+		s.w.writeString(indent)
+	}
+	s.started = true
+}
+
+// lineBreak puts the next content on a new line.
+func (s *streamer) lineBreak() {
+	if s.started {
+		s.newline, s.started = true, false
+	}
+	s.space, s.blockStart = false, false
+}
+
+// lineWriter writes lines using the line ending options, and removes
+// any trailing whitespace when TrimTrailingSpace is used.
+type lineWriter struct {
+	w    *bufio.Writer
+	opts Options
+
+	// Whitespace that has not been written yet, in case
+	// it is at the end of a line.
+	spaces []byte
+
+	err error
+}
+
+func (lw *lineWriter) writeString(s string) {
+	if lw.err != nil {
+		return
+	}
+	if !lw.opts.TrimTrailingSpace && (lw.opts.LineEnding == "" || lw.opts.LineEnding == "\n") {
+		_, lw.err = lw.w.WriteString(s)
+		return
+	}
+	for i := 0; i < len(s) && lw.err == nil; i++ {
+		switch c := s[i]; {
+		case c == '\n':
+			lw.spaces = lw.spaces[:0]
+			if lw.opts.LineEnding != "" {
+				_, lw.err = lw.w.WriteString(lw.opts.LineEnding)
+			} else {
+				lw.err = lw.w.WriteByte('\n')
+			}
+		case lw.opts.TrimTrailingSpace && (c == ' ' || c == '\t'):
+			lw.spaces = append(lw.spaces, c)
+		default:
+			if len(lw.spaces) != 0 {
+				_, lw.err = lw.w.Write(lw.spaces)
+				lw.spaces = lw.spaces[:0]
+			}
+			if lw.err == nil {
+				lw.err = lw.w.WriteByte(c)
+			}
+		}
+	}
+}
+
+func (lw *lineWriter) write(b []byte) {
+	lw.writeString(string(b))
+}
@@ -0,0 +1,125 @@
+package tidyhtml
+
+import (
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/net/html"
+)
+
+// Structure describes the structure of a document, as returned by
+// Analyze. It is useful for finding out where the size of a document,
+// or of the output of a template, comes from.
+type Structure struct {
+
+	// Elements counts the elements by name.
+	Elements map[string]int
+
+	// Attributes counts the attributes by name.
+	Attributes map[string]int
+
+	// MaxDepth is the deepest nesting of elements,
+	// where the top level elements have a depth of 1.
+	MaxDepth int
+
+	// TextBytes is the size of the text in the document, not including
+	// the contents of scripts and styles. MarkupBytes is the size of the
+	// rest of the input.
+	TextBytes, MarkupBytes int
+
+	// InlineScripts counts the <script> elements without a src attribute,
+	// InlineStyles counts the <style> elements, and StyleAttrs counts the
+	// style attributes.
+	InlineScripts, InlineStyles, StyleAttrs int
+}
+
+// TextRatio returns the proportion of the input that is text, from 0 to 1.
+func (s Structure) TextRatio() float64 {
+	if s.TextBytes+s.MarkupBytes == 0 {
+		return 0
+	}
+	return float64(s.TextBytes) / float64(s.TextBytes+s.MarkupBytes)
+}
+
+// Parse parses a document, as controlled by the Fragment, Context and
+// Charset options, into the tree that tidying starts from, before any of
+// the other options are used. A fragment is placed directly within the
+// DocumentNode that is returned.
+func Parse(src io.Reader, opts Options) (*html.Node, error) {
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = toUTF8(b, opts); err != nil {
+		return nil, err
+	}
+	return parse(b, opts)
+}
+
+// Analyze parses a document, as controlled by the Fragment, Context and
+// Charset options, and describes its structure.
+func Analyze(src io.Reader, opts Options) (Structure, error) {
+	s := Structure{Elements: map[string]int{}, Attributes: map[string]int{}}
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		return s, err
+	}
+	if b, err = toUTF8(b, opts); err != nil {
+		return s, err
+	}
+	node, err := parse(b, opts)
+	if err != nil {
+		return s, err
+	}
+
+	var walk func(n *html.Node, depth int)
+	walk = func(n *html.Node, depth int) {
+		switch n.Type {
+		case html.ElementNode:
+			depth++
+			if depth > s.MaxDepth {
+				s.MaxDepth = depth
+			}
+			s.Elements[n.Data]++
+			for _, a := range n.Attr {
+				s.Attributes[a.Key]++
+				if a.Key == "style" && a.Namespace == "" {
+					s.StyleAttrs++
+				}
+			}
+			switch n.Data {
+			case "script":
+				if _, ok := attrValue(n, "src"); !ok {
+					s.InlineScripts++
+				}
+			case "style":
+				s.InlineStyles++
+			}
+		case html.TextNode:
+			if p := n.Parent; p == nil || p.Data != "script" && p.Data != "style" {
+				s.TextBytes += len(n.Data)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, depth)
+		}
+	}
+	walk(node, 0)
+
+	// Character references make the text shorter once parsed, so the
+	// markup is what remains of the input.
+	s.MarkupBytes = len(b) - s.TextBytes
+	if s.MarkupBytes < 0 {
+		s.MarkupBytes = 0
+	}
+	return s, nil
+}
+
+func attrValue(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,54 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// The first line of a templ component, such as "templ Hello(name string) {".
+var templHeader = regexp.MustCompile(`^templ\s.*\{\s*$`)
+
+// tidyTempl tidies the markup within the components of a templ file,
+// and leaves the Go code around them unchanged.
+func tidyTempl(b []byte, opts Options) ([]byte, error) {
+	opts.Fragment = true
+	buf := bytes.Buffer{}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	for i := 0; i < len(lines); i++ {
+		buf.Write(lines[i])
+		if !templHeader.Match(lines[i]) {
+			continue
+		}
+
+		// The component ends with the brace that balances the one in
+		// its first line.
+		end := i + 1
+		for depth := 1; end < len(lines); end++ {
+			depth += bytes.Count(lines[end], []byte("{"))
+			depth -= bytes.Count(lines[end], []byte("}"))
+			if depth <= 0 {
+				break
+			}
+		}
+		if end == len(lines) {
+			// The component is not closed, so leave the rest alone.
+			continue
+		}
+
+		body, err := tidyBytes(bytes.Join(lines[i+1:end], nil), opts)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) != 0 {
+			for _, line := range bytes.Split(body, []byte("\n")) {
+				if len(line) != 0 {
+					buf.WriteString(opts.indentation())
+					buf.Write(line)
+				}
+				buf.WriteByte('\n')
+			}
+		}
+		i = end - 1
+	}
+	return buf.Bytes(), nil
+}
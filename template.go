@@ -0,0 +1,763 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// TemplateMode selects a template language that is mixed in with the HTML.
+type TemplateMode int
+
+const (
+	// NoTemplate treats the input as plain HTML.
+	NoTemplate TemplateMode = iota
+
+	// Jinja supports Jinja2 and Django templates, with their {% ... %}
+	// statements, {{ ... }} expressions and {# ... #} comments.
+	// Paired statements such as {% for %} and {% endfor %} are indented
+	// like elements when they share the same parent element. This also
+	// works for similar languages such as Liquid, Twig and Nunjucks.
+	Jinja
+
+	// Handlebars supports Handlebars and Mustache templates. Block helpers
+	// such as {{#each}} and {{/each}} are indented like elements, partials
+	// like {{> name}} are written on their own line, and the contents of
+	// triple-stash {{{raw}}} expressions are left alone.
+	Handlebars
+
+	// ERB supports ERB and EJS templates. Their <% ... %> tags are written
+	// back out exactly as they were, with output tags like <%= ... %>
+	// treated as text and other tags written on their own line.
+	ERB
+
+	// PHP supports <?php ... ?> blocks mixed in with HTML. They are written
+	// back out byte for byte, with <?= ... ?> treated as text and other
+	// blocks written on their own line. A block at the end of the input
+	// may leave out the closing ?>.
+	PHP
+
+	// GoTemplate supports Go's text/template and html/template syntax, as
+	// used in .gohtml and .tmpl files. Actions such as {{if}}, {{range}}
+	// and {{define}} are indented like elements up to their {{end}}.
+	GoTemplate
+
+	// Templ supports components written with github.com/a-h/templ. Only
+	// the markup within templ components is tidied, and the Go code
+	// around it is left unchanged. Control flow like if and for within
+	// the markup is indented like elements.
+	Templ
+
+	// Markdown tidies the HTML blocks within Markdown documents, at the
+	// indentation of their first lines, and leaves the rest of the
+	// document, including fenced code blocks, unchanged. Blocks that
+	// contain Markdown, where the elements are not all closed within the
+	// block, are left alone too. Trailing spaces are kept outside of the
+	// HTML blocks even with TrimTrailingSpace, because they are line
+	// breaks in Markdown.
+	Markdown
+
+	// Vue supports Vue single-file components. The markup in the
+	// <template> section is tidied, with {{ ... }} expressions and the
+	// framework attributes in FrameworkAttrs protected, which defaults to
+	// DefaultFrameworkAttrs. The <script>, <style> and other sections are
+	// left unchanged. Components keep the case of their names, as in
+	// <MyButton />, and can be self-closing.
+	Vue
+
+	// Svelte supports Svelte components. The markup is tidied, with blocks
+	// such as {#if} and {/if} indented like elements, and the <script> and
+	// <style> sections are left unchanged. FrameworkAttrs defaults to
+	// SvelteAttrs and DefaultFrameworkAttrs, so that directives such as
+	// bind:value are kept as they are. Components keep the case of their
+	// names and can be self-closing, as with Vue.
+	Svelte
+)
+
+var templateModeNames = map[TemplateMode]string{
+	NoTemplate: "none",
+	Jinja:      "jinja",
+	Handlebars: "handlebars",
+	ERB:        "erb",
+	PHP:        "php",
+	GoTemplate: "go",
+	Templ:      "templ",
+	Markdown:   "markdown",
+	Vue:        "vue",
+	Svelte:     "svelte",
+}
+
+func (m TemplateMode) String() string {
+	if name, ok := templateModeNames[m]; ok {
+		return name
+	}
+	return "TemplateMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// ParseTemplateMode returns the template mode with the given name,
+// such as "jinja" or "php".
+func ParseTemplateMode(name string) (TemplateMode, error) {
+	for m, n := range templateModeNames {
+		if strings.EqualFold(n, name) {
+			return m, nil
+		}
+	}
+	return NoTemplate, fmt.Errorf("tidyhtml: unknown template mode: %q", name)
+}
+
+// TemplateForFile returns the template mode suggested by the
+// extension of a file name, or NoTemplate.
+func TemplateForFile(name string) TemplateMode {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jinja", ".jinja2", ".j2", ".djhtml", ".liquid", ".twig", ".njk":
+		return Jinja
+	case ".hbs", ".handlebars", ".mustache":
+		return Handlebars
+	case ".erb", ".ejs":
+		return ERB
+	case ".php", ".phtml":
+		return PHP
+	case ".gohtml", ".tmpl", ".gotmpl":
+		return GoTemplate
+	case ".templ":
+		return Templ
+	case ".md", ".markdown":
+		return Markdown
+	case ".vue":
+		return Vue
+	case ".svelte":
+		return Svelte
+	}
+	return NoTemplate
+}
+
+// documentTagRegexp matches the tags that only a whole document has.
+var documentTagRegexp = regexp.MustCompile(`(?i)<(?:!doctype|html|head|body)[\s/>]`)
+
+// Template tags are replaced with placeholders before the HTML is parsed.
+// A placeholder is a private use character, the index of the tag, and
+// then another private use character. Statements are placed into comments
+// so that they do not disturb the structure of the document, while
+// expressions are treated like text. The original tags are restored
+// after rendering, which also means that they never get escaped.
+const (
+	placeholderBlock  = '\uE000'
+	placeholderInline = '\uE002'
+	placeholderEnd    = '\uE001'
+)
+
+var placeholderRegexp = regexp.MustCompile("[\uE000\uE002]([0-9]+)\uE001")
+
+// Elements with raw text content, where placeholders must stay as text.
+// The <noscript> element is not included because its content gets parsed
+// separately as HTML.
+var rawTextElements = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+type templateKind int
+
+const (
+	templateStatement templateKind = iota
+	templateExpression
+	templateComment
+	templateAttr
+)
+
+type templateTag struct {
+	text string
+	kind templateKind
+	// For statements, the name used to pair up the opening and closing
+	// statements, such as "for" in both {% for %} and {% endfor %}.
+	name string
+	// end statements close a block. middle statements, like "else",
+	// belong to the enclosing block and are written at its level of
+	// indentation.
+	end, middle bool
+}
+
+// templateSyntax describes how to find and classify the tags
+// of a template language.
+type templateSyntax struct {
+	pattern *regexp.Regexp
+	// classify returns the details of a matched tag, apart from its text.
+	classify func(tag string) templateTag
+	// bareAttrs writes attribute values made up of a single expression
+	// without quotes around them.
+	bareAttrs bool
+}
+
+var jinjaSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`(?s)\{%.*?%\}|\{\{.*?\}\}|\{#.*?#\}`),
+	classify: func(tag string) templateTag {
+		switch tag[1] {
+		case '{':
+			return templateTag{kind: templateExpression}
+		case '#':
+			return templateTag{kind: templateComment}
+		}
+		name := firstWord(strings.Trim(tag[2:len(tag)-2], "-+ \t\r\n"))
+		switch name {
+		case "elif", "else", "empty", "plural", "pluralize":
+			return templateTag{kind: templateStatement, middle: true}
+		}
+		if strings.HasPrefix(name, "end") {
+			return templateTag{kind: templateStatement, name: name[3:], end: true}
+		}
+		return templateTag{kind: templateStatement, name: name}
+	},
+}
+
+var handlebarsSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`(?s)\{\{\{.*?\}\}\}|\{\{!--.*?--\}\}|\{\{.*?\}\}`),
+	classify: func(tag string) templateTag {
+		inner := strings.Trim(tag, "{}~ \t\r\n")
+		if strings.HasPrefix(tag, "{{{") || inner == "" {
+			return templateTag{kind: templateExpression}
+		}
+		switch inner[0] {
+		case '!':
+			return templateTag{kind: templateComment}
+		case '>':
+			// Partials are written on their own line.
+			return templateTag{kind: templateStatement}
+		case '#', '^':
+			if inner == "^" {
+				return templateTag{kind: templateStatement, middle: true}
+			}
+			name := firstWord(strings.TrimLeft(inner[1:], ">* \t\r\n"))
+			return templateTag{kind: templateStatement, name: name}
+		case '/':
+			name := firstWord(inner[1:])
+			return templateTag{kind: templateStatement, name: name, end: true}
+		}
+		if firstWord(inner) == "else" {
+			return templateTag{kind: templateStatement, middle: true}
+		}
+		return templateTag{kind: templateExpression}
+	},
+}
+
+var erbSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`(?s)<%.*?%>`),
+	classify: func(tag string) templateTag {
+		if len(tag) > 2 {
+			switch tag[2] {
+			case '=', '-', '%':
+				return templateTag{kind: templateExpression}
+			case '#':
+				return templateTag{kind: templateComment}
+			}
+		}
+		return templateTag{kind: templateStatement}
+	},
+}
+
+var phpSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`(?s)<\?(?:php\b|=|\s).*?(?:\?>|\z)`),
+	classify: func(tag string) templateTag {
+		if tag[2] == '=' {
+			return templateTag{kind: templateExpression}
+		}
+		return templateTag{kind: templateStatement}
+	},
+}
+
+// DefaultFrameworkAttrs are the attribute name prefixes used by Vue,
+// Angular and Alpine.js, such as :class, @click, v-if and *ngFor.
+var DefaultFrameworkAttrs = []string{":", "@", "#", "*", "[", "(", "v-", "x-"}
+
+var goTemplateSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`(?s)\{\{.*?\}\}`),
+	classify: func(tag string) templateTag {
+		inner := strings.Trim(tag[2:len(tag)-2], "- \t\r\n")
+		if strings.HasPrefix(inner, "/*") {
+			return templateTag{kind: templateComment}
+		}
+		// Every action is closed by {{end}}, so they share a name.
+		switch firstWord(inner) {
+		case "if", "range", "with", "block", "define":
+			return templateTag{kind: templateStatement, name: "end"}
+		case "end":
+			return templateTag{kind: templateStatement, name: "end", end: true}
+		case "else":
+			return templateTag{kind: templateStatement, middle: true}
+		case "template", "break", "continue":
+			return templateTag{kind: templateStatement}
+		}
+		return templateTag{kind: templateExpression}
+	},
+}
+
+// templSyntax is for the markup within templ components, where control
+// flow statements take up whole lines and expressions are in braces.
+var templSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`(?m)` +
+		`^[ \t]*(?:if|for|switch)\b.*\{[ \t]*$|` +
+		`^[ \t]*\}[ \t]*else\b.*\{[ \t]*$|` +
+		`^[ \t]*(?:case\b.*|default[ \t]*):[ \t]*$|` +
+		`^[ \t]*\}[ \t]*$|` +
+		`^[ \t]*@[\w.]+(?:\(.*?\))?(?:[ \t]*\{)?[ \t]*$|` +
+		`\{\{.*?\}\}|` +
+		`\{[^{}\n]*\}`),
+	classify: func(tag string) templateTag {
+		switch {
+		case strings.HasPrefix(tag, "{{"):
+			return templateTag{kind: templateStatement}
+		case strings.HasPrefix(tag, "}"):
+			if tag == "}" {
+				return templateTag{kind: templateStatement, name: "{", end: true}
+			}
+			return templateTag{kind: templateStatement, middle: true}
+		case strings.HasPrefix(tag, "{"):
+			return templateTag{kind: templateExpression}
+		case strings.HasSuffix(tag, ":"):
+			return templateTag{kind: templateStatement, middle: true}
+		case strings.HasSuffix(tag, "{"):
+			return templateTag{kind: templateStatement, name: "{"}
+		}
+		return templateTag{kind: templateStatement}
+	},
+	bareAttrs: true,
+}
+
+var vueSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`(?s)\{\{.*?\}\}`),
+	classify: func(tag string) templateTag {
+		return templateTag{kind: templateExpression}
+	},
+}
+
+// svelteSyntax matches tags in braces, which can contain braces
+// themselves, as in {#each items as { id, name }}.
+var svelteSyntax = &templateSyntax{
+	pattern: regexp.MustCompile(`\{(?:[^{}]|\{(?:[^{}]|\{[^{}]*\})*\})*\}`),
+	classify: func(tag string) templateTag {
+		inner := strings.TrimSpace(tag[1 : len(tag)-1])
+		if inner == "" {
+			return templateTag{kind: templateExpression}
+		}
+		switch inner[0] {
+		case '#':
+			return templateTag{kind: templateStatement, name: firstWord(inner[1:])}
+		case ':':
+			return templateTag{kind: templateStatement, middle: true}
+		case '/':
+			return templateTag{kind: templateStatement, name: firstWord(inner[1:]), end: true}
+		case '@':
+			switch firstWord(inner[1:]) {
+			case "const", "debug":
+				return templateTag{kind: templateStatement}
+			}
+		}
+		return templateTag{kind: templateExpression}
+	},
+	bareAttrs: true,
+}
+
+var templateSyntaxes = map[TemplateMode]*templateSyntax{
+	Jinja:      jinjaSyntax,
+	Handlebars: handlebarsSyntax,
+	ERB:        erbSyntax,
+	PHP:        phpSyntax,
+	GoTemplate: goTemplateSyntax,
+	Templ:      templSyntax,
+	Vue:        vueSyntax,
+	Svelte:     svelteSyntax,
+}
+
+// templateSet holds the template tags found in a document.
+type templateSet struct {
+	syntax *templateSyntax
+	tags   []templateTag
+	// Regions protected in addition to the template language.
+	regions []RawRegion
+	// Prefixes of attribute names to be left completely untouched.
+	attrs []string
+	// blocks maps the nodes created for paired statements to the index
+	// of the tag that closes them.
+	blocks map[*html.Node]int
+	// components is set for single-file components, with names holding
+	// the names of elements that have capital letters.
+	components bool
+	names      []string
+}
+
+// RawRegion describes regions of the input that are protected from the
+// HTML parser and written back out unchanged. It can be used for template
+// languages and other syntaxes that are not supported by TemplateMode.
+type RawRegion struct {
+
+	// Start and End are the delimiters around the region, such as "[[" and
+	// "]]". The shortest possible match is used for the region.
+	Start, End string
+
+	// Pattern matches the region. It can be used instead of Start and End.
+	Pattern *regexp.Regexp
+
+	// Inline regions are treated like text. Other regions are written on
+	// their own line, the same as comments.
+	Inline bool
+}
+
+func (r RawRegion) compile() *regexp.Regexp {
+	if r.Pattern != nil {
+		return r.Pattern
+	}
+	return regexp.MustCompile(`(?s)` + regexp.QuoteMeta(r.Start) + `.*?` + regexp.QuoteMeta(r.End))
+}
+
+func newTemplateSet(opts Options) *templateSet {
+	ts := &templateSet{
+		syntax:     templateSyntaxes[opts.Template],
+		regions:    opts.RawRegions,
+		attrs:      opts.FrameworkAttrs,
+		blocks:     map[*html.Node]int{},
+		components: isComponentMode(opts.Template),
+	}
+	if ts.components && ts.attrs == nil {
+		ts.attrs = DefaultFrameworkAttrs
+		if opts.Template == Svelte {
+			ts.attrs = append(SvelteAttrs, DefaultFrameworkAttrs...)
+		}
+	}
+	return ts
+}
+
+// add records a template tag and returns its placeholder.
+func (ts *templateSet) add(tag templateTag) []byte {
+	ts.tags = append(ts.tags, tag)
+	mark := placeholderBlock
+	if tag.kind != templateStatement && tag.kind != templateComment {
+		mark = placeholderInline
+	}
+	return []byte(placeholder(mark, len(ts.tags)-1))
+}
+
+// mask replaces the template tags in b with placeholders.
+func (ts *templateSet) mask(b []byte) ([]byte, error) {
+	if ts.components {
+		b = ts.maskSections(b, ts.syntax == vueSyntax)
+	}
+	for _, r := range ts.regions {
+		kind := templateComment
+		if r.Inline {
+			kind = templateExpression
+		}
+		b = r.compile().ReplaceAllFunc(b, func(m []byte) []byte {
+			return ts.add(templateTag{text: string(m), kind: kind})
+		})
+	}
+	if ts.syntax != nil {
+		b = ts.syntax.pattern.ReplaceAllFunc(b, func(m []byte) []byte {
+			// Leading whitespace is kept out of the tag, which gets
+			// indented again when it is written.
+			text := bytes.TrimLeft(m, " \t")
+			tag := ts.syntax.classify(string(text))
+			tag.text = string(text)
+			ws := m[:len(m)-len(text)]
+			return append(append([]byte{}, ws...), ts.add(tag)...)
+		})
+	}
+	if len(ts.tags) == 0 && len(ts.attrs) == 0 && !ts.components && !hasBogusComments(b) && !bytes.Contains(b, []byte("<![endif]-->")) {
+		return b, nil
+	}
+
+	// Move placeholders found in text into comments. Placeholders within
+	// attribute values and raw text elements are left where they are.
+	// Framework attributes are replaced with placeholders too, and so are
+	// the names of components, and the comments around downlevel-revealed
+	// conditional content, which are paired up like block statements.
+	buf := bytes.Buffer{}
+	z := html.NewTokenizer(bytes.NewReader(b))
+	raw := false
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				return buf.Bytes(), nil
+			}
+			return nil, z.Err()
+		}
+		if tt == html.TextToken && !raw {
+			buf.Write(placeholderRegexp.ReplaceAllFunc(z.Raw(), func(m []byte) []byte {
+				return []byte("<!--" + string(m) + "-->")
+			}))
+			continue
+		}
+		if tt == html.CommentToken && !bytes.HasPrefix(z.Raw(), []byte("<!--")) {
+			// Processing instructions such as <?xml ... ?> and other
+			// bogus comments are kept as they were written, instead of
+			// being turned into normal comments. One at the end of the
+			// input is closed, so that it does not take in what is
+			// written after it.
+			text := string(z.Raw())
+			if !strings.HasSuffix(text, ">") {
+				text += ">"
+			}
+			tag := ts.add(templateTag{text: text, kind: templateComment})
+			buf.WriteString("<!--" + string(tag) + "-->")
+			continue
+		}
+		if tt == html.CommentToken && downlevelRevealedRegexp.Match(z.Raw()) {
+			tag := templateTag{text: string(z.Raw()), kind: templateStatement, name: "[if]"}
+			tag.end = bytes.HasPrefix(z.Raw(), []byte("<!--<!"))
+			buf.WriteString("<!--" + string(ts.add(tag)) + "-->")
+			continue
+		}
+		// TagName lower-cases the buffer in place, so Raw must come first.
+		switch {
+		case tt == html.StartTagToken || tt == html.SelfClosingTagToken:
+			buf.Write(ts.maskName(ts.maskAttrs(z.Raw())))
+		case tt == html.EndTagToken:
+			buf.Write(ts.maskName(z.Raw()))
+		default:
+			buf.Write(z.Raw())
+		}
+		switch tt {
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			raw = rawTextElements[string(name)]
+		case html.EndTagToken:
+			raw = false
+		}
+	}
+}
+
+// downlevelRevealedRegexp matches the comments before and after content
+// that is hidden from older versions of Internet Explorer and Outlook but
+// shown by other browsers, as in <!--[if !IE]>--> ... <!--<![endif]--> and
+// <!--[if !mso]><!--> ... <!--<![endif]-->.
+var downlevelRevealedRegexp = regexp.MustCompile(`(?i)^<!--(?:\[if [^\]]*\]>(?:<!)?|<!\[endif\])-->$`)
+
+var bogusCommentRegexp = regexp.MustCompile(`<\?|</[^A-Za-z]|<!(?:[^-]|-[^-]|-?$)`)
+
+// hasBogusComments reports whether b may contain a processing instruction
+// or another bogus comment, other than a doctype.
+func hasBogusComments(b []byte) bool {
+	for _, m := range bogusCommentRegexp.FindAllIndex(b, -1) {
+		if rest := b[m[0]+2:]; len(rest) < 7 || !bytes.EqualFold(rest[:7], []byte("doctype")) {
+			return true
+		}
+	}
+	return false
+}
+
+// restore replaces the placeholders in b with the original template tags.
+func (ts *templateSet) restore(b []byte) []byte {
+	if len(ts.tags) == 0 {
+		return b
+	}
+	return placeholderRegexp.ReplaceAllFunc(b, func(m []byte) []byte {
+		return []byte(ts.expand(string(m)))
+	})
+}
+
+// expand replaces the placeholders in s with the original template tags.
+func (ts *templateSet) expand(s string) string {
+	if len(ts.tags) == 0 {
+		return s
+	}
+	return placeholderRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		// Framework attributes may contain other template tags.
+		return ts.expand(ts.tags[placeholderIndex(m)].text)
+	})
+}
+
+// tag returns the template tag for a placeholder comment node, or nil.
+func (ts *templateSet) tag(n *html.Node) *templateTag {
+	if !isTemplateNode(n) || len(ts.tags) == 0 {
+		return nil
+	}
+	i := placeholderIndex(n.Data)
+	if i < 0 || i >= len(ts.tags) {
+		return nil
+	}
+	return &ts.tags[i]
+}
+
+// isBlock - is the node a pair of statements wrapping its children?
+func (ts *templateSet) isBlock(n *html.Node) bool {
+	_, ok := ts.blocks[n]
+	return ok
+}
+
+// isMiddle - is the node a statement such as "else" within a block?
+func (ts *templateSet) isMiddle(n *html.Node) bool {
+	tag := ts.tag(n)
+	if tag == nil || tag.kind != templateStatement {
+		return false
+	}
+	return tag.middle && ts.isBlock(n.Parent)
+}
+
+// isBareAttr - should the attribute value be written without quotes?
+func (ts *templateSet) isBareAttr(val string) bool {
+	if ts.syntax == nil || !ts.syntax.bareAttrs {
+		return false
+	}
+	loc := placeholderRegexp.FindStringIndex(val)
+	return loc != nil && loc[0] == 0 && loc[1] == len(val)
+}
+
+// closing returns the placeholder for the tag that closes a block.
+func (ts *templateSet) closing(n *html.Node) string {
+	return placeholder(placeholderBlock, ts.blocks[n])
+}
+
+// nest finds pairs of statements that share a parent, and turns them
+// into element-like nodes containing everything between them.
+func (ts *templateSet) nest(n *html.Node) {
+	if len(ts.tags) == 0 {
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ts.nest(c)
+	}
+
+	var open []*html.Node
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		tag := ts.tag(c)
+		if tag == nil || tag.kind != templateStatement || tag.middle || tag.name == "" {
+			c = next
+			continue
+		}
+		if tag.end {
+			for i := len(open) - 1; i >= 0; i-- {
+				if ts.tag(open[i]).name == tag.name {
+					ts.wrap(open[i], c)
+					open = open[:i]
+					break
+				}
+			}
+		} else {
+			open = append(open, c)
+		}
+		c = next
+	}
+}
+
+// wrap moves the nodes between start and end into start,
+// converting it into an element, and removes end.
+func (ts *templateSet) wrap(start, end *html.Node) {
+	for c := start.NextSibling; c != end; c = start.NextSibling {
+		c.Parent.RemoveChild(c)
+		start.AppendChild(c)
+	}
+	end.Parent.RemoveChild(end)
+	start.Type = html.ElementNode
+	ts.blocks[start] = placeholderIndex(end.Data)
+}
+
+func placeholder(mark rune, i int) string {
+	return string(mark) + strconv.Itoa(i) + string(placeholderEnd)
+}
+
+func placeholderIndex(s string) int {
+	m := placeholderRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return -1
+	}
+	i, err := strconv.Atoi(m[1])
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+func firstWord(s string) string {
+	if f := strings.Fields(s); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
+
+// maskAttrs replaces framework attributes within the raw bytes of a start
+// tag with placeholders. The tag must already be known to be well formed.
+func (ts *templateSet) maskAttrs(raw []byte) []byte {
+	if len(ts.attrs) == 0 && !ts.components {
+		return raw
+	}
+	out := make([]byte, 0, len(raw))
+	// Skip over the tag name.
+	i := bytes.IndexFunc(raw, isTagSpace)
+	if i == -1 {
+		return raw
+	}
+	out = append(out, raw[:i]...)
+	for i < len(raw) {
+		start := i
+		// Attribute name.
+		for i < len(raw) && !isTagSpace(rune(raw[i])) && raw[i] != '=' && raw[i] != '>' && raw[i] != '/' {
+			i++
+		}
+		if i == start {
+			out = append(out, raw[i])
+			i++
+			continue
+		}
+		name := raw[start:i]
+		// Optional attribute value.
+		j := skipTagSpace(raw, i)
+		if j < len(raw) && raw[j] == '=' {
+			j = skipTagSpace(raw, j+1)
+			if j < len(raw) && (raw[j] == '"' || raw[j] == '\'') {
+				if k := bytes.IndexByte(raw[j+1:], raw[j]); k != -1 {
+					i = j + k + 2
+				} else {
+					i = len(raw)
+				}
+			} else {
+				for j < len(raw) && !isTagSpace(rune(raw[j])) && raw[j] != '>' {
+					j++
+				}
+				i = j
+			}
+		}
+		// Components also keep the case of their attribute names.
+		if hasAnyPrefix(string(bytes.ToLower(name)), ts.attrs) || ts.components && !bytes.Equal(name, bytes.ToLower(name)) {
+			out = append(out, ts.add(templateTag{
+				text: string(raw[start:i]),
+				kind: templateAttr,
+			})...)
+		} else {
+			out = append(out, raw[start:i]...)
+		}
+	}
+	return out
+}
+
+func isTagSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f'
+}
+
+func skipTagSpace(b []byte, i int) int {
+	for i < len(b) && isTagSpace(rune(b[i])) {
+		i++
+	}
+	return i
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, strings.ToLower(p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,250 @@
+package tidyhtml
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements that are displayed but whose text is not part of the page.
+var untextElements = map[string]bool{
+	"head": true, "noscript": true, "select": true, "title": true,
+}
+
+// Elements that are separated from the text around them by a blank line,
+// rather than just being on lines of their own.
+var paragraphElements = map[string]bool{
+	"blockquote": true, "dl": true, "figure": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "ol": true,
+	"p": true, "pre": true, "table": true, "ul": true,
+}
+
+// PlainText parses a document, as controlled by the Fragment, Context and
+// Charset options, and writes only the text that would be shown, like
+// lynx -dump. Whitespace is collapsed as it is when rendering, blocks
+// such as paragraphs and headings are separated by blank lines, and the
+// items of lists are put on lines of their own with a bullet or a number.
+// The target of each link is written in brackets after its text, unless
+// it is the same as the text or only goes to a part of the same page.
+func PlainText(dst io.Writer, src io.Reader, opts Options) error {
+	doc, err := Parse(src, opts)
+	if err != nil {
+		return err
+	}
+	t := &textWriter{w: bufio.NewWriter(dst)}
+	t.node(doc)
+	if t.started {
+		t.w.WriteString("\n")
+	}
+	return t.w.Flush()
+}
+
+// textWriter writes the text of nodes, keeping track of the whitespace
+// that is to be written before the next text.
+type textWriter struct {
+	w       *bufio.Writer
+	started bool
+
+	// The number of line breaks, and whether a space, is to be written
+	// before the next text.
+	breaks int
+	space  bool
+
+	// The indentation of lines within lists and block quotes.
+	indent string
+}
+
+// block asks for a number of line breaks before the next text.
+func (t *textWriter) block(breaks int) {
+	if breaks > t.breaks {
+		t.breaks = breaks
+	}
+}
+
+// text writes s as it is, after any whitespace that is pending.
+func (t *textWriter) text(s string) {
+	if s == "" {
+		return
+	}
+	if t.started && t.breaks > 0 {
+		t.w.WriteString(strings.Repeat("\n", t.breaks))
+	}
+	if !t.started || t.breaks > 0 {
+		t.w.WriteString(t.indent)
+	} else if t.space {
+		t.w.WriteString(" ")
+	}
+	t.w.WriteString(s)
+	t.started, t.breaks, t.space = true, 0, false
+}
+
+// words writes the text of a text node with its whitespace collapsed.
+func (t *textWriter) words(s string) {
+	s = collapseSpace(s)
+	if strings.HasPrefix(s, " ") {
+		t.space = true
+	}
+	trimmed := strings.TrimSpace(s)
+	t.text(trimmed)
+	if trimmed != "" && strings.HasSuffix(s, " ") {
+		t.space = true
+	}
+}
+
+// pre writes preformatted text with its line breaks kept.
+func (t *textWriter) pre(s string) {
+	s = strings.TrimPrefix(s, "\n")
+	for i, line := range strings.Split(strings.TrimRight(s, " \t\n"), "\n") {
+		if i > 0 {
+			t.block(1)
+		}
+		if line == "" {
+			t.breaks++
+			continue
+		}
+		t.text(line)
+	}
+}
+
+func (t *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		t.words(n.Data)
+		return
+	case html.DocumentNode:
+		t.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if _, hidden := attrValue(n, "hidden"); hidden || n.Namespace != "" || hiddenElements[n.Data] || untextElements[n.Data] {
+		return
+	}
+	switch n.Data {
+	case "br":
+		t.block(1)
+		return
+	case "hr":
+		t.block(2)
+		t.text("----")
+		t.block(2)
+		return
+	case "img", "area":
+		if alt, _ := attrValue(n, "alt"); strings.TrimSpace(alt) != "" {
+			t.words(alt)
+		}
+		return
+	case "input":
+		if typ, _ := attrValue(n, "type"); typ == "submit" || typ == "button" || typ == "reset" {
+			value, _ := attrValue(n, "value")
+			t.words(value)
+		}
+		return
+	case "pre":
+		t.block(2)
+		t.pre(rawText(n))
+		t.block(2)
+		return
+	case "td", "th":
+		if prevSibling(n) != nil {
+			t.text("\t")
+		}
+		t.children(n)
+		return
+	case "li":
+		t.block(1)
+		marker := "*"
+		if n.Parent != nil && n.Parent.Data == "ol" {
+			marker = strconv.Itoa(listNumber(n)) + "."
+		}
+		t.text(marker)
+		t.space = true
+		indent := t.indent
+		t.indent += strings.Repeat(" ", len(marker)+1)
+		t.children(n)
+		t.indent = indent
+		t.block(1)
+		return
+	case "a":
+		t.children(n)
+		href, _ := attrValue(n, "href")
+		href = strings.TrimSpace(href)
+		if href != "" && !strings.HasPrefix(href, "#") && href != textContent(n) {
+			t.space = true
+			t.text("[" + href + "]")
+		}
+		return
+	}
+
+	breaks := 0
+	if (n.Data == "ul" || n.Data == "ol") && isInList(n) {
+		// Nested lists follow on from the item that they are in.
+		breaks = 1
+	} else if paragraphElements[n.Data] {
+		breaks = 2
+	} else if blockElements[n.Data] {
+		breaks = 1
+	}
+	t.block(breaks)
+	indent := t.indent
+	if n.Data == "blockquote" || n.Data == "dd" {
+		t.indent += "    "
+	}
+	t.children(n)
+	t.indent = indent
+	t.block(breaks)
+}
+
+func (t *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		t.node(c)
+	}
+}
+
+// rawText returns the text within a node as it is.
+func rawText(n *html.Node) string {
+	b := strings.Builder{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		} else if n.Type == html.ElementNode && n.Data == "br" {
+			b.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// listNumber returns the number of an item in an ordered list.
+func listNumber(li *html.Node) int {
+	start := 1
+	if v, ok := attrValue(li.Parent, "start"); ok {
+		if i, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+			start = i
+		}
+	}
+	for c := li.Parent.FirstChild; c != nil && c != li; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "li" {
+			start++
+		}
+	}
+	return start
+}
+
+// isInList reports whether a list is nested within an item of another.
+func isInList(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == "li" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// TidyFS tidies the files in fsys, such as a directory from os.DirFS, an
+// embed.FS of templates or a zip.Reader, and calls visit with the path and
+// the tidy content of each one. The files are walked in lexical order, and
+// only those that match is true for are tidied. A nil match tidies the
+// files with the .html and .htm extensions.
+//
+// The same options are used for each file, except that when opts.Template
+// is NoTemplate, the template language is chosen by the extension of each
+// file, as with TemplateForFile. The files are all found before any of
+// them are tidied, so that opts.Progress can be given the total. It stops
+// at the first error, from reading or tidying a file, which is returned as
+// an *fs.PathError, or from visit, which is returned as it is.
+func TidyFS(fsys fs.FS, opts Options, match func(path string) bool, visit func(path string, tidied []byte) error) error {
+	if match == nil {
+		match = isHTMLFile
+	}
+	var paths []string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && match(p) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, p := range paths {
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		opts.debug("opened file", "path", p, "bytes", len(b))
+		fileOpts := opts
+		if fileOpts.Template == NoTemplate {
+			fileOpts.Template = TemplateForFile(p)
+			if fileOpts.Template != NoTemplate {
+				opts.debug("chose template language from extension", "path", p, "template", fileOpts.Template)
+			}
+		}
+		buf := bytes.Buffer{}
+		if err := CopyWithOptions(&buf, bytes.NewReader(b), fileOpts); err != nil {
+			return &fs.PathError{Op: "tidy", Path: p, Err: err}
+		}
+		if err := visit(p, buf.Bytes()); err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(p, i+1, len(paths))
+		}
+	}
+	return nil
+}
+
+// isHTMLFile reports whether a path has the .html or .htm extension.
+func isHTMLFile(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".html", ".htm":
+		return true
+	}
+	return false
+}
@@ -4,24 +4,674 @@ package tidyhtml
 import (
 	"bytes"
 	"io"
+	"log/slog"
+	"strings"
+	"time"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
+// Options control how the HTML is tidied. The zero value gives the
+// default behaviour of Copy.
+type Options struct {
+
+	// Indent is used for each level of indentation.
+	// The default is 4 spaces.
+	Indent string
+
+	// LineEnding is written at the end of each line.
+	// The default is "\n".
+	LineEnding string
+
+	// FinalNewline adds a line ending to the end of the output.
+	FinalNewline bool
+
+	// TrimTrailingSpace removes whitespace from the end of each line.
+	// This includes lines within <pre> elements.
+	TrimTrailingSpace bool
+
+	// Fragment treats the input as a fragment of a document, such as a
+	// partial template, which is parsed as if it were within a <body>.
+	// The <html>, <head> and <body> elements are not added to it.
+	Fragment bool
+
+	// PreserveStructure leaves out the <html>, <head>, <body> and <tbody>
+	// elements that the parser adds when their tags are not in the input,
+	// so that only the elements that were written are tidied. The parser
+	// adds them back in the same places when the output is parsed.
+	PreserveStructure bool
+
+	// Context is the name of the element that a fragment is parsed within,
+	// such as "tbody" for a fragment of table rows, or "head" for a
+	// fragment of metadata. The default is "body".
+	Context string
+
+	// Template enables support for a template language. Its tags are
+	// protected from the HTML parser and written back out unchanged.
+	// A template without a doctype or an <html>, <head> or <body> tag
+	// is tidied as a fragment, as it is a partial or extends another.
+	Template TemplateMode
+
+	// RawRegions are protected from the HTML parser and written back out
+	// unchanged, in addition to the tags of the template language.
+	RawRegions []RawRegion
+
+	// FrameworkAttrs lists attribute name prefixes, such as those in
+	// DefaultFrameworkAttrs, for attributes that must be left completely
+	// untouched. Their names and values are written back out exactly as
+	// they were, without any escaping, quoting, or change of case.
+	FrameworkAttrs []string
+
+	// Charset is the character encoding of the input, such as
+	// "iso-8859-1". When it is empty, the encoding is detected from a byte
+	// order mark or a <meta> element, in the same way as browsers do. The
+	// input is converted to UTF-8, which is always used for the output.
+	// When the input is in another encoding, the <meta> elements that
+	// declare it are changed to declare utf-8, and one is added to a
+	// document that has none, except by CopyStream, which only changes them.
+	Charset string
+
+	// MetaCharset makes sure that there is a single <meta charset="utf-8">,
+	// matching the output, as the first element in the <head>, so that
+	// browsers find it within the first 1024 bytes. An existing one is
+	// updated and moved there, or one is added, and others are removed,
+	// along with any <meta http-equiv="Content-Type"> elements. It does
+	// nothing for fragments.
+	MetaCharset bool
+
+	// OrganizeHead puts the elements in the <head> in a conventional
+	// order: the <meta> that declares the character encoding, the
+	// <title>, other <meta> elements, links, styles and then scripts. It
+	// also removes <meta> and <link> elements that are the same as ones
+	// before them. It does nothing when the <head> has template tags.
+	OrganizeHead bool
+
+	// Minify writes the output as small as possible instead of tidying
+	// it. Whitespace that does not affect rendering is removed, along with
+	// comments, unnecessary quotes, and attributes with default values.
+	// Whitespace within <pre> and <textarea> elements, and the contents of
+	// <script> and <style> elements, are kept as they are.
+	Minify bool
+
+	// CollapseWhitespace writes the output with as little whitespace as
+	// possible without changing how it is rendered, like Minify, but it
+	// keeps comments and attributes as they are, and puts each block
+	// element on its own line so that the output is still readable and
+	// can be compared with diff. Inline elements and text are kept
+	// together on the same line, and Indent is not used.
+	CollapseWhitespace bool
+
+	// BlankLineBefore and BlankLineAfter are CSS selectors, such as
+	// "h2, section, article", for the elements to put a blank line before
+	// or after, to make the output easier to scan. The blank lines are only
+	// put between an element and its siblings, and there is never more
+	// than one between two elements.
+	BlankLineBefore, BlankLineAfter string
+
+	// EscapeNBSP writes the non-breaking spaces in text as &nbsp;, so that
+	// they can be seen in editors and are not lost by other tools.
+	// Non-breaking spaces are never collapsed like other whitespace.
+	EscapeNBSP bool
+
+	// NFC puts text and attribute values into Unicode Normalization Form
+	// C, so that documents which only differ in how characters such as é
+	// are composed are written the same. The content of <script> and
+	// <style> elements is not changed.
+	NFC bool
+
+	// SortAttributes writes the attributes of each element in the order
+	// of their names, so that documents which only differ in the order
+	// are written the same. Elements with template tags among their
+	// attributes are left as they are, as the tags can depend on it.
+	SortAttributes bool
+
+	// BreakAfterBR puts the text after each <br> element on a new line,
+	// indented like the start of the text it is in, so that addresses and
+	// poems are easier to read. The whitespace that this adds after a line
+	// break is not displayed.
+	BreakAfterBR bool
+
+	// CompactTableWidth, if it is more than zero, writes each <tr> on a
+	// single line with its cells, when the line is no longer than this
+	// many characters including the indentation. Longer rows, and rows
+	// with line breaks in them such as in a <pre>, are written as usual.
+	CompactTableWidth int
+
+	// WrapAttrWidth, if it is more than zero, breaks the values of
+	// attributes that are lists, such as class, srcset, sizes and the
+	// content of a Content-Security-Policy <meta>, onto continuation lines
+	// aligned under their starts, where they would make a start tag wider
+	// than this. They are broken at the whitespace between the items, which
+	// is ignored, so they are parsed the same. It is not used with Minify or
+	// CollapseWhitespace, or for start tags that do not start a line.
+	WrapAttrWidth int
+
+	// SafeWhitespace only changes whitespace where it cannot be seen when
+	// the document is displayed. Inline elements that are next to each
+	// other are kept together on the same line instead of being put on
+	// their own lines, which would add a space between them, and spaces at
+	// the start and end of inline elements are kept. Whitespace within
+	// text is still collapsed, so CSS that preserves it, such as
+	// white-space: pre on elements other than <pre>, is not accounted for.
+	SafeWhitespace bool
+
+	// AMP keeps AMP documents valid: the mandatory boilerplate <style>
+	// elements, and the <noscript> around one, are written exactly as
+	// they were, and the attributes that mark AMP documents and their
+	// styles, such as ⚡ and amp-custom, are written without a value.
+	// The lint package reports the elements that AMP does not allow.
+	AMP bool
+
+	// NamespacePrefixes treats the elements whose names have a namespace
+	// prefix, such as the <v:rect> and <o:p> of VML and Microsoft Office
+	// in HTML email, as XML elements, so that a self-closing tag such as
+	// <v:fill /> closes the element instead of containing what follows,
+	// and is written with its slash.
+	NamespacePrefixes bool
+
+	// OmitEndTags leaves out the end tags that are optional in HTML, such
+	// as </li>, </p> and </td>, where doing so does not change the
+	// document. It is mostly useful with Minify.
+	OmitEndTags bool
+
+	// SelfClosing controls whether void elements such as <br> and <img>
+	// are written with a self-closing slash, as in <br />.
+	SelfClosing SelfClosingStyle
+
+	// RenameElements replaces elements with others, keeping their
+	// attributes and content, such as ObsoleteRenames to replace obsolete
+	// elements with their modern equivalents. The keys and values are
+	// lowercase element names.
+	RenameElements map[string]string
+
+	// ElementFormats overrides how the elements with some names are
+	// written, such as InlineFormat for an icon element that should not be
+	// put on a line of its own. The keys are lowercase element names.
+	// Apart from VerbatimFormat, the formats are not used with Minify or
+	// CollapseWhitespace, which only change whitespace that is not
+	// displayed.
+	ElementFormats map[string]ElementFormat
+
+	// Sanitize removes the parts of the document that can run scripts, so
+	// that the output is safe to embed in another page. It removes the
+	// elements in SanitizeElements, event handler attributes such as
+	// onclick, and URLs that use the javascript: scheme.
+	Sanitize bool
+
+	// SanitizeElements are the elements that Sanitize removes, along with
+	// their contents. The default is DefaultSanitizeElements.
+	SanitizeElements []string
+
+	// Policy, if it is not nil, removes the elements, attributes and
+	// URLs that it does not allow. It is applied after Sanitize.
+	Policy *Policy
+
+	// RemoveEmpty removes elements that have no attributes and no content
+	// other than whitespace, such as <span></span> and <p> </p>, along
+	// with elements that only contain such elements. Elements that mean
+	// something when they are empty, such as <td> and <textarea>, are
+	// kept.
+	RemoveEmpty bool
+
+	// RemoveEmptySelector is a CSS selector, such as "div.clear", for
+	// empty elements that RemoveEmpty removes even though they have
+	// attributes. It supports type, class, ID and attribute selectors,
+	// and the descendant and child combinators.
+	RemoveEmptySelector string
+
+	// OnlySelector is a CSS selector, such as "#content" or "main > .post",
+	// for the elements to tidy. When it is set, only the matching
+	// elements and what is within them are tidied, and the rest of the
+	// document is left byte for byte as it was, for pages where only part
+	// is under your control. Matching elements must have end tags, unless
+	// they are void elements, and the options for the output as a whole,
+	// such as FinalNewline, are not used. It supports the same selectors
+	// as RemoveEmptySelector.
+	OnlySelector string
+
+	// ExcludeSelector is a CSS selector, such as ".ProseMirror", for
+	// elements that are written exactly as they were in the input, along
+	// with what is within them, while the rest of the document is tidied.
+	// Matching elements must have end tags, unless they are void elements.
+	ExcludeSelector string
+
+	// VerbatimElements are the names of elements, such as "svg" and
+	// "math", that are written exactly as they were in the input, along
+	// with what is within them, like those that match ExcludeSelector.
+	VerbatimElements []string
+
+	// TidyAttr is the name of the attribute that marks an element to be
+	// written exactly as it was in the input, along with what is within
+	// it, when its value is "off", as in <div data-tidy="off">. It is
+	// DefaultTidyAttr if it is empty, and "-" turns it off.
+	TidyAttr string
+
+	// TidySrcdoc tidies the HTML documents in the srcdoc attributes of
+	// <iframe> elements, using the same options, and escapes them back into
+	// the attributes.
+	TidySrcdoc bool
+
+	// RewriteURL, if it is not nil, is called for each URL in the
+	// attributes that contain them, such as href, src, srcset and poster,
+	// and the URL is replaced with the result. This can be used to make
+	// links absolute, add a CDN prefix, or remove tracking parameters.
+	// URLs that contain template tags are not rewritten.
+	RewriteURL URLRewriter
+
+	// MaxInputBytes, MaxNodes and MaxDepth limit the size of the input, the
+	// number of nodes that it is parsed into, and how deeply its elements
+	// are nested, for when the input cannot be trusted. When one of them
+	// is exceeded, a *LimitError is returned instead of the output, which
+	// matches ErrTooDeep for MaxDepth. Zero means no limit, except that
+	// the parser cannot nest elements more than 512 deep, so deeper input
+	// fails with a MaxDepth error of 512 anyway. MaxNodes and MaxDepth are
+	// checked once the whole input has been parsed, so they bound the work
+	// of tidying it, but not of parsing it. Use MaxInputBytes for that.
+	MaxInputBytes, MaxNodes, MaxDepth int
+
+	// MaxOutputBytes limits the size of the output, which can be much
+	// larger than the input when deeply nested elements are indented.
+	// Tidying stops with a *LimitError as soon as it is exceeded, and
+	// nothing is written to the destination, except by CopyStream, which
+	// may already have written some of the output. Zero means no limit.
+	MaxOutputBytes int
+
+	// ControlChars controls whether control characters, such as NUL bytes,
+	// are kept, removed or escaped in text and attribute values.
+	ControlChars ControlChars
+
+	// BOM controls whether a byte order mark is written at the start of
+	// the output. A byte order mark at the start of the input is always
+	// removed before it is parsed.
+	BOM BOMMode
+
+	// Logger, if it is not nil, is given debug messages about what is
+	// done while tidying, such as the charset that was detected, the
+	// template language, how long parsing and rendering took and how many
+	// nodes were parsed, so that programs can trace problems with their
+	// own logging.
+	Logger *slog.Logger
+
+	// Metrics, if it is not nil, is called at the end of each call to
+	// CopyWithOptions, and the functions built on it, with measurements of
+	// the work that was done, so that services can export them and spot
+	// documents that are slow to tidy. It is called even when tidying
+	// fails, with what was measured before then.
+	Metrics func(Metrics)
+
+	// Progress, if it is not nil, is called by TidyFS after each file is
+	// tidied, with its path, the number of files done so far, and the
+	// total number of files to tidy, so that long runs can show how far
+	// they have got. It is not used when tidying a single document.
+	Progress func(path string, done, total int)
+
+	// positions is set by tidyWithAnchors, which marks the input with
+	// the positions of the elements, to have them written in the output.
+	positions bool
+
+	// metrics collects the measurements for Metrics.
+	metrics *Metrics
+
+	// transcoded is set when the input was converted to UTF-8 from another
+	// encoding, so that the <meta> elements that declare it are changed.
+	transcoded bool
+}
+
+// BOMMode controls whether a byte order mark is written to the output.
+type BOMMode int
+
+const (
+	// RemoveBOM leaves out the byte order mark.
+	RemoveBOM BOMMode = iota
+
+	// KeepBOM writes a UTF-8 byte order mark if the input had one.
+	KeepBOM
+
+	// AddBOM always writes a UTF-8 byte order mark.
+	AddBOM
+)
+
+// DefaultIndent is used when Options.Indent is empty.
+const DefaultIndent = "    "
+
+// DefaultTidyAttr is used when Options.TidyAttr is empty.
+const DefaultTidyAttr = "data-tidy"
+
+func (opts Options) indentation() string {
+	if opts.Indent == "" {
+		return DefaultIndent
+	}
+	return opts.Indent
+}
+
 // Copy HTML from src to dst and tidy it up in the process.
 func Copy(dst io.Writer, src io.Reader) error {
+	return CopyWithOptions(dst, src, Options{})
+}
 
-	node, err := html.Parse(src)
+// CopyWithOptions copies HTML from src to dst and tidies it up
+// in the process, as controlled by opts.
+func CopyWithOptions(dst io.Writer, src io.Reader, opts Options) (err error) {
+	if opts.Metrics != nil {
+		m, start := &Metrics{}, time.Now()
+		opts.metrics = m
+		defer func() {
+			m.Duration = time.Since(start)
+			opts.Metrics(*m)
+		}()
+	}
+
+	b, err := readInput(src, opts)
+	if err != nil {
+		return err
+	}
+	opts.debug("read input", "bytes", len(b))
+	if opts.metrics != nil {
+		opts.metrics.BytesIn = len(b)
+	}
+	bom := opts.BOM == AddBOM || opts.BOM == KeepBOM && hasBOM(b)
+	name, err := inputCharset(b, opts)
 	if err != nil {
 		return err
 	}
+	opts.transcoded = name != "utf-8"
+	if b, err = toUTF8(b, opts); err != nil {
+		return err
+	}
 
-	t := newTidy()
-	b, err := t.render(node)
+	opts.debug("tidying", "template", opts.Template, "fragment", opts.Fragment)
+	switch {
+	case opts.OnlySelector != "":
+		b, err = tidySelected(b, opts)
+		opts.FinalNewline, opts.TrimTrailingSpace, opts.LineEnding = false, false, ""
+	case opts.Template == Templ && !opts.Fragment:
+		b, err = tidyTempl(b, opts)
+	case isComponentMode(opts.Template):
+		opts.Fragment, opts.Context = true, ""
+		b, err = tidyBytes(b, opts)
+	case opts.Template == Markdown:
+		b, err = tidyMarkdown(b, opts)
+		opts.TrimTrailingSpace = false
+	case templateSyntaxes[opts.Template] != nil && !opts.Fragment && !documentTagRegexp.Match(b):
+		// A template without any tags of a whole document is a partial,
+		// or extends one that has them.
+		opts.Fragment = true
+		b, err = tidyBytes(b, opts)
+	default:
+		b, err = tidyBytes(b, opts)
+	}
 	if err != nil {
+		opts.debug("tidying failed", "error", err)
 		return err
 	}
 
+	b = finishLines(b, opts)
+	size := len(b)
+	if bom {
+		size += len(utf8BOM)
+	}
+	if opts.MaxOutputBytes > 0 && size > opts.MaxOutputBytes {
+		return &LimitError{"MaxOutputBytes", opts.MaxOutputBytes}
+	}
+	if bom {
+		if _, err := dst.Write(utf8BOM); err != nil {
+			return err
+		}
+	}
+	if opts.metrics != nil {
+		opts.metrics.BytesOut = size
+	}
 	_, err = io.Copy(dst, bytes.NewReader(b))
 	return err
 }
+
+// finishLines applies the options for the ends of lines to the output.
+func finishLines(b []byte, opts Options) []byte {
+	if opts.TrimTrailingSpace {
+		lines := bytes.Split(b, []byte("\n"))
+		for i, line := range lines {
+			lines[i] = bytes.TrimRight(line, " \t")
+		}
+		b = bytes.Join(lines, []byte("\n"))
+	}
+	if opts.FinalNewline && len(b) != 0 && !bytes.HasSuffix(b, []byte("\n")) {
+		b = append(b, '\n')
+	}
+	if opts.LineEnding != "" && opts.LineEnding != "\n" {
+		b = bytes.Replace(b, []byte("\n"), []byte(opts.LineEnding), -1)
+	}
+	return b
+}
+
+// tidyBytes parses and renders an HTML document or fragment.
+func tidyBytes(b []byte, opts Options) ([]byte, error) {
+
+	ts := newTemplateSet(opts)
+	b, err := ts.mask(b)
+	if err != nil {
+		return nil, err
+	}
+
+	verbatim, err := verbatimMatch(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	src := b
+	if verbatim != nil {
+		b = markPositions(b)
+	}
+
+	if opts.SelfClosing == PreserveSelfClosing || ts.components || opts.NamespacePrefixes {
+		b = markSelfClosing(b, ts.components, opts.NamespacePrefixes)
+	}
+	if opts.PreserveStructure {
+		b = markWritten(b)
+	}
+	start := time.Now()
+	node, err := parse(b, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.metrics != nil || opts.debugEnabled() {
+		d, nodes := time.Since(start), countNodes(node)
+		opts.debug("parsed", "duration", d, "nodes", nodes)
+		if opts.metrics != nil {
+			opts.metrics.ParseDuration += d
+			opts.metrics.Nodes += nodes
+		}
+	}
+	if err := checkLimits(node, opts); err != nil {
+		return nil, err
+	}
+	if verbatim != nil {
+		keepVerbatim(node, src, verbatim)
+	}
+	ts.restoreNames(node)
+	removeIndentationGuides(node)
+	var positions map[*html.Node]int
+	if opts.positions {
+		positions = takePositions(node)
+	}
+	var selfClosed map[*html.Node]bool
+	if opts.SelfClosing == PreserveSelfClosing || ts.components || opts.NamespacePrefixes {
+		selfClosed = takeSelfClosing(node)
+	}
+	var written map[*html.Node]bool
+	if opts.PreserveStructure {
+		written = takeWritten(node)
+	}
+	if opts.MetaCharset && !opts.Fragment {
+		setMetaCharset(node)
+	} else if opts.transcoded {
+		relabelCharset(node, !opts.Fragment)
+	}
+	if opts.OrganizeHead && !opts.Fragment {
+		organizeHead(node)
+	}
+	if opts.Sanitize {
+		sanitize(node, opts)
+	}
+	if opts.Policy != nil {
+		opts.Policy.apply(node)
+	}
+	if opts.RemoveEmpty {
+		var sel selector
+		if opts.RemoveEmptySelector != "" {
+			if sel, err = parseSelector(opts.RemoveEmptySelector); err != nil {
+				return nil, err
+			}
+		}
+		removeEmpty(node, sel)
+	}
+	if opts.TidySrcdoc {
+		if err := tidySrcdoc(node, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.RewriteURL != nil {
+		if err := rewriteURLs(node, opts.RewriteURL); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.RenameElements) != 0 {
+		renameElements(node, opts.RenameElements)
+	}
+	if opts.NFC {
+		normalizeNFC(node)
+	}
+	if opts.SortAttributes {
+		sortAttrs(node)
+	}
+	if opts.PreserveStructure {
+		removeImplied(node, written)
+	}
+	mergeText(node)
+	ts.nest(node)
+
+	start = time.Now()
+	if opts.Minify || opts.CollapseWhitespace {
+		m := minifier{opts: opts, templates: ts, selfClosed: selfClosed, positions: positions}
+		b, err = m.minify(node)
+	} else {
+		t := newTidy()
+		t.opts = opts
+		t.templates = ts
+		t.selfClosed = selfClosed
+		t.positions = positions
+		t.size = len(b)
+		if err := t.parseBlankLines(); err != nil {
+			return nil, err
+		}
+		b, err = t.render(node)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := time.Since(start)
+	opts.debug("rendered", "duration", d, "bytes", len(b))
+	if opts.metrics != nil {
+		opts.metrics.RenderDuration += d
+	}
+
+	return ts.restore(b), nil
+}
+
+// parse parses b into a document node. Fragments are placed directly
+// within the document node. Attributes are kept in the order that they
+// were written.
+func parse(b []byte, opts Options) (*html.Node, error) {
+	b = markAttrOrder(b)
+	if !opts.Fragment {
+		doc, err := html.Parse(bytes.NewReader(b))
+		if err != nil {
+			return nil, parseError(err)
+		}
+		restoreAttrOrder(doc)
+		if bytes.IndexByte(b, 0) != -1 {
+			removeDuplicateAttrs(doc)
+		}
+		return doc, nil
+	}
+	name := strings.ToLower(opts.Context)
+	if name == "" {
+		name = "body"
+	}
+	context := &html.Node{
+		Type:     html.ElementNode,
+		Data:     name,
+		DataAtom: atom.Lookup([]byte(name)),
+	}
+	nodes, err := html.ParseFragment(bytes.NewReader(b), context)
+	if err != nil {
+		return nil, parseError(err)
+	}
+	doc := &html.Node{Type: html.DocumentNode}
+	for _, n := range nodes {
+		doc.AppendChild(n)
+	}
+	restoreAttrOrder(doc)
+	if bytes.IndexByte(b, 0) != -1 {
+		removeDuplicateAttrs(doc)
+	}
+	return doc, nil
+}
+
+// Render writes a tidy version of a tree of nodes to w, as controlled by
+// opts, for trees that have been built or changed in code. The node can be
+// a DocumentNode or any other node. The tree is copied, so it is not
+// changed. Nodes of type html.RawNode are written exactly as they are.
+// The options for templates, and for reading and parsing the input, are
+// not used.
+func Render(w io.Writer, n *html.Node, opts Options) error {
+	doc := &html.Node{Type: html.DocumentNode}
+	if n.Type == html.DocumentNode {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			doc.AppendChild(cloneNode(c))
+		}
+	} else {
+		doc.AppendChild(cloneNode(n))
+	}
+	if doc.FirstChild == nil {
+		return nil
+	}
+
+	ts := newTemplateSet(Options{})
+	var b []byte
+	var err error
+	if opts.Minify || opts.CollapseWhitespace {
+		m := minifier{opts: opts, templates: ts}
+		b, err = m.minify(doc)
+	} else {
+		t := newTidy()
+		t.opts = opts
+		if err := t.parseBlankLines(); err != nil {
+			return err
+		}
+		b, err = t.render(doc)
+	}
+	if err != nil {
+		return err
+	}
+	b = finishLines(b, opts)
+	if opts.MaxOutputBytes > 0 && len(b) > opts.MaxOutputBytes {
+		return &LimitError{"MaxOutputBytes", opts.MaxOutputBytes}
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// cloneNode returns a deep copy of a node, without its parent or siblings.
+func cloneNode(n *html.Node) *html.Node {
+	c := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.AppendChild(cloneNode(child))
+	}
+	return c
+}
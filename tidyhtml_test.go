@@ -3,15 +3,24 @@ package tidyhtml
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 const (
@@ -149,3 +158,1836 @@ func TestCopy(t *testing.T) {
 		}
 	}
 }
+
+// assertOptions tidies the input with the given options
+// and compares it with the expected output.
+func assertOptions(t *testing.T, opts Options, in, out string) {
+	t.Helper()
+	got := bytes.Buffer{}
+	if err := CopyWithOptions(&got, strings.NewReader(in), opts); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != out {
+		t.Error(stringComparisonError(out, got.String()))
+	}
+}
+
+func TestFragmentContext(t *testing.T) {
+	assertOptions(t, Options{Fragment: true}, `<p>a<p>b`, `<p>a</p>
+<p>b</p>`)
+	assertOptions(t, Options{Fragment: true}, "Hello <b>world</b>!\n", "Hello <b>world</b>!")
+	assertOptions(t, Options{Fragment: true, Context: "tbody"},
+		`<tr><td>a<td>b<tr><td>c`, `<tr>
+    <td>a</td>
+    <td>b</td>
+</tr>
+<tr>
+    <td>c</td>
+</tr>`)
+	assertOptions(t, Options{Fragment: true, Context: "head"},
+		`<title>x</title><meta charset=utf-8>`, `<title>x</title>
+<meta charset="utf-8">`)
+}
+
+func TestCharset(t *testing.T) {
+	in := "<html><head><meta charset=\"iso-8859-1\"><title>caf\xe9</title></head><body>\x93quoted\x94</body></html>"
+	out := `<html>
+    <head>
+        <meta charset="utf-8">
+        <title>café</title>
+    </head>
+    <body>“quoted”</body>
+</html>`
+	assertOptions(t, Options{}, in, out)
+	assertOptions(t, Options{MetaCharset: true}, in, out)
+	assertOptions(t, Options{Charset: "windows-1252", Fragment: true}, "<p>\x93a\x94", "<p>“a”</p>")
+	// Bytes that are not valid UTF-8 are written as the replacement
+	// character, which is what they are decoded as.
+	assertOptions(t, Options{Charset: "utf-8", Fragment: true}, "<p>a\xffb\xd9", "<p>a\uFFFDb\uFFFD</p>")
+	// Input that does not say what it is in, and only has ASCII in its
+	// first 1024 bytes, is UTF-8 if it is valid UTF-8, or else
+	// windows-1252.
+	long := strings.Repeat("x", 1100)
+	assertOptions(t, Options{Fragment: true}, "<p>"+long+" café – “quotes”</p>", "<p>"+long+" café – “quotes”</p>")
+	assertOptions(t, Options{Fragment: true}, "<p>"+long+" caf\xe9</p>", "<p>"+long+" café</p>")
+	got := bytes.Buffer{}
+	if err := CopyStream(&got, strings.NewReader("<p>"+long+" café – “quotes”</p>"), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got.String(), long+" café – “quotes”") {
+		t.Errorf("Expected CopyStream to keep UTF-8 text, got %q", got.String())
+	}
+	assertOptions(t, Options{MetaCharset: true}, "<title>é</title>", `<html>
+    <head>
+        <meta charset="utf-8">
+        <title>é</title>
+    </head>
+    <body></body>
+</html>`)
+}
+
+func TestOrganizeHead(t *testing.T) {
+	in := `<head><script src=a.js></script><link rel=stylesheet href=a.css><!-- icons -->
+<link rel=icon href=a.png><style>p{}</style><meta name=viewport content=x><title>x</title>
+<meta charset=utf-8><link href=a.css rel=stylesheet><meta content=x name=viewport></head>`
+	assertOptions(t, Options{OrganizeHead: true}, in, `<html>
+    <head>
+        <meta charset="utf-8">
+        <title>x</title>
+        <meta name="viewport" content="x">
+        <link rel="stylesheet" href="a.css">
+        <!-- icons -->
+        <link rel="icon" href="a.png">
+        <style>p{}</style>
+        <script src="a.js"></script>
+    </head>
+    <body></body>
+</html>`)
+
+	// Template tags are kept where they are, along with everything else.
+	in = "<head><script src=a.js></script>{% if x %}<title>x</title>{% endif %}</head>"
+	assertOptions(t, Options{OrganizeHead: true, Template: Jinja}, in, `<html>
+    <head>
+        <script src="a.js"></script>
+        {% if x %}
+            <title>x</title>
+        {% endif %}
+    </head>
+    <body></body>
+</html>`)
+}
+
+func TestMetaCharset(t *testing.T) {
+	in := `<head><title>x</title><meta http-equiv=Content-Type content="text/html; charset=iso-8859-1">` +
+		`<meta name=viewport content=x><meta charset=latin1></head><body><meta charset=utf-8></body>`
+	assertOptions(t, Options{MetaCharset: true}, in, `<html>
+    <head>
+        <meta charset="utf-8">
+        <title>x</title>
+        <meta name="viewport" content="x">
+    </head>
+    <body></body>
+</html>`)
+}
+
+func TestTranscodedCharset(t *testing.T) {
+	// The declarations of the encoding are changed to match the output.
+	in := "<head><meta charset=\"iso-8859-1\"><meta http-equiv=Content-Type content=\"text/html; charset=iso-8859-1\"></head><p>caf\xe9</p>"
+	assertOptions(t, Options{}, in, `<html>
+    <head>
+        <meta charset="utf-8">
+        <meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+    </head>
+    <body>
+        <p>café</p>
+    </body>
+</html>`)
+	// One is added when the encoding was detected without one.
+	assertOptions(t, Options{}, "<p>caf\xe9</p>", `<html>
+    <head>
+        <meta charset="utf-8">
+    </head>
+    <body>
+        <p>café</p>
+    </body>
+</html>`)
+	// Input that is already UTF-8 is left as it is.
+	assertOptions(t, Options{Fragment: true}, "<meta charset=\"utf-8\"><p>café</p>", "<meta charset=\"utf-8\">\n<p>café</p>")
+
+	out := bytes.Buffer{}
+	if err := CopyStream(&out, strings.NewReader(in), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); strings.Contains(s, "iso-8859-1") || !strings.Contains(s, "café") {
+		t.Errorf("Expected the stream output to be labelled as utf-8, got %q", s)
+	}
+}
+
+func TestAttributeOrder(t *testing.T) {
+	// The parser sorts the attributes of formatting elements, including
+	// those that it opens again.
+	assertOptions(t, Options{Fragment: true}, `<p><a style="x" href="y"><b title=t id=i>a<p>b`, `<p>
+    <a style="x" href="y">
+        <b title="t" id="i">a</b>
+    </a>
+</p>
+<p>
+    <a style="x" href="y">
+        <b title="t" id="i">b</b>
+    </a>
+</p>`)
+	// NUL in names is replaced after duplicates are removed, which can
+	// leave two attributes with the same name.
+	assertOptions(t, Options{Fragment: true}, "<p a\x00=1 a\uFFFD=2>x</p>", "<p a\uFFFD=\"1\">x</p>")
+	// Names can have whitespace in them that is not HTML whitespace.
+	out := "<a z\u00a0=\"\" y\v=\"\" x=\"\">a</a>"
+	assertOptions(t, Options{Fragment: true}, "<a z\u00a0 y\v x>a</a>", out)
+	assertOptions(t, Options{Fragment: true}, out, out)
+}
+
+func TestEmailProfile(t *testing.T) {
+	opts, err := ApplyProfile("email", Options{Fragment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := `<table><tr><td><!--[if mso]><v:rect fill="true" stroke="false"><![endif]-->` +
+		`<v:roundrect href=x><v:fill type=tile /><w:anchorlock/><center>Go</center></v:roundrect>` +
+		`<!--[if !mso]><!--><a style="color:red" href="x">Click</a><!--<![endif]--> <span>x</span><br/><o:p></o:p></td></tr></table>`
+	assertOptions(t, opts, in, `<table>
+    <tbody>
+        <tr>
+            <td><!--[if mso]><v:rect fill="true" stroke="false"><![endif]--><v:roundrect href="x"><v:fill type="tile" /><w:anchorlock /><center>Go</center></v:roundrect><!--[if !mso]><!--><a style="color:red" href="x">Click</a><!--<![endif]--> <span>x</span><br /><o:p></o:p></td>
+        </tr>
+    </tbody>
+</table>
+`)
+}
+
+func TestAMPProfile(t *testing.T) {
+	opts, err := ApplyProfile("amp", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "<!doctype html><html ⚡ lang=en><head><meta charset=utf-8>" +
+		"<style amp-boilerplate>body{-webkit-animation:-amp-start 8s}\n  @keyframes -amp-start{}</style>" +
+		"<noscript><style amp-boilerplate>body{-webkit-animation:none}</style></noscript>" +
+		"<style amp-custom>p{}</style></head><body><p>x</p></body></html>"
+	assertOptions(t, opts, in, `<!doctype html>
+<html ⚡ lang="en">
+    <head>
+        <meta charset="utf-8">
+        <style amp-boilerplate>body{-webkit-animation:-amp-start 8s}
+  @keyframes -amp-start{}</style>
+        <noscript><style amp-boilerplate>body{-webkit-animation:none}</style></noscript>
+        <style amp-custom>p{}</style>
+    </head>
+    <body>
+        <p>x</p>
+    </body>
+</html>
+`)
+}
+
+func TestBOM(t *testing.T) {
+	in := "\uFEFF<!doctype html><p>x"
+	out := `<!doctype html>
+<html>
+    <head></head>
+    <body>
+        <p>x</p>
+    </body>
+</html>`
+	assertOptions(t, Options{}, in, out)
+	assertOptions(t, Options{BOM: KeepBOM}, in, "\uFEFF"+out)
+	assertOptions(t, Options{BOM: KeepBOM}, in[3:], out)
+	assertOptions(t, Options{BOM: AddBOM}, in[3:], "\uFEFF"+out)
+	assertOptions(t, Options{Fragment: true}, "\xFF\xFE<\x00p\x00>\x00\xE9\x00", "<p>é</p>")
+}
+
+func TestControlChars(t *testing.T) {
+	in := "<p title=\"a\x01b\">x\x1by\x00\tz\x7f</p><script>a\x02b</script>"
+	for _, test := range []struct {
+		mode ControlChars
+		out  string
+	}{
+		{KeepControlChars, "<p title=\"a\x01b\">x\x1by z\x7f</p>\n<script>a\x02b</script>"},
+		{RemoveControlChars, "<p title=\"ab\">xy z</p>\n<script>ab</script>"},
+		{EscapeControlChars, "<p title=\"a&#x1;b\">x&#x1B;y z&#x7F;</p>\n<script>ab</script>"},
+	} {
+		assertOptions(t, Options{Fragment: true, ControlChars: test.mode}, in, test.out)
+	}
+	assertOptions(t, Options{Fragment: true, Minify: true, ControlChars: EscapeControlChars}, in,
+		"<p title=a&#x1;b>x&#x1B;y z&#x7F;</p><script>ab</script>")
+	if got := escapeControls("a\x00b", EscapeControlChars, false); got != "a\uFFFDb" {
+		t.Errorf("Expected NUL to be escaped as U+FFFD, got %q", got)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	in := `<!DOCTYPE html>
+<html>
+  <head>
+    <title>A &amp; B</title>
+    <script type="text/javascript">
+      if (a < b) { go(); }
+    </script>
+    <!-- a comment -->
+  </head>
+  <body>
+    <div class="a b" id="x">
+      <p>Hello   <b>world</b> !</p>
+      <pre>  keep
+   this  </pre>
+      <input type="text" disabled="" value="a&amp;b">
+      <a href='say "hi"'>link</a>
+    </div>
+  </body>
+</html>`
+	out := `<!doctype html><html><head><title>A &amp; B</title><script>
+      if (a < b) { go(); }
+    </script></head><body><div class="a b" id=x><p>Hello <b>world</b> !</p><pre>  keep
+   this  </pre><input disabled value=a&amp;b> <a href='say "hi"'>link</a></div></body></html>`
+	got := bytes.Buffer{}
+	if err := Minify(&got, strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != out {
+		t.Error(stringComparisonError(out, got.String()))
+	}
+	assertOptions(t, Options{Minify: true, Fragment: true, Template: Jinja},
+		"{% if a %}\n  <p class=\"{{ c }}\">x</p>\n{% endif %}", `{% if a %}<p class="{{ c }}">x</p>{% endif %}`)
+}
+
+func TestCollapseWhitespace(t *testing.T) {
+	in := `<div class="nav">
+    <span>a</span><span>b</span>
+    <em>c</em>
+</div>
+<!-- list -->
+<ul>
+    <li>x</li>
+    <li>y   <b>z</b></li>
+</ul>
+<pre>
+
+  x</pre>`
+	out := `<div class="nav"><span>a</span><span>b</span> <em>c</em></div>
+<!-- list -->
+<ul>
+<li>x</li>
+<li>y <b>z</b></li>
+</ul>
+<pre>
+
+  x</pre>`
+	assertOptions(t, Options{CollapseWhitespace: true, Fragment: true}, in, out)
+}
+
+func TestMinifyNoscript(t *testing.T) {
+	// The content of a <noscript> is markup, as when tidying, and
+	// minifying or collapsing the output again does not change it.
+	in := "<p>x</p>\n<noscript>\n  <img src=pixel.gif>\n  <p>Enable &amp; JS</p>\n</noscript>"
+	for _, test := range []struct {
+		opts Options
+		out  string
+	}{
+		{Options{Minify: true, Fragment: true}, "<p>x</p><noscript> <img src=pixel.gif><p>Enable & JS</p></noscript>"},
+		{Options{CollapseWhitespace: true, Fragment: true}, "<p>x</p>\n<noscript> <img src=\"pixel.gif\">\n<p>Enable & JS</p>\n</noscript>"},
+	} {
+		assertOptions(t, test.opts, in, test.out)
+		assertOptions(t, test.opts, test.out, test.out)
+	}
+}
+
+func TestMinifyHiddenElements(t *testing.T) {
+	// The whitespace on either side of an element that is not displayed
+	// is seen as one space, so one of them is kept.
+	in := "<p>a <script>x</script> b <link rel=x>c <style>s</style></p>"
+	out := "<p>a<script>x</script> b <link rel=x>c<style>s</style></p>"
+	assertOptions(t, Options{Minify: true, Fragment: true}, in, out)
+	assertOptions(t, Options{Minify: true, Fragment: true}, out, out)
+	assertOptions(t, Options{CollapseWhitespace: true, Fragment: true}, in,
+		"<p>a<script>x</script> b <link rel=\"x\">c<style>s</style></p>")
+}
+
+func TestOmitEndTags(t *testing.T) {
+	in := `<ul><li>x</li><li>y</li></ul><p>a</p><p>b</p><div><p>c</p><!-- x --></div>
+<table><tr><td>1</td><td>2</td></tr><tr><td>3</td></tr></table>`
+	out := `<ul>
+    <li>x
+    <li>y
+</ul>
+<p>a
+<p>b
+<div>
+    <p>c</p>
+    <!-- x -->
+</div>
+<table>
+    <tbody>
+        <tr>
+            <td>1
+            <td>2
+        <tr>
+            <td>3
+</table>`
+	assertOptions(t, Options{OmitEndTags: true, Fragment: true}, in, out)
+	assertOptions(t, Options{OmitEndTags: true, Minify: true}, in,
+		`<html><head><body><ul><li>x<li>y</ul><p>a<p>b<div><p>c</p></div><table><tbody><tr><td>1<td>2<tr><td>3</table>`)
+
+	// The whitespace after a <head>, <colgroup> or <caption> is removed
+	// when minifying, so it does not keep their end tags the first time.
+	in = "<html><head><title>x</title></head>\n<body><table><caption>c</caption>\n<colgroup><col></colgroup>\n<tr><td>1</td></tr></table></body></html>"
+	out = "<html><head><title>x</title><body><table><caption>c<colgroup><col><tbody><tr><td>1</table>"
+	assertOptions(t, Options{OmitEndTags: true, Minify: true}, in, out)
+	assertOptions(t, Options{OmitEndTags: true, Minify: true}, out, out)
+}
+
+func TestRenameElements(t *testing.T) {
+	in := `<p><tt>x</tt> <strike class="a">y</strike> <b>z</b></p>`
+	assertOptions(t, Options{RenameElements: ObsoleteRenames, Fragment: true}, in,
+		`<p>
+    <code>x</code>
+    <s class="a">y</s>
+    <b>z</b>
+</p>`)
+
+	renames, err := ParseRenames("obsolete, B=strong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertOptions(t, Options{RenameElements: renames, Fragment: true}, in,
+		`<p>
+    <code>x</code>
+    <s class="a">y</s>
+    <strong>z</strong>
+</p>`)
+
+	for _, s := range []string{"b", "b=", "=strong"} {
+		if _, err := ParseRenames(s); err == nil {
+			t.Errorf("ParseRenames(%q): expected an error", s)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	in := `<p onclick="x()">Hi<script>alert(1)</script></p>
+<a href=" JavaScript:alert(1)" title="ok">a</a><a href="/b">b</a>
+<iframe src="https://example.com"></iframe>`
+	assertOptions(t, Options{Sanitize: true, Fragment: true}, in, `<p>Hi</p>
+<a title="ok">a</a>
+<a href="/b">b</a>`)
+	assertOptions(t, Options{Sanitize: true, SanitizeElements: []string{"script"}, Fragment: true}, in, `<p>Hi</p>
+<a title="ok">a</a>
+<a href="/b">b</a>
+<iframe src="https://example.com"></iframe>`)
+}
+
+func TestSanitizeRawText(t *testing.T) {
+	// An end tag written as character references is text, and stays text.
+	for _, in := range []string{
+		"<textarea>x &lt;/textarea&gt;&lt;img src=x onerror=alert(1)&gt;</textarea>",
+		"<title>x &lt;/TITLE&gt;&lt;img src=x onerror=alert(1)&gt;</title>",
+	} {
+		out := bytes.Buffer{}
+		if err := CopyWithOptions(&out, strings.NewReader(in), Options{Sanitize: true, Fragment: true}); err != nil {
+			t.Fatal(err)
+		}
+		nodes, err := html.ParseFragment(&out, &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var walk func(n *html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode && n.Data == "img" {
+				t.Errorf("Sanitizing %q writes an <img>: %q", in, out.String())
+			}
+			for _, a := range n.Attr {
+				if strings.HasPrefix(a.Key, "on") {
+					t.Errorf("Sanitizing %q writes an %s attribute: %q", in, a.Key, out.String())
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		for _, n := range nodes {
+			walk(n)
+		}
+	}
+	assertOptions(t, Options{Fragment: true}, "<textarea>a &lt;/b&gt; c < d</textarea>",
+		"<textarea>a &lt;/b> c < d</textarea>")
+}
+
+func TestPolicy(t *testing.T) {
+	policy := &Policy{
+		Elements: map[string][]string{
+			"p": nil,
+			"a": {"href"},
+		},
+		GlobalAttrs: []string{"class"},
+		URLSchemes:  []string{"https", "mailto"},
+	}
+	in := `<div class="x"><p class="a" style="color: red">Hi <span>there</span><script>alert(1)</script></p>
+<a href="https://example.com" id="b">a</a> <a href="ftp://example.com">b</a> <a href="/c">c</a></div>`
+	assertOptions(t, Options{Policy: policy, Fragment: true}, in, `<p class="a">Hi there</p>
+<a href="https://example.com">a</a>
+<a>b</a>
+<a href="/c">c</a>`)
+
+	// Browsers remove tabs and line breaks, and the control characters
+	// and spaces at the start, before reading the scheme.
+	for _, href := range []string{"java&#9;script:x()", "java&#10;script:x()", "java&#13;script:x()", "&#1; &#31;javascript:x()", "ftp&#9;://example.com"} {
+		assertOptions(t, Options{Policy: policy, Fragment: true}, `<a href="`+href+`">a</a>`, `<a>a</a>`)
+	}
+
+	// An end tag within the text of an allowed <textarea> stays text.
+	policy.Elements["textarea"] = nil
+	assertOptions(t, Options{Policy: policy, Fragment: true},
+		`<textarea>&lt;/textarea&gt;&lt;img src=x onerror=x()&gt;</textarea>`,
+		`<textarea>&lt;/textarea><img src=x onerror=x()></textarea>`)
+}
+
+func TestEscapeText(t *testing.T) {
+	in := `<p>a &lt;b&gt; &amp;amp; a < b &amp; c</p><pre>x &lt;y</pre><textarea>&amp;lt;</textarea>`
+	assertOptions(t, Options{Fragment: true}, in, `<p>a &lt;b> &amp;amp; a < b & c</p>
+
+<pre>x &lt;y</pre>
+
+<textarea>&amp;lt;</textarea>`)
+}
+
+func TestNoscript(t *testing.T) {
+	// The content of a <noscript> that the parser would change is written
+	// as it is, with any element that is left open closed.
+	assertOptions(t, Options{Fragment: true}, "<p>x<noscript><noscript>y</noscript>",
+		"<p>x<noscript><noscript>y</noscript></p>")
+	assertOptions(t, Options{Fragment: true}, "<noscript><table>a <script>b",
+		"<noscript>\n    <table>a <script>b</script>\n</noscript>")
+}
+
+func TestBlankContent(t *testing.T) {
+	// Whitespace at the end of a block, and in an element with nothing
+	// else in it, is not displayed, so it is left out.
+	assertOptions(t, Options{Fragment: true}, "<p>a <b>b</b> </p><div> <span>x</span> </div><ul>\n</ul>",
+		"<p>a <b>b</b></p>\n<div>\n    <span>x</span>\n</div>\n<ul></ul>")
+}
+
+func TestPreBlocks(t *testing.T) {
+	// A line break at the start is kept, as the parser removes the first.
+	assertOptions(t, Options{Fragment: true}, "<div><pre>\n\na</pre><pre><pre>b</pre></pre></div>",
+		"<div>\n\n<pre>\n\na</pre>\n<pre><pre>b</pre></pre>\n\n</div>")
+	// The indentation guides are written again, instead of being kept.
+	out := "<div>\n    <div>\n<!-- <== -->\n<pre>x</pre>\n<!-- ==> -->\n    </div>\n</div>"
+	assertOptions(t, Options{Fragment: true}, "<div><div><pre>x</pre></div></div>", out)
+	assertOptions(t, Options{Fragment: true}, out, out)
+}
+
+func TestTidySrcdoc(t *testing.T) {
+	in := `<iframe srcdoc="<p>Hello <b>x</b><div>R &amp;amp; D, &quot;q&quot;</div>"></iframe>`
+	assertOptions(t, Options{Fragment: true, TidySrcdoc: true}, in,
+		`<iframe srcdoc="&lt;p&gt;Hello &lt;b&gt;x&lt;/b&gt;&lt;/p&gt;
+&lt;div&gt;R &amp; D, &#34;q&#34;&lt;/div&gt;"></iframe>`)
+	assertOptions(t, Options{Fragment: true, TidySrcdoc: true, Minify: true}, in,
+		`<iframe srcdoc='<p>Hello <b>x</b></p><div>R &amp; D, "q"</div>'></iframe>`)
+}
+
+func TestVerbatimElements(t *testing.T) {
+	in := "<div>\n<xmp>  a   <b>x</b>\n  y</xmp>\n<noframes>  a  </noframes><noembed> b  </noembed></div>\n<plaintext>  a  <b>\n  z"
+	assertOptions(t, Options{Fragment: true}, in, `<div>
+    <xmp>  a   <b>x</b>
+  y</xmp>
+    <noframes>  a  </noframes>
+    <noembed> b  </noembed>
+</div>
+<plaintext>  a  <b>
+  z`)
+	assertOptions(t, Options{Fragment: true, Minify: true}, in,
+		"<div><xmp>  a   <b>x</b>\n  y</xmp> <noframes>  a  </noframes><noembed> b  </noembed></div><plaintext>  a  <b>\n  z")
+}
+
+func TestRender(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div><p>Hello</p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := doc.FirstChild.LastChild
+	div := body.FirstChild
+	div.AppendChild(&html.Node{Type: html.RawNode, Data: `<custom-widget data-x="1"></custom-widget>`})
+
+	got := bytes.Buffer{}
+	if err := Render(&got, div, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	want := `<div>
+    <p>Hello</p>
+    <custom-widget data-x="1"></custom-widget>
+</div>`
+	if got.String() != want {
+		t.Error(stringComparisonError(want, got.String()))
+	}
+	if div.Parent != body || div.FirstChild.Parent != div {
+		t.Error("Render changed the tree")
+	}
+
+	got.Reset()
+	if err := Render(&got, div, Options{Minify: true}); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<div><p>Hello</p><custom-widget data-x="1"></custom-widget></div>`; got.String() != want {
+		t.Error(stringComparisonError(want, got.String()))
+	}
+}
+
+func TestLimits(t *testing.T) {
+	in := `<div><div><p>Hello <b>world</b></p></div></div>`
+	for _, test := range []struct {
+		opts  Options
+		limit string
+	}{
+		{Options{MaxInputBytes: len(in)}, ""},
+		{Options{MaxInputBytes: len(in) - 1}, "MaxInputBytes"},
+		{Options{Fragment: true, MaxNodes: 6}, ""},
+		{Options{Fragment: true, MaxNodes: 5}, "MaxNodes"},
+		{Options{Fragment: true, MaxDepth: 4}, ""},
+		{Options{Fragment: true, MaxDepth: 3}, "MaxDepth"},
+		{Options{Fragment: true, MaxOutputBytes: 200}, ""},
+		{Options{Fragment: true, MaxOutputBytes: 50}, "MaxOutputBytes"},
+		{Options{Fragment: true, Minify: true, MaxOutputBytes: 20}, "MaxOutputBytes"},
+	} {
+		for _, copy := range []func(io.Writer, io.Reader, Options) error{CopyWithOptions, CopyStream} {
+			err := copy(ioutil.Discard, strings.NewReader(in), test.opts)
+			if test.limit == "" {
+				if err != nil {
+					t.Errorf("%+v: %s", test.opts, err)
+				}
+				continue
+			}
+			var le *LimitError
+			if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &le) || le.Limit != test.limit {
+				t.Errorf("%+v: expected a %s error, got: %v", test.opts, test.limit, err)
+			}
+		}
+	}
+}
+
+func TestTooDeep(t *testing.T) {
+	// Inputs like those that fuzzing finds, which nest elements in
+	// different ways that the parser handles.
+	for _, in := range []string{
+		strings.Repeat("<div>", 500),
+		strings.Repeat("<b><i>", 300) + "x",
+		strings.Repeat("<table><tr><td>", 200),
+		strings.Repeat("<span>", 300),
+		"<svg>" + strings.Repeat("<g>", 500) + "</svg>",
+		strings.Repeat("<ul><li>", 300),
+	} {
+		for _, copy := range []func(io.Writer, io.Reader, Options) error{CopyWithOptions, CopyStream} {
+			err := copy(ioutil.Discard, strings.NewReader(in), Options{MaxDepth: 100})
+			if !errors.Is(err, ErrTooDeep) || !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("%.20s...: expected ErrTooDeep, got: %v", in, err)
+			}
+		}
+	}
+	err := CopyWithOptions(ioutil.Discard, strings.NewReader(strings.Repeat("<div>", 50)), Options{MaxDepth: 100})
+	if err != nil {
+		t.Error(err)
+	}
+	// The parser has a limit of its own.
+	var le *LimitError
+	err = CopyWithOptions(ioutil.Discard, strings.NewReader(strings.Repeat("<div>", 600)), Options{})
+	if !errors.Is(err, ErrTooDeep) || !errors.As(err, &le) || le.Max != 512 {
+		t.Errorf("Expected ErrTooDeep, got: %v", err)
+	}
+	err = CopyWithOptions(ioutil.Discard, strings.NewReader(strings.Repeat("<p>", 500)), Options{MaxNodes: 100})
+	if errors.Is(err, ErrTooDeep) || !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected a MaxNodes error, got: %v", err)
+	}
+}
+
+func TestCopyStream(t *testing.T) {
+	in := `<!DOCTYPE html>
+<html><head><title>A &amp; B</title><script>
+  if (a < b) {}
+</script></head>
+<body><div class="a"><p>Hello   <b>bold</b> world &lt;3<p>Second
+<ul><li>one<li>two</ul></span>
+<pre>
+  keep   this
+</pre>
+<!-- c --><br>
+<table><tr><td>1<td>2</table></div>
+</body></html>`
+	out := `<!doctype html>
+<html>
+  <head>
+    <title>A &amp; B</title>
+    <script>
+  if (a < b) {}
+</script>
+  </head>
+  <body>
+    <div class="a">
+      <p>Hello <b>bold</b> world <3</p>
+      <p>Second</p>
+      <ul>
+        <li>one</li>
+        <li>two</li>
+      </ul>
+      <pre>
+  keep   this
+</pre>
+      <!-- c -->
+      <br>
+      <table>
+        <tr>
+          <td>1</td>
+          <td>2</td>
+        </tr>
+      </table>
+    </div>
+  </body>
+</html>
+`
+	buf := bytes.Buffer{}
+	if err := CopyStream(&buf, strings.NewReader(in), Options{Indent: "  ", FinalNewline: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != out {
+		t.Errorf("Expected:\n%s\nGot:\n%s", out, got)
+	}
+}
+
+func TestCopyStreamLikeTree(t *testing.T) {
+	// For markup that the parser does not change, streaming writes the
+	// same as tidying.
+	for _, in := range []string{
+		"<p> ok</p>",
+		"<div>\n  <p>\n    Hello <b>world</b>\n  </p>\n</div>",
+		"<ul>\n<li> a </li>\n<li>b</li>\n</ul>",
+		"<p>a<noscript><img src=x> <a href=y>z</a></noscript> b</p>",
+		"<table><tbody><tr><td> 1 </td></tr></tbody></table>",
+	} {
+		opts := Options{Fragment: true}
+		tree, stream := bytes.Buffer{}, bytes.Buffer{}
+		if err := CopyWithOptions(&tree, strings.NewReader(in), opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := CopyStream(&stream, strings.NewReader(in), opts); err != nil {
+			t.Fatal(err)
+		}
+		if tree.String() != stream.String() {
+			t.Errorf("%q: expected the same as tidying:\n%s\nGot:\n%s", in, tree.String(), stream.String())
+		}
+	}
+}
+
+func TestMergeText(t *testing.T) {
+	// Removing the script leaves two text nodes next to each other,
+	// which should be written as one.
+	in := `<p>Hello <script>x()</script> world<script>y()</script>!</p>`
+	assertOptions(t, Options{Sanitize: true, Fragment: true}, in, `<p>Hello world!</p>`)
+
+	p := &html.Node{Type: html.ElementNode, Data: "p"}
+	for _, s := range []string{"a", "", "b", " c"} {
+		p.AppendChild(&html.Node{Type: html.TextNode, Data: s})
+	}
+	p.AppendChild(&html.Node{Type: html.ElementNode, Data: "br"})
+	p.AppendChild(&html.Node{Type: html.TextNode, Data: ""})
+	mergeText(p)
+	if c := p.FirstChild; c.Data != "ab c" || c.NextSibling.Data != "br" || c.NextSibling.NextSibling != nil {
+		t.Errorf("Expected the text to be merged, got %q, %q", c.Data, c.NextSibling.Data)
+	}
+}
+
+func TestRemoveEmpty(t *testing.T) {
+	in := `<div><p> </p><p>a<span></span>b<span> </span>c</p><div class="clear"></div><div id="x"><span></span></div>
+<table><tr><td></td></tr></table><textarea></textarea><br></div>`
+	assertOptions(t, Options{RemoveEmpty: true, Fragment: true}, in, `<div>
+    <p>ab c</p>
+    <div class="clear"></div>
+    <div id="x"></div>
+    <table>
+        <tbody>
+            <tr>
+                <td></td>
+            </tr>
+        </tbody>
+    </table>
+    <textarea></textarea>
+    <br>
+</div>`)
+	assertOptions(t, Options{RemoveEmpty: true, RemoveEmptySelector: "div.clear, div > #x", Fragment: true}, in, `<div>
+    <p>ab c</p>
+    <table>
+        <tbody>
+            <tr>
+                <td></td>
+            </tr>
+        </tbody>
+    </table>
+    <textarea></textarea>
+    <br>
+</div>`)
+}
+
+func TestSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="a" class="x y"><p lang="en-GB"><span data-x="abc">s</span></p></div>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	span := doc.LastChild.LastChild.FirstChild.FirstChild.FirstChild
+	for s, want := range map[string]bool{
+		"span":                   true,
+		"*":                      true,
+		"div span":               true,
+		"div > span":             false,
+		"p > span":               true,
+		"#a.y p>span":            true,
+		".z span":                false,
+		"[lang|=en] [data-x]":    true,
+		"[data-x^=a][data-x$=c]": true,
+		"[data-x*=b]":            true,
+		"[data-x='abc']":         true,
+		"[data-x=ab]":            false,
+		"em, span":               true,
+	} {
+		sel, err := parseSelector(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if got := sel.match(span); got != want {
+			t.Errorf("%q: expected %v, got %v", s, want, got)
+		}
+	}
+	for _, s := range []string{"", "a,", "> a", "a >", "a[", "a.", "a!"} {
+		if _, err := parseSelector(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestRewriteURL(t *testing.T) {
+	rewrite := func(element, attr, url string) (string, error) {
+		if url == "bad" {
+			return "", fmt.Errorf("bad URL in %s %s", element, attr)
+		}
+		if strings.HasPrefix(url, "/") {
+			return "https://cdn.example.com" + url, nil
+		}
+		return url, nil
+	}
+	opts := Options{RewriteURL: rewrite, Fragment: true, Template: Jinja}
+	in := `<img src="/a.png" srcset="/a.png 1x,/b.png 2x" alt="x"><a href="{{ url }}">x</a><a href="https://example.com/">y</a>`
+	assertOptions(t, opts, in, `<img src="https://cdn.example.com/a.png" srcset="https://cdn.example.com/a.png 1x, https://cdn.example.com/b.png 2x" alt="x">
+<a href="{{ url }}">x</a>
+<a href="https://example.com/">y</a>`)
+
+	// The commas within a data: URL do not separate candidates.
+	in = `<img srcset="data:image/png;base64,iVBORw0KGgo= 1x, data:image/svg+xml,%3Csvg%3E%3C/svg%3E 2x,/c.png" alt="">`
+	assertOptions(t, opts, in, `<img srcset="data:image/png;base64,iVBORw0KGgo= 1x, data:image/svg+xml,%3Csvg%3E%3C/svg%3E 2x, https://cdn.example.com/c.png" alt="">`)
+
+	err := CopyWithOptions(ioutil.Discard, strings.NewReader(`<a href="bad">x</a>`), opts)
+	if err == nil || err.Error() != "bad URL in a href" {
+		t.Errorf("Expected an error from the rewriter, got: %v", err)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	in := `<div><p class="a" style="color: red">Hi &amp; <b>bye</b></p></div><script>x()</script><script src="a.js"></script><style>p {}</style>`
+	s, err := Analyze(strings.NewReader(in), Options{Fragment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Structure{
+		Elements:      map[string]int{"div": 1, "p": 1, "b": 1, "script": 2, "style": 1},
+		Attributes:    map[string]int{"class": 1, "style": 1, "src": 1},
+		MaxDepth:      3,
+		TextBytes:     8,
+		MarkupBytes:   len(in) - 8,
+		InlineScripts: 1,
+		InlineStyles:  1,
+		StyleAttrs:    1,
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Expected:\n%+v\nGot:\n%+v", want, s)
+	}
+}
+
+func TestJinja(t *testing.T) {
+	in := `<html><head>{% block head %}<link href="{% static "a.css" %}">{% endblock %}</head>
+<body><ul>{% for item in items %}<li>{{ item }}</li>{% empty %}<li>none</li>{% endfor %}</ul>
+<p>Hello {{ name }}! {# comment #}</p></body></html>`
+	out := `<html>
+    <head>
+        {% block head %}
+            <link href='{% static "a.css" %}'>
+        {% endblock %}
+    </head>
+    <body>
+        <ul>
+            {% for item in items %}
+                <li>{{ item }}</li>
+            {% empty %}
+                <li>none</li>
+            {% endfor %}
+        </ul>
+        <p>Hello {{ name }}! {# comment #}</p>
+    </body>
+</html>`
+	assertOptions(t, Options{Template: Jinja}, in, out)
+}
+
+func TestTemplatePartials(t *testing.T) {
+	// Templates without the tags of a whole document are not put in one.
+	assertOptions(t, Options{Template: GoTemplate},
+		`{{define "x"}}<p>x</p>{{end}}`,
+		"{{define \"x\"}}\n    <p>x</p>\n{{end}}")
+	assertOptions(t, Options{Template: Jinja},
+		`{% extends "base.html" %}{% block content %}<p>x</p>{% endblock %}`,
+		"{% extends \"base.html\" %}\n{% block content %}\n    <p>x</p>\n{% endblock %}")
+}
+
+func TestHandlebars(t *testing.T) {
+	in := `<div class="entry {{#if active}}active{{/if}}">{{> header title="x"}}
+<ul>{{#each items}}<li>{{name}}</li>{{else}}<li>none</li>{{/each}}</ul>
+<p>{{{raw "<b>"}}} {{!-- comment --}}</p></div>`
+	out := `<div class="entry {{#if active}}active{{/if}}">
+    {{> header title="x"}}
+    <ul>
+        {{#each items}}
+            <li>{{name}}</li>
+        {{else}}
+            <li>none</li>
+        {{/each}}
+    </ul>
+    <p>{{{raw "<b>"}}} {{!-- comment --}}</p>
+</div>`
+	assertOptions(t, Options{Template: Handlebars}, in, out)
+}
+
+func TestERB(t *testing.T) {
+	in := `<ul><% @items.each do |item| %>
+<li class="<%= item.cls %>"><%= link_to item.name, item %></li>
+<% end %></ul><p>Total: <%= @items.size %> <%# note %></p>`
+	out := `<ul>
+    <% @items.each do |item| %>
+    <li class="<%= item.cls %>"><%= link_to item.name, item %></li>
+    <% end %>
+</ul>
+<p>Total: <%= @items.size %> <%# note %></p>`
+	assertOptions(t, Options{Template: ERB}, in, out)
+}
+
+func TestPHP(t *testing.T) {
+	in := `<?php $items = get_items(); ?>
+<html><body><ul>
+<?php foreach ($items as $i): ?><li class="<?= $i->cls ?>"><?= $i->name ?></li><?php endforeach; ?>
+</ul></body></html>
+<?php echo "<b>footer</b>";`
+	out := `<?php $items = get_items(); ?>
+<html>
+    <head></head>
+    <body>
+        <ul>
+            <?php foreach ($items as $i): ?>
+            <li class="<?= $i->cls ?>"><?= $i->name ?></li>
+            <?php endforeach; ?>
+        </ul>
+    </body>
+</html>
+<?php echo "<b>footer</b>";`
+	assertOptions(t, Options{Template: PHP}, in, out)
+}
+
+func TestFrameworkAttrs(t *testing.T) {
+	in := `<div :class="{'a': x > 1}" @click="fn()" v-if="a && b" class="x">` +
+		`<li *ngFor="let item of items" (keyup.enter)='go("x")'>{{ item }}</li></div>`
+	out := `<html>
+    <head></head>
+    <body>
+        <div :class="{'a': x > 1}" @click="fn()" v-if="a && b" class="x">
+            <li *ngFor="let item of items" (keyup.enter)='go("x")'>{{ item }}</li>
+        </div>
+    </body>
+</html>`
+	assertOptions(t, Options{FrameworkAttrs: DefaultFrameworkAttrs}, in, out)
+}
+
+func TestRawRegions(t *testing.T) {
+	in := `<div>[[ if .x ]]<p>a < b</p>[[ end ]]<p>Hi <@name@>!</p></div>`
+	out := `<html>
+    <head></head>
+    <body>
+        <div>
+            [[ if .x ]]
+            <p>a < b</p>
+            [[ end ]]
+            <p>Hi <@name@>!</p>
+        </div>
+    </body>
+</html>`
+	opts := Options{RawRegions: []RawRegion{
+		{Start: "[[", End: "]]"},
+		{Pattern: regexp.MustCompile(`<@\w+@>`), Inline: true},
+	}}
+	assertOptions(t, opts, in, out)
+}
+
+func TestGoTemplate(t *testing.T) {
+	in := `{{define "main"}}<ul>{{range .Items}}<li class="{{.Class}}">{{.Name}}</li>` +
+		`{{else}}<li>none</li>{{end}}</ul>{{template "footer" .}}{{end}}`
+	out := `{{define "main"}}
+    <ul>
+        {{range .Items}}
+            <li class="{{.Class}}">{{.Name}}</li>
+        {{else}}
+            <li>none</li>
+        {{end}}
+    </ul>
+    {{template "footer" .}}
+{{end}}`
+	assertOptions(t, Options{Template: GoTemplate, Fragment: true}, in, out)
+}
+
+func TestTempl(t *testing.T) {
+	in := `package main
+
+templ Hello(name string, items []string) {
+	<div class={ cls }>
+	if name != "" {
+	<p>Hello, { name }!</p>
+	} else {
+	<p>Hi</p>
+	}
+	@Footer()
+	</div>
+}
+`
+	out := `package main
+
+templ Hello(name string, items []string) {
+    <div class={ cls }>
+        if name != "" {
+            <p>Hello, { name }!</p>
+        } else {
+            <p>Hi</p>
+        }
+        @Footer()
+    </div>
+}
+`
+	assertOptions(t, Options{Template: Templ}, in, out)
+}
+
+// benchmarkInput is a large document made from the demo test file, with
+// its body repeated and nested so that there is plenty of indentation.
+func benchmarkInput(b *testing.B) []byte {
+	demo, err := ioutil.ReadFile(filepath.Join("tests", "demo.in.html"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	buf.WriteString("<!doctype html><html><body>")
+	for i := 0; i < 200; i++ {
+		buf.WriteString(strings.Repeat("<div>", i%20))
+		buf.Write(demo)
+		buf.WriteString("<p>Some   text with\n  <b>several</b> words in it, and <a href=\"#\">a link</a>.</p>")
+		buf.WriteString(strings.Repeat("</div>", i%20))
+	}
+	buf.WriteString("</body></html>")
+	return buf.Bytes()
+}
+
+// FuzzCopy checks that tidying never panics, that the output parses into
+// the same tree as the input, apart from whitespace, and that tidying the
+// output again does not change it. The seed corpus is in testdata/fuzz,
+// along with the test files.
+func FuzzCopy(f *testing.F) {
+	for _, tf := range GetTestFiles() {
+		in, _ := ioutil.ReadAll(tf.ReadIn())
+		f.Add(in)
+	}
+	f.Fuzz(func(t *testing.T, in []byte) {
+		out := bytes.Buffer{}
+		if err := Copy(&out, bytes.NewReader(in)); err != nil {
+			if errors.Is(err, ErrTooDeep) {
+				return
+			}
+			t.Fatal(err)
+		}
+		// The output is compared with the input in UTF-8, which it was
+		// converted to. NUL bytes are left out or replaced depending on
+		// where they are parsed, so inputs with them are not compared,
+		// and nor are inputs in other encodings, as the <meta> elements
+		// that declare the encoding are changed.
+		decoded, err := toUTF8(in, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, err := inputCharset(in, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The output is in UTF-8, which it is tidied again as.
+		tidyAgain := func(b []byte) bytes.Buffer {
+			again := bytes.Buffer{}
+			if err := CopyWithOptions(&again, bytes.NewReader(b), Options{Charset: "utf-8"}); err != nil {
+				t.Fatal(err)
+			}
+			return again
+		}
+		if !isSerializable(t, decoded) {
+			// The output cannot be parsed into the same tree, so it is
+			// only expected to be settled once it has been tidied again.
+			out = tidyAgain(out.Bytes())
+		} else if bytes.IndexByte(decoded, 0) == -1 && name == "utf-8" {
+			if want, got := treeString(t, decoded), treeString(t, out.Bytes()); got != want {
+				t.Fatalf("The output parses differently from the input:\n%s", stringComparisonError(want, got))
+			}
+		}
+		again := tidyAgain(out.Bytes())
+		if again.String() != out.String() {
+			t.Fatalf("Tidying the output again changes it:\n%s", stringComparisonError(out.String(), again.String()))
+		}
+	})
+}
+
+// isSerializable reports whether the tree that b is parsed into is parsed
+// the same again once it is rendered by html.Render. Some trees cannot be
+// written in a way that is parsed into them, such as an <h1> that the
+// parser puts in an <a> in another <h1>, so tidying cannot keep them.
+func isSerializable(t *testing.T, b []byte) bool {
+	t.Helper()
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	if err := html.Render(&buf, doc); err != nil {
+		return false
+	}
+	return treeString(t, buf.Bytes()) == treeString(t, b)
+}
+
+// treeString parses b and describes the tree, with the whitespace in text
+// left out, and without the comments that guide the indentation of <pre>
+// elements. The content of <noscript> elements is described by its
+// markupSummary, which tidying it keeps the same.
+func treeString(t *testing.T, b []byte) string {
+	t.Helper()
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := strings.Builder{}
+	var walk func(n *html.Node, depth int)
+	walk = func(n *html.Node, depth int) {
+		line := ""
+		switch n.Type {
+		case html.ElementNode:
+			line = "<" + n.Namespace + " " + n.Data
+			for _, a := range n.Attr {
+				line += fmt.Sprintf(" %s:%s=%q", a.Namespace, a.Key, a.Val)
+			}
+		case html.TextNode:
+			if n.Parent != nil && n.Parent.Data == "noscript" {
+				if summary := markupSummary(n.Data); summary != "" {
+					line = fmt.Sprintf("%q", summary)
+				}
+			} else {
+				line = strings.Join(strings.FieldsFunc(n.Data, isHTMLSpace), "")
+			}
+		case html.CommentNode:
+			if !isIndentationGuide(n) {
+				line = "<!--" + n.Data
+			}
+		case html.DoctypeNode:
+			line = "<!doctype " + n.Data
+		}
+		if line != "" {
+			buf.WriteString(strings.Repeat(" ", depth) + line + "\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, depth+1)
+		}
+	}
+	walk(doc, 0)
+	return buf.String()
+}
+
+func BenchmarkCopy(b *testing.B) {
+	in := benchmarkInput(b)
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Copy(ioutil.Discard, bytes.NewReader(in)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCopyStream(b *testing.B) {
+	in := benchmarkInput(b)
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := CopyStream(ioutil.Discard, bytes.NewReader(in), Options{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestProcessingInstructions(t *testing.T) {
+	in := "<?xml version=\"1.0\"?>\n<!DOCTYPE html>\n<html><body><div><!WEIRD thing><p>a<?php echo 1 ?>b</p><!-- normal --></div></body></html>"
+	assertOptions(t, Options{}, in, `<?xml version="1.0"?>
+<!doctype html>
+<html>
+    <head></head>
+    <body>
+        <div>
+            <!WEIRD thing>
+            <p>a<?php echo 1 ?>b</p>
+            <!-- normal -->
+        </div>
+    </body>
+</html>`)
+	assertOptions(t, Options{Minify: true}, in,
+		`<?xml version="1.0"?><!doctype html><html><head></head><body><div><!WEIRD thing><p>a<?php echo 1 ?>b</p></div></body></html>`)
+	// So are the other kinds of bogus comments, and one at the end of the
+	// input is closed.
+	assertOptions(t, Options{Fragment: true}, "<p>a</0>b<!>c<!0", "<p>a</0>b<!>c<!0></p>")
+
+	got := bytes.Buffer{}
+	if err := CopyStream(&got, strings.NewReader(`<div><?xml version="1.0"?><p>a<?php echo 1 ?>b</p></div>`), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	want := `<div><?xml version="1.0"?>
+    <p>a<?php echo 1 ?>b</p>
+</div>`
+	if got.String() != want {
+		t.Error(stringComparisonError(want, got.String()))
+	}
+}
+
+func TestDownlevelRevealed(t *testing.T) {
+	in := `<!--[if !IE]>--><p>New</p><div><span>a</span></div><!--<![endif]-->` +
+		`<div><!--[if !mso]><!--><p>b</p>` + "\n" + `<!--<![endif]--></div>` +
+		`<p>Hello <!--[if !IE]>-->world<!--<![endif]--> there</p><!--[if IE]><p>Old</p><![endif]-->`
+	assertOptions(t, Options{Fragment: true}, in, `<!--[if !IE]>-->
+    <p>New</p>
+    <div>
+        <span>a</span>
+    </div>
+<!--<![endif]-->
+<div>
+    <!--[if !mso]><!-->
+        <p>b</p>
+    <!--<![endif]-->
+</div>
+<p>Hello <!--[if !IE]>-->world<!--<![endif]--> there</p>
+<!--[if IE]><p>Old</p><![endif]-->`)
+	assertOptions(t, Options{Fragment: true, Minify: true}, in,
+		`<!--[if !IE]>--><p>New</p><div><span>a</span></div><!--<![endif]--><div><!--[if !mso]><!--><p>b</p><!--<![endif]--></div>`+
+			`<p>Hello <!--[if !IE]>-->world<!--<![endif]--> there</p><!--[if IE]><p>Old</p><![endif]-->`)
+}
+
+func TestSelfClosing(t *testing.T) {
+	in := `<p>a<br>b<br/>c<img src="a.png" /> <svg><path d="M0"/></svg></p>`
+	for _, test := range []struct {
+		style      SelfClosingStyle
+		tidy, mini string
+	}{
+		{NoSelfClosing,
+			`<p>a<br>b<br>c<img src="a.png"> <svg><path d="M0"></path></svg></p>`,
+			`<p>a<br>b<br>c<img src=a.png> <svg><path d=M0></path></svg>`},
+		{VoidSelfClosing,
+			`<p>a<br />b<br />c<img src="a.png" /> <svg><path d="M0"></path></svg></p>`,
+			`<p>a<br />b<br />c<img src=a.png /> <svg><path d=M0></path></svg>`},
+		{PreserveSelfClosing,
+			`<p>a<br>b<br />c<img src="a.png" /> <svg><path d="M0"></path></svg></p>`,
+			`<p>a<br>b<br />c<img src=a.png /> <svg><path d=M0></path></svg>`},
+	} {
+		assertOptions(t, Options{Fragment: true, SelfClosing: test.style}, in, test.tidy)
+		assertOptions(t, Options{Fragment: true, SelfClosing: test.style, Minify: true, OmitEndTags: true}, in, test.mini)
+
+		got := bytes.Buffer{}
+		if err := CopyStream(&got, strings.NewReader(in), Options{SelfClosing: test.style}); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != test.tidy {
+			t.Error(stringComparisonError(test.tidy, got.String()))
+		}
+	}
+
+	for _, name := range []string{"none", "always-void", "preserve-input"} {
+		if _, err := ParseSelfClosingStyle(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := ParseSelfClosingStyle("xhtml"); err == nil {
+		t.Error("Expected an error for an unknown style")
+	}
+}
+
+func TestSafeWhitespace(t *testing.T) {
+	in := `<div><span>a</span><span>b</span></div>
+<div><img src="a"><!-- c --><script>1</script><img src="b"></div>
+<div><img src="a"> <img src="b"></div>
+<p>x<span> a </span>y<b> </b>z</p>`
+	assertOptions(t, Options{Fragment: true}, in, `<div>
+    <span>a</span>
+    <span>b</span>
+</div>
+<div>
+    <img src="a">
+    <!-- c -->
+    <script>1</script>
+    <img src="b">
+</div>
+<div>
+    <img src="a">
+    <img src="b">
+</div>
+<p>x<span>a</span>y<b></b>z</p>`)
+	assertOptions(t, Options{Fragment: true, SafeWhitespace: true}, in, `<div><span>a</span><span>b</span></div>
+<div><img src="a"><!-- c --><script>1</script><img src="b"></div>
+<div>
+    <img src="a">
+    <img src="b">
+</div>
+<p>x<span> a </span>y<b> </b>z</p>`)
+}
+
+func TestPunctuationAfterInline(t *testing.T) {
+	in := `<p>See <a href="#">link</a>.</p>
+<div><a href="#">link</a><span>.</span></div>
+<div><b>x</b><i><em>)</em> y</i></div>
+<div><b>x</b><i>y</i></div>`
+	assertOptions(t, Options{Fragment: true}, in, `<p>See <a href="#">link</a>.</p>
+<div><a href="#">link</a><span>.</span></div>
+<div><b>x</b><i><em>)</em> y</i></div>
+<div>
+    <b>x</b>
+    <i>y</i>
+</div>`)
+}
+
+func TestCompactTables(t *testing.T) {
+	in := `<table>
+<tr>
+<th>Name</th>
+<th>Age</th>
+</tr>
+<tr><td>Alice</td><td>30</td></tr>
+<tr><td>Bob</td><td>A cell that is too long to fit on the line</td></tr>
+</table>`
+	assertOptions(t, Options{Fragment: true, CompactTableWidth: 50}, in, `<table>
+    <tbody>
+        <tr><th>Name</th><th>Age</th></tr>
+        <tr><td>Alice</td><td>30</td></tr>
+        <tr>
+            <td>Bob</td>
+            <td>A cell that is too long to fit on the line</td>
+        </tr>
+    </tbody>
+</table>`)
+}
+
+func TestBlankLines(t *testing.T) {
+	in := `<html><head><title>x</title></head><body><h1>T</h1><section><h2>a</h2><p>x</p><h2>b</h2></section><section><p>y</p></section></body></html>`
+	assertOptions(t, Options{BlankLineBefore: "h2, section", BlankLineAfter: "head, section"}, in, `<html>
+    <head>
+        <title>x</title>
+    </head>
+
+    <body>
+        <h1>T</h1>
+
+        <section>
+            <h2>a</h2>
+            <p>x</p>
+
+            <h2>b</h2>
+        </section>
+
+        <section>
+            <p>y</p>
+        </section>
+    </body>
+</html>`)
+
+	if err := CopyWithOptions(ioutil.Discard, strings.NewReader(in), Options{BlankLineBefore: "h2["}); err == nil {
+		t.Error("Expected an error for an invalid selector")
+	}
+}
+
+func TestBreakAfterBR(t *testing.T) {
+	in := `<div><address>1 Main St,<br> Springfield<br><b>USA<br></b></address><p>a<br><br>b <br></p></div>`
+	assertOptions(t, Options{Fragment: true, BreakAfterBR: true}, in, `<div>
+    <address>1 Main St,<br>
+        Springfield<br>
+        <b>USA<br></b></address>
+    <p>a<br>
+        <br>
+        b <br></p>
+</div>`)
+	assertOptions(t, Options{Fragment: true}, in, `<div>
+    <address>1 Main St,<br> Springfield<br><b>USA<br></b></address>
+    <p>a<br><br>b <br></p>
+</div>`)
+}
+
+func TestNBSP(t *testing.T) {
+	in := "<p>a&nbsp;&nbsp;b&nbsp;</p><p>&nbsp;</p><p> x \u00a0 y</p><textarea>&nbsp;</textarea><script>\"\u00a0\"</script>"
+	assertOptions(t, Options{Fragment: true}, in,
+		"<p>a\u00a0\u00a0b\u00a0</p>\n<p>\u00a0</p>\n<p>x \u00a0 y</p>\n<textarea>\u00a0</textarea>\n<script>\"\u00a0\"</script>")
+	assertOptions(t, Options{Fragment: true, EscapeNBSP: true}, in,
+		"<p>a&nbsp;&nbsp;b&nbsp;</p>\n<p>&nbsp;</p>\n<p>x &nbsp; y</p>\n<textarea>&nbsp;</textarea>\n<script>\"\u00a0\"</script>")
+	assertOptions(t, Options{Fragment: true, EscapeNBSP: true, Minify: true}, in,
+		"<p>a&nbsp;&nbsp;b&nbsp;</p><p>&nbsp;</p><p>x &nbsp; y</p><textarea>&nbsp;</textarea><script>\"\u00a0\"</script>")
+}
+
+func TestNFC(t *testing.T) {
+	in := "<p title=\"Cafe\u0301\">Cafe\u0301 cr\u00e8me</p><script>\"e\u0301\"</script>"
+	assertOptions(t, Options{Fragment: true}, in,
+		"<p title=\"Cafe\u0301\">Cafe\u0301 cr\u00e8me</p>\n<script>\"e\u0301\"</script>")
+	assertOptions(t, Options{Fragment: true, NFC: true}, in,
+		"<p title=\"Caf\u00e9\">Caf\u00e9 cr\u00e8me</p>\n<script>\"e\u0301\"</script>")
+	assertOptions(t, Options{Fragment: true, NFC: true, Minify: true}, in,
+		"<p title=Caf\u00e9>Caf\u00e9 cr\u00e8me</p><script>\"e\u0301\"</script>")
+	got := bytes.Buffer{}
+	if err := CopyStream(&got, strings.NewReader(in), Options{Fragment: true, NFC: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got.String(), "title=\"Caf\u00e9\">Caf\u00e9") {
+		t.Errorf("Expected CopyStream to normalize the text, got %q", got.String())
+	}
+}
+
+func TestSortAttributes(t *testing.T) {
+	in := `<a title="t" href="/" class="c">a</a>`
+	assertOptions(t, Options{Fragment: true}, in, `<a title="t" href="/" class="c">a</a>`)
+	assertOptions(t, Options{Fragment: true, SortAttributes: true}, in, `<a class="c" href="/" title="t">a</a>`)
+	// The attributes that a template tag sets stay where they are.
+	tmpl := `<input type="checkbox" {% if on %}checked{% endif %} name="a">`
+	assertOptions(t, Options{Fragment: true, SortAttributes: true, Template: Jinja}, tmpl, tmpl)
+	got := bytes.Buffer{}
+	if err := CopyStream(&got, strings.NewReader(in), Options{Fragment: true, SortAttributes: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got.String(), `<a class="c" href="/" title="t">`) {
+		t.Errorf("Expected CopyStream to sort the attributes, got %q", got.String())
+	}
+}
+
+func TestCanonicalProfile(t *testing.T) {
+	opts, err := ApplyProfile("canonical", Options{Fragment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<ul>\n<li class=\"a\" id=\"x\">Caf\u00e9&nbsp;<b>au</b> lait</li>\n</ul>\n"
+	for _, in := range []string{
+		"<ul>\r\n  <li id=x class='a'>Cafe\u0301\u00a0<b>au</b>   lait\r\n</ul>",
+		"<UL><LI CLASS=\"a\" ID=\"x\">Caf&eacute;&#160;<B>au</B> lait</LI></UL>",
+	} {
+		assertOptions(t, opts, in, want)
+	}
+}
+
+func TestWrapAttrWidth(t *testing.T) {
+	opts := Options{Fragment: true, WrapAttrWidth: 40}
+	in := `<div><img srcset="a-480.jpg 480w, a-800.jpg 800w,  a-1200.jpg 1200w" alt=""></div>`
+	want := `<div>
+    <img srcset="a-480.jpg 480w,
+                 a-800.jpg 800w,
+                 a-1200.jpg 1200w" alt="">
+</div>`
+	assertOptions(t, opts, in, want)
+	assertOptions(t, opts, want, want)
+	// The breaks are joined up again when the value fits.
+	assertOptions(t, Options{Fragment: true, WrapAttrWidth: 100}, want,
+		`<div>
+    <img srcset="a-480.jpg 480w, a-800.jpg 800w, a-1200.jpg 1200w" alt="">
+</div>`)
+	// Only the whitespace after the semicolons of a policy is broken at.
+	assertOptions(t, opts, `<meta http-equiv="Content-Security-Policy" content="img-src *; script-src 'self' https://cdn.example.com">`,
+		`<meta http-equiv="Content-Security-Policy" content="img-src *;
+                                                    script-src &#39;self&#39; https://cdn.example.com">`)
+	// Other attributes, and values with template tags, are left as they are.
+	for _, in := range []string{
+		`<a title="a longer title than fits within the width">a</a>`,
+		`<p class="{{ first_class }} {{ second_class }} {{ third_class }}">a</p>`,
+	} {
+		assertOptions(t, Options{Fragment: true, WrapAttrWidth: 20, Template: Jinja}, in, in)
+	}
+}
+
+func TestPreserveStructure(t *testing.T) {
+	opts := Options{PreserveStructure: true}
+	minimal := "<!DOCTYPE html>\n<title>x</title>\n<p>a\n<table><tr><td>1</td></tr></table>"
+	want := "<!doctype html>\n<title>x</title>\n<p>a</p>\n<table>\n    <tr>\n        <td>1</td>\n    </tr>\n</table>"
+	assertOptions(t, opts, minimal, want)
+	assertOptions(t, opts, want, want)
+	// The elements that were written are kept, whatever their case.
+	in := "<HTML lang=en><title>x</title>\n<body><table><tbody><tr><td>1</table><table><tr><td>2</table>"
+	assertOptions(t, opts, in, `<html lang="en">
+    <title>x</title>
+    <body>
+        <table>
+            <tbody>
+                <tr>
+                    <td>1</td>
+                </tr>
+            </tbody>
+        </table>
+        <table>
+            <tr>
+                <td>2</td>
+            </tr>
+        </table>
+    </body>
+</html>`)
+}
+
+func TestElementFormats(t *testing.T) {
+	formats, err := ParseElementFormats("x-card=block, x-sep=inline,x-code=pre,ul=compact,x-math=verbatim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Fragment: true, SafeWhitespace: true, ElementFormats: formats}
+	assertOptions(t, opts, "<div><x-card>a</x-card><x-card>b</x-card></div>",
+		"<div>\n    <x-card>a</x-card>\n    <x-card>b</x-card>\n</div>")
+	assertOptions(t, opts, "<nav>\n<a href=\"/\">Home</a>\n<x-sep></x-sep>\n</nav>",
+		`<nav> <a href="/">Home</a> <x-sep></x-sep></nav>`)
+	assertOptions(t, opts, "<div><x-code>  a\n    b\n</x-code></div>",
+		"<div>\n    <x-code>  a\n    b\n</x-code>\n</div>")
+	assertOptions(t, opts, "<ul><li>One</li><li>Two</li></ul>", "<ul><li>One</li><li>Two</li></ul>")
+	assertOptions(t, opts, "<ul><li>"+strings.Repeat("x", 80)+"</li></ul>",
+		"<ul>\n    <li>"+strings.Repeat("x", 80)+"</li>\n</ul>")
+	assertOptions(t, opts, "<div><x-math><b>raw   </b></x-math></div>",
+		"<div>\n    <x-math><b>raw   </b></x-math>\n</div>")
+	for _, s := range []string{"x-card", "=block", "x-card=round"} {
+		if _, err := ParseElementFormats(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestTidyFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":           {Data: []byte("<p>a<p>b")},
+		"docs/page.HTM":        {Data: []byte("<div><span>x</span></div>")},
+		"templates/list.jinja": {Data: []byte("<ul>{% for x in xs %}<li>{{ x }}</li>{% endfor %}</ul>")},
+		"style.css":            {Data: []byte("p {}")},
+	}
+	got := map[string]string{}
+	visit := func(path string, tidied []byte) error {
+		got[path] = string(tidied)
+		return nil
+	}
+	if err := TidyFS(fsys, Options{Fragment: true}, nil, visit); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"index.html":    "<p>a</p>\n<p>b</p>",
+		"docs/page.HTM": "<div>\n    <span>x</span>\n</div>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	got = map[string]string{}
+	match := func(path string) bool { return strings.HasPrefix(path, "templates/") }
+	if err := TidyFS(fsys, Options{Fragment: true}, match, visit); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{
+		"templates/list.jinja": "<ul>\n    {% for x in xs %}\n        <li>{{ x }}</li>\n    {% endfor %}\n</ul>",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	var progress []string
+	opts := Options{Fragment: true, Progress: func(path string, done, total int) {
+		progress = append(progress, fmt.Sprintf("%s %d/%d", path, done, total))
+	}}
+	if err := TidyFS(fsys, opts, nil, visit); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"docs/page.HTM 1/2", "index.html 2/2"}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("Expected progress %q, got %q", want, progress)
+	}
+
+	err := TidyFS(fsys, Options{MaxInputBytes: 10}, nil, visit)
+	var pathErr *fs.PathError
+	if !errors.As(err, &pathErr) || pathErr.Path != "docs/page.HTM" || !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected a path error for docs/page.HTM, got %v", err)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	in := "# Title\n\nSome *prose* with <span>inline</span> html.  \nA line break.\n\n" +
+		"<div class=\"note\"><p>Hello\n<b>world</b></p></div>\n\n" +
+		"```html\n<div><p>code</p></div>\n```\n\n" +
+		"- item\n\n  <ul><li>a</li></ul>\n\n" +
+		"<div>\n\n**Markdown**\n\n</div>\n"
+	out := "# Title\n\nSome *prose* with <span>inline</span> html.  \nA line break.\n\n" +
+		"<div class=\"note\">\n    <p>Hello <b>world</b></p>\n</div>\n\n" +
+		"```html\n<div><p>code</p></div>\n```\n\n" +
+		"- item\n\n  <ul>\n      <li>a</li>\n  </ul>\n\n" +
+		"<div>\n\n**Markdown**\n\n</div>\n"
+	assertOptions(t, Options{Template: Markdown, TrimTrailingSpace: true}, in, out)
+	if m := TemplateForFile("README.md"); m != Markdown {
+		t.Errorf("Expected markdown for README.md, got %s", m)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	in := "<template>\n<div :class=\"{ on: isOn }\" @click=\"go\">\n<MyButton label=\"Hi\" :onClick=\"x\"/>\n" +
+		"<p>{{ message }}   there</p>\n</div>\n</template>\n\n<script setup>\nconst   message = 'hi'\n</script>\n\n" +
+		"<style scoped>\n.a   { color: red }\n</style>\n"
+	out := "<template>\n    <div :class=\"{ on: isOn }\" @click=\"go\">\n        <MyButton label=\"Hi\" :onClick=\"x\" />\n" +
+		"        <p>{{ message }} there</p>\n    </div>\n</template>\n\n<script setup>\nconst   message = 'hi'\n</script>\n\n" +
+		"<style scoped>\n.a   { color: red }\n</style>\n"
+	assertOptions(t, Options{Template: Vue, FinalNewline: true}, in, out)
+
+	in = "<script>\n  let   items = [];\n</script>\n\n<Header/>\n{#if items.length}\n<ul>\n{#each items as { id, name }}\n" +
+		"<li on:click={() => pick(id)}>{name}</li>\n{/each}\n</ul>\n{:else}\n<p>None</p>\n{/if}\n<input bind:value>\n"
+	out = "<script>\n  let   items = [];\n</script>\n\n<Header />\n{#if items.length}\n    <ul>\n        {#each items as { id, name }}\n" +
+		"            <li on:click={() => pick(id)}>{name}</li>\n        {/each}\n    </ul>\n{:else}\n    <p>None</p>\n{/if}\n<input bind:value>\n"
+	assertOptions(t, Options{Template: Svelte, FinalNewline: true}, in, out)
+
+	if m := TemplateForFile("App.vue"); m != Vue {
+		t.Errorf("Expected vue for App.vue, got %s", m)
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	src := "<html>\n<body>\n<div><p>a</p>\n<ul><li>x</li>\n<li>y</li></ul>\n</div>\n  <table><tr><td>1</td></tr></table>\n</body></html>\n"
+	tests := []struct {
+		start, end int
+		out        string
+	}{
+		{4, 5, "<html>\n<body>\n<div><p>a</p>\n<ul>\n    <li>x</li>\n    <li>y</li>\n</ul>\n</div>\n" +
+			"  <table><tr><td>1</td></tr></table>\n</body></html>\n"},
+		{3, 5, "<html>\n<body>\n<div><p>a</p>\n    <ul>\n        <li>x</li>\n        <li>y</li>\n    </ul>\n</div>\n" +
+			"  <table><tr><td>1</td></tr></table>\n</body></html>\n"},
+		{7, 7, "<html>\n<body>\n<div><p>a</p>\n<ul><li>x</li>\n<li>y</li></ul>\n</div>\n" +
+			"  <table>\n      <tbody>\n          <tr>\n              <td>1</td>\n          </tr>\n      </tbody>\n  </table>\n" +
+			"</body></html>\n"},
+		{5, 6, src},
+	}
+	for _, test := range tests {
+		out, err := FormatRange([]byte(src), test.start, test.end, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != test.out {
+			t.Errorf("Lines %d-%d:\nExpected:\n%s\nGot:\n%s", test.start, test.end, test.out, out)
+		}
+	}
+	if _, err := FormatRange([]byte(src), 3, 2, Options{}); err == nil {
+		t.Error("Expected an error for an invalid line range")
+	}
+}
+
+func TestOnlySelector(t *testing.T) {
+	src := "<html><head><title>x</title></head>\n<body>\n<div id=nav><ul><li>a</li></ul></div>\n" +
+		"  <main><p class=post><b>b</b>   c</p><p class=post>d</p><p>e</p></main>\n</body></html>"
+	tests := []struct {
+		sel, out string
+	}{
+		{"#nav", "<html><head><title>x</title></head>\n<body>\n<div id=\"nav\">\n    <ul>\n        <li>a</li>\n    </ul>\n</div>\n" +
+			"  <main><p class=post><b>b</b>   c</p><p class=post>d</p><p>e</p></main>\n</body></html>"},
+		{"main > .post", "<html><head><title>x</title></head>\n<body>\n<div id=nav><ul><li>a</li></ul></div>\n" +
+			"  <main><p class=\"post\"><b>b</b> c</p>\n      <p class=\"post\">d</p><p>e</p></main>\n</body></html>"},
+		{"body", "<html><head><title>x</title></head>\n<body>\n<div id=\"nav\">\n    <ul>\n        <li>a</li>\n    </ul>\n</div>\n" +
+			"<main>\n    <p class=\"post\"><b>b</b> c</p>\n    <p class=\"post\">d</p>\n    <p>e</p>\n</main>\n</body></html>"},
+		{"table", src},
+	}
+	for _, test := range tests {
+		out := bytes.Buffer{}
+		if err := CopyWithOptions(&out, strings.NewReader(src), Options{OnlySelector: test.sel, FinalNewline: true}); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.out {
+			t.Errorf("Selector %q:\nExpected:\n%s\nGot:\n%s", test.sel, test.out, out.String())
+		}
+	}
+	if err := CopyWithOptions(io.Discard, strings.NewReader(src), Options{OnlySelector: "p["}); err == nil {
+		t.Error("Expected an error for an invalid selector")
+	}
+}
+
+func TestExcludeSelector(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"<div><p>a   b</p><div class=embed><p>x   y</p>  <ul><li>1<li>2</ul></div></div>",
+			"<div>\n    <p>a b</p>\n    <div class=embed><p>x   y</p>  <ul><li>1<li>2</ul></div>\n</div>"},
+		{"<p>text <span class=embed>a    b</span>   more</p>", "<p>text <span class=embed>a    b</span> more</p>"},
+		{"<div>{% if x %}<div class=embed>{{ y }}   z</div>{% endif %}</div>",
+			"<div>\n    {% if x %}\n        <div class=embed>{{ y }}   z</div>\n    {% endif %}\n</div>"},
+		// Elements that are closed implicitly are tidied as usual.
+		{"<ul><li class=embed>a   b<li>c</ul>", "<ul>\n    <li class=\"embed\">a b</li>\n    <li>c</li>\n</ul>"},
+	}
+	for _, test := range tests {
+		assertOptions(t, Options{Fragment: true, Template: Jinja, ExcludeSelector: ".embed"}, test.in, test.out)
+	}
+}
+
+func TestVerbatimElementsOption(t *testing.T) {
+	in := "<div>\n<svg viewBox=\"0 0 10 10\"><circle cx=5 cy=5 r=4/>\n  <g></g></svg>\n<MATH><mi>x</mi></MATH>\n<p>a</p></div>"
+	want := "<div>\n    <svg viewBox=\"0 0 10 10\"><circle cx=5 cy=5 r=4/>\n  <g></g></svg>\n    <MATH><mi>x</mi></MATH>\n    <p>a</p>\n</div>"
+	assertOptions(t, Options{Fragment: true, VerbatimElements: []string{"svg", "Math"}}, in, want)
+}
+
+func TestTidyAttr(t *testing.T) {
+	in := "<div><p data-tidy=off>a   <b>b</b></p><p>c   d</p><p data-tidy=on>e   f</p></div>"
+	assertOptions(t, Options{Fragment: true}, in,
+		"<div>\n    <p data-tidy=off>a   <b>b</b></p>\n    <p>c d</p>\n    <p data-tidy=\"on\">e f</p>\n</div>")
+	in = "<div><p data-keep=off>a   b</p><p data-tidy=off>c   d</p></div>"
+	assertOptions(t, Options{Fragment: true, TidyAttr: "data-keep"}, in,
+		"<div>\n    <p data-keep=off>a   b</p>\n    <p data-tidy=\"off\">c d</p>\n</div>")
+	assertOptions(t, Options{Fragment: true, TidyAttr: "-"}, in,
+		"<div>\n    <p data-keep=\"off\">a b</p>\n    <p data-tidy=\"off\">c d</p>\n</div>")
+}
+
+func TestFormatWithOffsets(t *testing.T) {
+	src := "<div><p class=a>hello   <b>world</b></p>\n{% if x %}<ul><li>item</li></ul>{% endif %}</div>"
+	want := "<div>\n    <p class=\"a\">hello <b>world</b></p>\n    {% if x %}\n        <ul>\n" +
+		"            <li>item</li>\n        </ul>\n    {% endif %}\n</div>"
+	// Each offset is before the same text in the input and the output.
+	for _, text := range []string{"ello", "   <b>", "world", "<ul>", "tem", "{% endif"} {
+		off := strings.Index(src, text)
+		out, offsets, err := FormatWithOffsets([]byte(src), Options{Fragment: true, Template: Jinja}, []int{off})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != want {
+			t.Fatalf("Expected:\n%s\nGot:\n%s", want, out)
+		}
+		wantText := strings.TrimLeft(text, " ")
+		if text != wantText {
+			wantText = " " + wantText
+		}
+		if got := want[offsets[0]:]; !strings.HasPrefix(got, wantText) {
+			t.Errorf("Expected the offset of %q to be before it, got %q", text, got)
+		}
+	}
+}
+
+func TestFormatWithSourceMap(t *testing.T) {
+	src := "<div><p>One</p>\n  <p>Two\n<b>three</b></p></div>\n"
+	out, m, err := FormatWithSourceMap([]byte(src), Options{Fragment: true, FinalNewline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<div>\n    <p>One</p>\n    <p>Two <b>three</b></p>\n</div>\n"
+	if string(out) != want {
+		t.Fatalf("Expected:\n%s\nGot:\n%s", want, out)
+	}
+	tests := []struct {
+		line, inLine, inColumn int
+	}{
+		{1, 1, 1},
+		{2, 1, 6},
+		{3, 2, 3},
+		{4, 3, 1},
+	}
+	for _, test := range tests {
+		pos := m.Lookup(test.line)
+		if pos.Line != test.inLine || pos.Column != test.inColumn {
+			t.Errorf("Line %d: expected %d:%d, got %d:%d", test.line, test.inLine, test.inColumn, pos.Line, pos.Column)
+		}
+	}
+	if len(m) != 4 || m[3].Output.Line != 3 || m[3].Output.Column != 12 || m[3].Input.Line != 3 {
+		t.Errorf("Unexpected mapping for <b>: %+v", m)
+	}
+}
+
+func TestOutline(t *testing.T) {
+	in := `<h1>Title</h1><nav aria-label="Main"></nav><h2>A  <b>b</b></h2><h3>c</h3>` +
+		`<section><h2>In</h2></section><h2>D</h2>`
+	items, err := Outline(strings.NewReader(in), Options{Fragment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OutlineItem{
+		{"h1", "Title", 0},
+		{"nav", "Main", 1},
+		{"h2", "A b", 1},
+		{"h3", "c", 2},
+		{"section", "", 3},
+		{"h2", "In", 4},
+		{"h2", "D", 1},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("Expected %v, got %v", want, items)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	in := "<head><title>T</title></head><h1>Hello   world</h1>\n" +
+		`<p>A <a href="https://example.com/">link</a>, <a href="#x">here</a>.<br>Next</p>` +
+		`<ol start="2"><li>one</li><li>two<ul><li>nested</li></ul></li></ol>` +
+		"<pre>  a\n\n  b</pre><script>x()</script><div hidden>no</div><div>end</div>"
+	want := "Hello world\n\nA link [https://example.com/], here.\nNext\n\n" +
+		"2. one\n3. two\n   * nested\n\n  a\n\n  b\n\nend\n"
+	buf := bytes.Buffer{}
+	if err := PlainText(&buf, strings.NewReader(in), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestComputeDiff(t *testing.T) {
+	d, changed, err := ComputeDiff("a.html", []byte("<p>a</p>\n"), Options{Fragment: true, FinalNewline: true})
+	if err != nil || changed || d != nil {
+		t.Errorf("Expected no diff for tidy input, got %q, %v, %v", d, changed, err)
+	}
+	d, changed, err = ComputeDiff("a.html", []byte("<p>a\n</p>"), Options{Fragment: true, FinalNewline: true})
+	want := "--- a.html.orig\n+++ a.html\n@@ -1,2 +1 @@\n-<p>a\n-</p>\n\\ No newline at end of file\n+<p>a</p>\n"
+	if err != nil || !changed || string(d) != want {
+		t.Errorf("Expected %q, got %q, %v, %v", want, d, changed, err)
+	}
+}
+
+func TestEqualHTML(t *testing.T) {
+	opts := Options{Fragment: true}
+	equal, d, err := EqualHTML(
+		strings.NewReader(`<div class="a" id="b"><p>Hello <b>world</b></p></div>`),
+		strings.NewReader("<div id=b class=a>\n  <p>Hello\n  <b>world</b>\n</div>"), opts,
+	)
+	if err != nil || !equal || d != "" {
+		t.Errorf("Expected them to be equal, got %v, %q, %v", equal, d, err)
+	}
+	equal, d, err = EqualHTML(strings.NewReader(`<p title="a">Hello</p>`), strings.NewReader(`<p title="b">Hello</p>`), opts)
+	want := "--- a\n+++ b\n@@ -1 +1 @@\n-<p title=\"a\">Hello</p>\n+<p title=\"b\">Hello</p>\n"
+	if err != nil || equal || d != want {
+		t.Errorf("Expected %q, got %v, %q, %v", want, equal, d, err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if err := CopyWithOptions(ioutil.Discard, strings.NewReader("<p>a</p>"), Options{Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`msg="read input" bytes=8`, `msg="detected charset" charset=utf-8`,
+		`msg=tidying template=none`, `msg=parsed`, `nodes=5`, `msg=rendered`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected the log to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var got []Metrics
+	opts := Options{Metrics: func(m Metrics) { got = append(got, m) }}
+	if err := CopyWithOptions(ioutil.Discard, strings.NewReader("<p>a</p>"), opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.MaxNodes = 1
+	if err := CopyWithOptions(ioutil.Discard, strings.NewReader("<p>a</p>"), opts); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 calls, got %d", len(got))
+	}
+	m := got[0]
+	if m.BytesIn != 8 || m.BytesOut != 72 || m.Nodes != 5 || m.Duration < m.ParseDuration+m.RenderDuration {
+		t.Errorf("Unexpected metrics: %+v", m)
+	}
+	if m := got[1]; m.BytesIn != 8 || m.BytesOut != 0 || m.Nodes != 5 {
+		t.Errorf("Unexpected metrics for a failure: %+v", m)
+	}
+}
@@ -0,0 +1,99 @@
+package tidyhtml
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// The marks that tidyWithAnchors adds to the input, which are taken
+	// out of elements that are written as they were.
+	positionMarkRegexp = regexp.MustCompile(" " + positionMark + "=[0-9]+")
+
+	// The comments that template placeholders in text are moved into,
+	// which are taken out of them again.
+	placeholderCommentRegexp = regexp.MustCompile("<!--([\uE000\uE002][0-9]+\uE001)-->")
+)
+
+// verbatimMatch returns a function which reports whether an element in b
+// is to be written exactly as it was in the input, or nil if there are
+// none.
+func verbatimMatch(b []byte, opts Options) (func(n *html.Node) bool, error) {
+	var sels []string
+	if opts.ExcludeSelector != "" {
+		sels = append(sels, opts.ExcludeSelector)
+	}
+	name := strings.ToLower(opts.TidyAttr)
+	if name == "" {
+		name = DefaultTidyAttr
+	}
+	// Most documents do not have the attribute, so they are not parsed
+	// twice to look for it.
+	if name != "-" && (bytes.Contains(b, []byte(name)) || bytes.Contains(b, []byte(strings.ToUpper(name)))) {
+		sels = append(sels, "["+name+"=off]")
+	}
+	names := verbatimNames(opts)
+	amp := opts.AMP && bytes.Contains(b, []byte("-boilerplate"))
+	if len(sels) == 0 && len(names) == 0 && !amp {
+		return nil, nil
+	}
+	var sel selector
+	if len(sels) != 0 {
+		var err error
+		if sel, err = parseSelector(strings.Join(sels, ", ")); err != nil {
+			return nil, err
+		}
+	}
+	return func(n *html.Node) bool {
+		return names[n.Data] || sel.match(n) || amp && isAMPBoilerplate(n)
+	}, nil
+}
+
+// verbatimNames returns the names of the elements in VerbatimElements,
+// and those with VerbatimFormat in ElementFormats.
+func verbatimNames(opts Options) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range opts.VerbatimElements {
+		names[strings.ToLower(name)] = true
+	}
+	for name, f := range opts.ElementFormats {
+		if f == VerbatimFormat {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// keepVerbatim replaces the elements that match with the source that
+// they were parsed from, so that they are written exactly as they were.
+// The tree must have been parsed from src after markPositions. Elements
+// that are closed implicitly are tidied as usual, as where they end in
+// src is not known.
+func keepVerbatim(doc *html.Node, src []byte, match func(n *html.Node) bool) {
+	positions := takePositions(doc)
+	ends := elementEnds(src)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			start, ok := positions[c]
+			end, closed := ends[start]
+			if !ok || !closed || !match(c) {
+				walk(c)
+				continue
+			}
+			data := positionMarkRegexp.ReplaceAll(src[start:end], nil)
+			data = placeholderCommentRegexp.ReplaceAll(data, []byte("$1"))
+			raw := &html.Node{Type: html.RawNode, Data: string(data)}
+			n.InsertBefore(raw, c)
+			n.RemoveChild(c)
+			c = raw
+		}
+	}
+	walk(doc)
+}